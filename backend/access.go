@@ -16,9 +16,11 @@ var accessTmpl = tmpl(`<h1>Access Rules of {{ .Selected.Location }}</h1>
 
 	<p>
 		<a class="btn btn-secondary" href="choose/1{{ .Selected.Location }}">Cancel</a>
+		<a class="btn btn-secondary" href="permissions{{ .Selected.Location }}">Who can access</a>
 	</p>
 
 	<form method="post">
+		{{ $.CSRFField }}
 
 		<h2>Workflows (edit)</h2>
 
@@ -42,24 +44,46 @@ var accessTmpl = tmpl(`<h1>Access Rules of {{ .Selected.Location }}</h1>
 
 		<h2>Group permissions</h2>
 
+		{{ if .Selected.Parent }}
+			<div class="form-check mb-2">
+				<input class="form-check-input" type="checkbox" name="block" id="block" {{ if .InheritanceBlocked }}checked{{ end }}>
+				<label class="form-check-label" for="block">Block inheritance: rules of ancestor nodes don't apply here, except admin rules of the root node</label>
+			</div>
+		{{ end }}
+
 		<table class="table">
 
 			<tr>
 				<th>Group</th>
 				<th>Permission</th>
+				<th>Validity</th>
 				<th>Delete</th>
 			</tr>
 
+			{{ $validities := .Validities }}
+
 			{{ range $group, $permission := .Selected.GetAssignedRules }}
 
 				<tr>
 					<td>{{ $group.Name }}</td>
 					<td>{{ $permission.String }}</td>
+					<td>{{ index $validities $group.ID }}</td>
 					<td><input type="checkbox" name="remove[]" value="{{ $group.ID }}"></td>
 				</tr>
 
 			{{ end }}
 
+			{{ range .InactiveRules }}
+
+				<tr class="text-muted" title="This rule does not apply at the moment.">
+					<td>{{ .Group.Name }}</td>
+					<td>{{ .Permission.String }}</td>
+					<td>{{ .Validity }}</td>
+					<td><input type="checkbox" name="remove[]" value="{{ .Group.ID }}"></td>
+				</tr>
+
+			{{ end }}
+
 			<tr>
 				<td>
 					<select class="form-control" name="group">
@@ -75,13 +99,12 @@ var accessTmpl = tmpl(`<h1>Access Rules of {{ .Selected.Location }}</h1>
 				<td>
 					<select class="form-control" name="permission">
 						<option value=""></option>
-						<option value="` + strconv.Itoa(int(core.None)) + `">none</option>
-						<option value="` + strconv.Itoa(int(core.Read)) + `">read</option>
-						<option value="` + strconv.Itoa(int(core.Create)) + `">create</option>
-						<option value="` + strconv.Itoa(int(core.Remove)) + `">remove</option>
-						<option value="` + strconv.Itoa(int(core.Admin)) + `">admin</option>2
+						` + permissionOptions + `
 					</select>
 				</td>
+				<td>
+					` + validityInputs + `
+				</td>
 				<td></td>
 			</tr>
 		</table>
@@ -92,16 +115,88 @@ var accessTmpl = tmpl(`<h1>Access Rules of {{ .Selected.Location }}</h1>
 
 	</form>`)
 
+// permissionOptions contains an option element for each permission.
+var permissionOptions = `<option value="` + strconv.Itoa(int(core.None)) + `">none (deny)</option>
+						<option value="` + strconv.Itoa(int(core.Read)) + `">read</option>
+						<option value="` + strconv.Itoa(int(core.Create)) + `">create</option>
+						<option value="` + strconv.Itoa(int(core.Remove)) + `">remove</option>
+						<option value="` + strconv.Itoa(int(core.Admin)) + `">admin</option>`
+
+// validityInputs contains input elements for the optional bounds of a core.Validity.
+var validityInputs = `<input type="datetime-local" class="form-control form-control-sm mb-1" name="valid_from" placeholder="from (optional)" title="valid from (optional)">
+					<input type="datetime-local" class="form-control form-control-sm" name="valid_until" placeholder="until (optional)" title="valid until (optional)">`
+
 type accessData struct {
 	*context
 	Selected *core.Node
 }
 
-func (t *accessData) AllGroups() ([]core.DBGroup, error) {
-	return t.db.GetAllGroups(100000, 0) // assuming there are not more than 100k groups
+// An inactiveRule is an access rule whose validity does not include the current time.
+type inactiveRule struct {
+	Group      core.DBGroup
+	Permission core.Permission
+	Validity   core.Validity
+}
+
+func (t *accessData) timedRules() ([]core.TimedAccessRule, error) {
+	all, err := t.db.GetTimedAccessRules()
+	if err != nil {
+		return nil, err
+	}
+	var result = []core.TimedAccessRule{}
+	for _, r := range all {
+		if r.NodeID == t.Selected.ID() {
+			result = append(result, r)
+		}
+	}
+	return result, nil
 }
 
-func (t *accessData) WriteWorkflowOptions(selectedWorkflow *core.Workflow) (template.HTML, error) {
+// Validities returns the validities of the time-limited rules of the selected node.
+func (t *accessData) Validities() (map[int]core.Validity, error) {
+	rules, err := t.timedRules()
+	if err != nil {
+		return nil, err
+	}
+	var result = make(map[int]core.Validity)
+	for _, r := range rules {
+		result[r.GroupID] = r.Validity
+	}
+	return result, nil
+}
+
+func (t *accessData) InactiveRules() ([]inactiveRule, error) {
+	rules, err := t.timedRules()
+	if err != nil {
+		return nil, err
+	}
+	var result = []inactiveRule{}
+	for _, r := range rules {
+		if r.ActiveNow() {
+			continue
+		}
+		group, err := t.db.GetGroup(r.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, inactiveRule{
+			Group:      group,
+			Permission: core.Permission(r.Permission),
+			Validity:   r.Validity,
+		})
+	}
+	return result, nil
+}
+
+func (t *accessData) InheritanceBlocked() (bool, error) {
+	return t.db.IsInheritanceBlocked(t.Selected.ID())
+}
+
+func (ctx *context) AllGroups() ([]core.DBGroup, error) {
+	return ctx.db.GetAllGroups(100000, 0) // assuming there are not more than 100k groups
+}
+
+func (ctx *context) WriteWorkflowOptions(selectedWorkflow *core.Workflow) (template.HTML, error) {
 
 	buf := &bytes.Buffer{}
 
@@ -115,7 +210,7 @@ func (t *accessData) WriteWorkflowOptions(selectedWorkflow *core.Workflow) (temp
 
 	// workflows
 
-	allWorkflows, err := t.db.GetAllWorkflows(10000, 0) // assuming there are not more than 10k workflows
+	allWorkflows, err := ctx.db.GetAllWorkflows(10000, 0) // assuming there are not more than 10k workflows
 	if err != nil {
 		return template.HTML(""), err
 	}
@@ -154,14 +249,8 @@ func access(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 			return err
 		}
 
-		if workflowID == 0 {
-			if err = ctx.db.UnassignWorkflow(selected, false); err != nil {
-				return err
-			}
-		} else {
-			if err = ctx.db.AssignWorkflow(selected, false, workflowID); err != nil {
-				return err
-			}
+		if err = setWorkflow(ctx, selected, false, workflowID); err != nil {
+			return err
 		}
 
 		// children workflow
@@ -171,13 +260,27 @@ func access(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 			return err
 		}
 
-		if childrenWorkflowID == 0 {
-			if err = ctx.db.UnassignWorkflow(selected, true); err != nil {
+		if err = setWorkflow(ctx, selected, true, childrenWorkflowID); err != nil {
+			return err
+		}
+
+		// inheritance
+
+		if selected.Parent != nil {
+			var block = req.PostFormValue("block") != ""
+			blocked, err := ctx.db.IsInheritanceBlocked(selected.ID())
+			if err != nil {
 				return err
 			}
-		} else {
-			if err = ctx.db.AssignWorkflow(selected, true, childrenWorkflowID); err != nil {
-				return err
+			if block != blocked {
+				if block {
+					if err := preventBlockLockout(ctx, selected); err != nil {
+						return err
+					}
+				}
+				if err := ctx.db.SetInheritanceBlocked(ctx.User, selected, block); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -195,28 +298,14 @@ func access(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 
 		// anti-lockout
 
-		myAdminRules, err := selected.RequirePermissionRules(core.Admin, ctx.User)
-		if err != nil {
+		if err := preventLockout(ctx, selected, removeRules); err != nil {
 			return err
 		}
 
-		var mySelectedAdminRules = myAdminRules[selected.ID()]
-		if len(myAdminRules) == len(mySelectedAdminRules) {
-			// all of my admin rules apply to this node, none of them apply to any of its ancestors
-			for groupID := range removeRules {
-				// simulate removal
-				delete(mySelectedAdminRules, groupID)
-			}
-			if len(mySelectedAdminRules) == 0 {
-				// there would be no admin rules left for this node
-				return errors.New("you can't lock yourself out")
-			}
-		}
-
 		// process removeRules
 
 		for removeGroupID := range removeRules {
-			err = ctx.db.RemoveAccessRule(selected, removeGroupID)
+			err = ctx.db.RemoveAccessRule(ctx.User, selected, removeGroupID)
 			if err != nil {
 				return fmt.Errorf("error removing rule: %v", err)
 			}
@@ -239,7 +328,18 @@ func access(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 				return err
 			}
 
-			err = ctx.db.AddAccessRule(selected, addGroupID, core.Permission(addPermission))
+			validity, err := core.ParseValidity(req.PostFormValue("valid_from"), req.PostFormValue("valid_until"))
+			if err != nil {
+				return err
+			}
+
+			if core.Permission(addPermission) == core.None {
+				if err := preventDenyLockout(ctx, selected, addGroupID); err != nil {
+					return err
+				}
+			}
+
+			err = ctx.db.AddAccessRule(ctx.User, selected, addGroupID, core.Permission(addPermission), validity)
 			if err != nil {
 				return fmt.Errorf("error adding rule: %v", err)
 			}
@@ -254,3 +354,106 @@ func access(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 		Selected: selected,
 	})
 }
+
+// preventLockout returns an error if removing the rules of the given groups would revoke the Admin permission of the user on the node.
+func preventLockout(ctx *context, selected *core.Node, removeRules map[int]interface{}) error {
+
+	myAdminRules, err := selected.RequirePermissionRules(core.Admin, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	var mySelectedAdminRules = myAdminRules[selected.ID()]
+	if len(myAdminRules) == len(mySelectedAdminRules) {
+		// all of my admin rules apply to this node, none of them apply to any of its ancestors
+		for groupID := range removeRules {
+			// simulate removal
+			delete(mySelectedAdminRules, groupID)
+		}
+		if len(mySelectedAdminRules) == 0 {
+			// there would be no admin rules left for this node
+			return errors.New("you can't lock yourself out")
+		}
+	}
+
+	return nil
+}
+
+// preventBlockLockout returns an error if blocking the inheritance would revoke the Admin permission of the user on the node.
+func preventBlockLockout(ctx *context, selected *core.Node) error {
+
+	if ctx.IsRootAdmin() {
+		return nil
+	}
+
+	myAdminRules, err := selected.RequirePermissionRules(core.Admin, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	if len(myAdminRules[selected.ID()]) == 0 {
+		return errors.New("you can't lock yourself out")
+	}
+
+	return nil
+}
+
+// preventDenyLockout returns an error if a deny rule for the given group would revoke the Admin permission of the user on the node.
+func preventDenyLockout(ctx *context, selected *core.Node, groupID int) error {
+
+	if ctx.IsRootAdmin() {
+		return nil
+	}
+
+	myAdminRules, err := selected.RequirePermissionRules(core.Admin, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	if len(myAdminRules[selected.ID()]) > 0 {
+		return nil // rules on the same node take precedence over the deny rule
+	}
+
+	group, err := ctx.db.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	isMember, err := group.HasMember(ctx.User)
+	if err != nil {
+		return err
+	}
+
+	if isMember {
+		return errors.New("you can't lock yourself out")
+	}
+
+	return nil
+}
+
+// setWorkflow assigns a workflow to the node, or unassigns it if workflowID is zero. It does nothing if the assignment is unchanged.
+func setWorkflow(ctx *context, selected *core.Node, childrenOnly bool, workflowID int) error {
+
+	oldWorkflowID, err := ctx.db.GetAssignedWorkflowID(selected.ID(), childrenOnly)
+	if err != nil {
+		return err
+	}
+
+	if oldWorkflowID == workflowID {
+		return nil
+	}
+
+	if oldWorkflowID != 0 {
+		if err := ctx.db.UnassignWorkflow(ctx.User, selected, childrenOnly); err != nil {
+			return err
+		}
+	}
+
+	if workflowID != 0 {
+		if err := ctx.db.AssignWorkflow(ctx.User, selected, childrenOnly, workflowID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
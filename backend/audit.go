@@ -0,0 +1,260 @@
+package backend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+	"github.com/wansing/perspective/util"
+)
+
+const AuditPerPage = 50
+
+var auditTmpl = tmpl(`<h1>Audit Log</h1>
+
+	<form method="get" class="form-row">
+		<div class="col-md-2">
+			<select class="form-control" name="action">
+				<option value="">Any action</option>
+				{{ range .Actions }}
+					<option {{ if eq . $.Filter.Action }}selected{{ end }} value="{{ . }}">{{ . }}</option>
+				{{ end }}
+			</select>
+		</div>
+		<div class="col-md-3">
+			<input class="form-control" name="user" placeholder="User" value="{{ .Filter.Username }}">
+		</div>
+		<div class="col-md-2">
+			<input class="form-control" type="number" name="node" placeholder="Node ID" value="{{ if .Filter.NodeID }}{{ .Filter.NodeID }}{{ end }}">
+		</div>
+		<div class="col-md-2">
+			<input class="form-control" type="date" name="from" title="From" value="{{ .From }}">
+		</div>
+		<div class="col-md-2">
+			<input class="form-control" type="date" name="until" title="Until" value="{{ .Until }}">
+		</div>
+		<div class="col-md-1">
+			<button type="submit" class="btn btn-primary">Filter</button>
+		</div>
+	</form>
+
+	<p class="mt-3">
+		Export: <a href="audit/export/csv?{{ .Query }}">CSV</a> &middot; <a href="audit/export/json?{{ .Query }}">JSON</a>
+	</p>
+
+	<div class="table-responsive">
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Time</th>
+					<th>User</th>
+					<th>Action</th>
+					<th>Node</th>
+					<th>Details</th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Entries }}
+					<tr>
+						<td>{{ FormatTs .Ts }}</td>
+						<td>{{ if .UserID }}{{ .Username }}{{ else }}<em>system</em>{{ end }}</td>
+						<td>{{ .Action }}</td>
+						<td>{{ if .NodeID }}{{ .NodeID }}{{ end }}</td>
+						<td>{{ .Details }}</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</div>
+	<nav>
+		<ul class="pagination justify-content-center">
+			{{ range .PageLinks }}
+				{{ . }}
+			{{ end }}
+		</ul>
+	</nav>`)
+
+type auditData struct {
+	*context
+	Filter core.AuditFilter
+	From   string
+	Until  string
+	Query  string // encoded filter
+	page   int
+}
+
+func (data *auditData) Actions() []string {
+	return core.AuditActions
+}
+
+func (data *auditData) Entries() ([]core.DBAuditEntry, error) {
+	return data.db.GetAuditEntries(data.Filter, AuditPerPage, (data.page-1)*AuditPerPage)
+}
+
+func (data *auditData) PageLinks() []template.HTML {
+
+	pagesTotal := 1
+
+	if count, err := data.db.CountAuditEntries(data.Filter); err == nil {
+		pagesTotal = int(math.Ceil(float64(count) / AuditPerPage))
+	}
+
+	return util.PageLinks(
+		data.page,
+		pagesTotal,
+		func(page int, name string) string {
+			return fmt.Sprintf(`<li class="page-item"><a class="page-link" href="audit?page=%d&%s">%s</a></li>`, page, template.HTMLEscapeString(data.Query), name)
+		},
+		func(page int, name string) string {
+			return fmt.Sprintf(`<li class="page-item active"><span class="page-link">%d</span></li>`, page)
+		},
+	)
+}
+
+// parseAuditFilter reads an AuditFilter from the URL query. Dates are formatted like "2006-01-02", "until" is inclusive.
+func parseAuditFilter(query url.Values) (*auditData, error) {
+
+	var data = &auditData{
+		Filter: core.AuditFilter{
+			Action:   query.Get("action"),
+			Username: strings.TrimSpace(query.Get("user")),
+		},
+		From:  query.Get("from"),
+		Until: query.Get("until"),
+	}
+
+	if nodeStr := query.Get("node"); nodeStr != "" {
+		nodeID, err := strconv.Atoi(nodeStr)
+		if err != nil {
+			return nil, err
+		}
+		data.Filter.NodeID = nodeID
+	}
+
+	if data.From != "" {
+		from, err := time.ParseInLocation("2006-01-02", data.From, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		data.Filter.From = from.Unix()
+	}
+
+	if data.Until != "" {
+		until, err := time.ParseInLocation("2006-01-02", data.Until, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		data.Filter.Until = until.AddDate(0, 0, 1).Unix()
+	}
+
+	var encoded = url.Values{}
+	for _, key := range []string{"action", "user", "node", "from", "until"} {
+		if value := query.Get(key); value != "" {
+			encoded.Set(key, value)
+		}
+	}
+	data.Query = encoded.Encode()
+
+	return data, nil
+}
+
+func audit(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.IsRootAdmin() {
+		return errors.New("unauthorized")
+	}
+
+	data, err := parseAuditFilter(req.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	data.context = ctx
+	data.page, err = strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil || data.page < 1 {
+		data.page = 1
+	}
+
+	return auditTmpl.Execute(w, data)
+}
+
+// csvText prevents spreadsheet applications from interpreting a text field as a formula (CSV injection).
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// auditExport writes all audit entries which match the filter as CSV or JSON.
+func auditExport(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.IsRootAdmin() {
+		return errors.New("unauthorized")
+	}
+
+	data, err := parseAuditFilter(req.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	entries, err := ctx.db.GetAuditEntries(data.Filter, math.MaxInt32, 0)
+	if err != nil {
+		return err
+	}
+
+	switch params.ByName("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		var cw = csv.NewWriter(w)
+		cw.Write([]string{"time", "user_id", "username", "action", "node_id", "details"})
+		for _, e := range entries {
+			cw.Write([]string{
+				time.Unix(e.Ts(), 0).Format(time.RFC3339),
+				strconv.Itoa(e.UserID()),
+				csvText(e.Username()),
+				e.Action(),
+				strconv.Itoa(e.NodeID()),
+				csvText(e.Details()),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		type jsonEntry struct {
+			Time     string `json:"time"`
+			UserID   int    `json:"user_id"`
+			Username string `json:"username"`
+			Action   string `json:"action"`
+			NodeID   int    `json:"node_id"`
+			Details  string `json:"details"`
+		}
+		var result = make([]jsonEntry, len(entries))
+		for i, e := range entries {
+			result[i] = jsonEntry{
+				Time:     time.Unix(e.Ts(), 0).Format(time.RFC3339),
+				UserID:   e.UserID(),
+				Username: e.Username(),
+				Action:   e.Action(),
+				NodeID:   e.NodeID(),
+				Details:  e.Details(),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.json"`)
+		return json.NewEncoder(w).Encode(result)
+	default:
+		return fmt.Errorf("unknown format: %s", params.ByName("format"))
+	}
+}
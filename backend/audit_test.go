@@ -0,0 +1,24 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestCSVText(t *testing.T) {
+	var tests = map[string]string{
+		"":                       "",
+		"alice@example.org":      "alice@example.org",
+		"=HYPERLINK(\"x\")":      "'=HYPERLINK(\"x\")",
+		"+1":                     "'+1",
+		"-2+3":                   "'-2+3",
+		"@SUM(A1)":               "'@SUM(A1)",
+		"\t=1":                   "'\t=1",
+		"\r=1":                   "'\r=1",
+		"version 3, comment: =1": "version 3, comment: =1",
+	}
+	for input, want := range tests {
+		if got := csvText(input); got != want {
+			t.Errorf("csvText(%q): got %q, want %q", input, got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package backend
 import (
 	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"net/http"
 
@@ -15,14 +16,31 @@ var ErrAuth = errors.New("unauthorized")
 // we need the CoreDB in the backend
 type context struct {
 	*core.Request
-	Prefix string // with trailing slash
-	db     *core.CoreDB
+	Prefix  string // with trailing slash
+	db      *core.CoreDB
+	httpReq *http.Request // for accessing the session
+}
+
+// MailEnabled returns whether emails can be sent.
+func (ctx *context) MailEnabled() bool {
+	return ctx.db.Mailer != nil && ctx.db.PublicURL != ""
+}
+
+// OIDCEnabled returns whether users can log in with an OpenID Connect provider.
+func (ctx *context) OIDCEnabled() bool {
+	return ctx.db.OIDC != nil
 }
 
 func (ctx *context) GroupsWriteable() bool {
 	return ctx.db.GroupDB.Writeable()
 }
 
+// ManagesGroups returns whether the user manages at least one group.
+func (ctx *context) ManagesGroups() (bool, error) {
+	managed, err := ctx.ManagedGroups()
+	return len(managed) > 0, err
+}
+
 func (ctx *context) UsersWriteable() bool {
 	return ctx.db.UserDB.Writeable()
 }
@@ -31,6 +49,21 @@ func (ctx *context) WorkflowsWriteable() bool {
 	return ctx.db.WorkflowDB.Writeable()
 }
 
+// mustEnrollTOTP returns whether the user is a member of a group which requires TOTP, but has not enabled it yet.
+func (ctx *context) mustEnrollTOTP() (bool, error) {
+	required, err := ctx.db.TOTPRequired(ctx.User)
+	if err != nil || !required {
+		return false, err
+	}
+	hasTOTP, err := ctx.db.HasTOTP(ctx.User)
+	return !hasTOTP, err
+}
+
+// enrollmentExempt returns whether the request is allowed while the user must enroll TOTP: the own user page, where TOTP is set up, and logout.
+func (ctx *context) enrollmentExempt(req *http.Request) bool {
+	return req.URL.Path == fmt.Sprintf("/user/%d", ctx.User.ID()) || req.URL.Path == "/logout"
+}
+
 func middleware(db *core.CoreDB, prefix string, requireLoggedIn bool, f func(http.ResponseWriter, *http.Request, *context, httprouter.Params) error) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 
@@ -42,14 +75,40 @@ func middleware(db *core.CoreDB, prefix string, requireLoggedIn bool, f func(htt
 			Prefix:  prefix + "/backend/",
 			Request: request,
 			db:      db,
+			httpReq: req,
 		}
 		defer ctx.Cleanup()
 
+		if err := ctx.AuthError(); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err := ctx.checkCSRF(req); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			errorTmpl.Execute(w, struct {
+				*context
+				Err error
+			}{
+				context: ctx,
+				Err:     err,
+			})
+			return
+		}
+
 		if requireLoggedIn && !ctx.LoggedIn() {
 			ctx.SeeOther("/")
 			return
 		}
 
+		if requireLoggedIn && !ctx.enrollmentExempt(req) {
+			if mustEnroll, err := ctx.mustEnrollTOTP(); err != nil || mustEnroll {
+				ctx.Danger(errors.New("your group requires two-factor authentication, please set it up"))
+				ctx.SeeOther("/user/%d", ctx.User.ID())
+				return
+			}
+		}
+
 		ctx.SetGlobal("include-bootstrap-4-css", "true")
 
 		if err := f(w, req, ctx, params); err != nil {
@@ -81,25 +140,47 @@ func NewBackendRouter(db *core.CoreDB, prefix string) http.Handler {
 
 	// public
 	router.GET("/", middleware(db, prefix, false, root))
+	GETAndPOST("/forgot-password", middleware(db, prefix, false, forgotPassword))
 	GETAndPOST("/login", middleware(db, prefix, false, login))
+	GETAndPOST("/login-oidc", middleware(db, prefix, false, loginOIDC))
+	router.GET("/login-oidc/callback", middleware(db, prefix, false, loginOIDCCallback))
+	GETAndPOST("/login-totp", middleware(db, prefix, false, loginTOTP))
+	GETAndPOST("/set-password/:token", middleware(db, prefix, false, setPassword))
 
 	// private
 	GETAndPOST("/access/*path", middleware(db, prefix, true, access))
+	router.GET("/audit", middleware(db, prefix, true, audit))
+	router.GET("/audit/export/:format", middleware(db, prefix, true, auditExport))
+	router.POST("/bulk/*path", middleware(db, prefix, true, bulk))
+	GETAndPOST("/changeset/:id", middleware(db, prefix, true, changeSet))
+	router.POST("/changeset-add/:version/*path", middleware(db, prefix, true, changeSetAdd))
+	GETAndPOST("/changesets", middleware(db, prefix, true, changeSets))
 	router.GET("/choose/:page/*path", middleware(db, prefix, true, choose)) // "/choose/1/" will work, "/choose/1" won't. GET("/choose/:page") would match everyhing.
 	GETAndPOST("/class/*path", middleware(db, prefix, true, setClass))
+	router.POST("/comment/:version/*path", middleware(db, prefix, true, comment))
 	GETAndPOST("/create/*path", middleware(db, prefix, true, create))
 	GETAndPOST("/create-root-node", middleware(db, prefix, true, createRootNode))
 	GETAndPOST("/delete/*path", middleware(db, prefix, true, del))
 	GETAndPOST("/edit/:version/*path", middleware(db, prefix, true, edit))
 	GETAndPOST("/groups", middleware(db, prefix, true, groups))
 	GETAndPOST("/group/:id", middleware(db, prefix, true, group))
+	router.POST("/lock/*path", middleware(db, prefix, true, lock))
+	GETAndPOST("/login-failures", middleware(db, prefix, true, loginFailures))
 	router.GET("/logout", middleware(db, prefix, true, logout))
 	GETAndPOST("/move/*path", middleware(db, prefix, true, move))
+	router.GET("/permissions/*path", middleware(db, prefix, true, permissions))
 	router.POST("/release/:version/*path", middleware(db, prefix, true, release))
+	GETAndPOST("/registrations", middleware(db, prefix, true, registrations))
 	GETAndPOST("/rename/*path", middleware(db, prefix, true, rename))
 	router.POST("/revoke/:version/*path", middleware(db, prefix, true, revoke))
 	router.GET("/rules", middleware(db, prefix, true, rules))
-	router.GET("/users", middleware(db, prefix, true, users))
+	router.GET("/search", middleware(db, prefix, true, search))
+	router.GET("/tasks", middleware(db, prefix, true, tasks))
+	router.GET("/tree", middleware(db, prefix, true, tree))
+	router.GET("/tree-children/*path", middleware(db, prefix, true, treeChildren))
+	router.POST("/unlock/*path", middleware(db, prefix, true, unlock))
+	GETAndPOST("/view-as", middleware(db, prefix, true, viewAs))
+	GETAndPOST("/users", middleware(db, prefix, true, users))
 	GETAndPOST("/user/:id", middleware(db, prefix, true, user))
 	GETAndPOST("/workflows", middleware(db, prefix, true, workflows))
 	GETAndPOST("/workflow/:id", middleware(db, prefix, true, workflow))
@@ -198,6 +279,15 @@ var backendTmpl = template.Must(template.New("backend").Parse(`
 					<li class="nav-item">
 						<a class="nav-link" href="choose/1/">Nodes</a>
 					</li>
+					<li class="nav-item">
+						<a class="nav-link" href="tree">Tree</a>
+					</li>
+					<li class="nav-item">
+						<a class="nav-link" href="tasks">My tasks</a>
+					</li>
+					<li class="nav-item">
+						<a class="nav-link" href="changesets">Change sets</a>
+					</li>
 					<li class="nav-item">
 						<a class="nav-link" href="user/{{ .User.ID }}">{{ .User.Name }}</a>
 					</li>
@@ -214,6 +304,9 @@ var backendTmpl = template.Must(template.New("backend").Parse(`
 							<li class="nav-item">
 								<a class="nav-link" href="users">Users</a>
 							</li>
+							<li class="nav-item">
+								<a class="nav-link" href="registrations">Registrations</a>
+							</li>
 						{{ end }}
 
 						{{ if .WorkflowsWriteable }}
@@ -226,12 +319,33 @@ var backendTmpl = template.Must(template.New("backend").Parse(`
 							<a class="nav-link" href="rules">Rules</a>
 						</li>
 
+						<li class="nav-item">
+							<a class="nav-link" href="audit">Audit log</a>
+						</li>
+
+						<li class="nav-item">
+							<a class="nav-link" href="login-failures">Failed logins</a>
+						</li>
+
+						<li class="nav-item">
+							<a class="nav-link" href="view-as">View as</a>
+						</li>
+
+					{{ else if and .GroupsWriteable .ManagesGroups }}
+
+						<li class="nav-item">
+							<a class="nav-link" href="groups">Groups</a>
+						</li>
+
 					{{ end }}
 
 					<li class="nav-item">
 						<a class="nav-link" href="logout">Logout</a>
 					</li>
 				</ul>
+				<form class="form-inline ml-auto" action="search">
+					<input class="form-control form-control-sm" name="q" placeholder="Search nodes">
+				</form>
 			</nav>
 
 			<script>
@@ -246,6 +360,11 @@ var backendTmpl = template.Must(template.New("backend").Parse(`
 
 		<div class="container pt-3">
 			<div class="starter-template">
+				{{ if .LoggedIn }}
+					{{ with .ViewAsName }}
+						<div class="alert alert-warning" role="alert">You are viewing the site as {{ . }}. <a href="view-as">Change</a></div>
+					{{ end }}
+				{{ end }}
 				{{ .RenderNotifications }}
 				{{ template "content" . }}
 			</div>
@@ -321,21 +440,38 @@ var backendTmpl = template.Must(template.New("backend").Parse(`
 			return n.RequirePermission(core.Remove, u) == nil
 		},
 		"FormatTs": FormatTs,
+		"GrantLink": func(g core.Grant) template.HTML {
+			var result string
+			if g.Workflow != nil {
+				result = fmt.Sprintf(`workflow <a href="workflow/%d">%s</a>`, g.Workflow.ID(), html.EscapeString(g.Workflow.Name()))
+				if g.ChildrenOnly {
+					result += " (children only)"
+				}
+			} else if g.Group.ID() == 0 {
+				result = fmt.Sprintf(`rule for %s`, html.EscapeString(g.Group.Name()))
+			} else {
+				result = fmt.Sprintf(`rule for <a href="group/%d">%s</a>`, g.Group.ID(), html.EscapeString(g.Group.Name()))
+			}
+			if g.Location != "" {
+				result += fmt.Sprintf(` on <a href="access%s">%s</a>`, html.EscapeString(g.Location), html.EscapeString(g.Location))
+			}
+			return template.HTML(result)
+		},
 		"GroupLink": func(group core.DBGroup) template.HTML {
 			if group.ID() == 0 { // all users
-				return template.HTML(group.Name())
+				return template.HTML(html.EscapeString(group.Name()))
 			} else {
-				return template.HTML(fmt.Sprintf(`<a href="group/%d">%s</a>`, group.ID(), group.Name()))
+				return template.HTML(fmt.Sprintf(`<a href="group/%d">%s</a>`, group.ID(), html.EscapeString(group.Name())))
 			}
 		},
 		"UserLink": func(user core.DBUser) template.HTML {
-			return template.HTML(fmt.Sprintf(`<a href="user/%d">%s</a>`, user.ID(), user.Name()))
+			return template.HTML(fmt.Sprintf(`<a href="user/%d">%s</a>`, user.ID(), html.EscapeString(user.Name())))
 		},
 		"WorkflowLink": func(w *core.Workflow) template.HTML {
-			return template.HTML(fmt.Sprintf(`<a href="workflow/%d">%s</a>`, w.ID(), w.Name()))
+			return template.HTML(fmt.Sprintf(`<a href="workflow/%d">%s</a>`, w.ID(), html.EscapeString(w.Name())))
 		},
 		"WorkflowLinkLong": func(w *core.Workflow) template.HTML {
-			return template.HTML(fmt.Sprintf(`<a href="workflow/%d">%s</a>`, w.ID(), w.String()))
+			return template.HTML(fmt.Sprintf(`<a href="workflow/%d">%s</a>`, w.ID(), html.EscapeString(w.String())))
 		},
 	},
 )
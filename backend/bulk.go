@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var bulkTmpl = tmpl(`<h1>Bulk operation on children of {{ .Selected.Location }}</h1>
+
+	<p>
+		<a class="btn btn-secondary" href="choose/1{{ .Selected.Location }}">Back</a>
+	</p>
+
+	<p>{{ .Succeeded }} succeeded, {{ .Failed }} failed.</p>
+
+	<div class="table-responsive">
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Node</th>
+					<th>Result</th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Results }}
+					<tr>
+						<td>{{ .Location }}</td>
+						<td>
+							{{ if .Err }}
+								<span class="alert-inline alert-danger">{{ .Err }}</span>
+							{{ else }}
+								<span class="alert-inline alert-success">ok</span>
+							{{ end }}
+						</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</div>`)
+
+type bulkResult struct {
+	Location string
+	Err      error
+}
+
+type bulkData struct {
+	*context
+	Selected *core.Node
+	Results  []bulkResult
+}
+
+func (data *bulkData) Failed() int {
+	var failed = 0
+	for _, r := range data.Results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func (data *bulkData) Succeeded() int {
+	return len(data.Results) - data.Failed()
+}
+
+// bulk applies an action to the selected children of a node. Permissions are checked for each child separately, like the single-node handlers do.
+func bulk(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	if err := selected.RequirePermission(core.Read, ctx.User); err != nil {
+		return err
+	}
+
+	var apply func(child *core.Node) error
+
+	switch req.PostFormValue("action") {
+	case "move":
+		apply, err = bulkMove(ctx, selected, req.PostFormValue("parentUrl"))
+	case "delete":
+		apply = func(child *core.Node) error {
+			if err := child.Parent.RequirePermission(core.Remove, ctx.User); err != nil {
+				return err
+			}
+			return ctx.db.DeleteNode(ctx.User, child)
+		}
+	case "class":
+		var classCode = req.PostFormValue("class")
+		apply = func(child *core.Node) error {
+			if err := child.RequirePermission(core.Remove, ctx.User); err != nil {
+				return err
+			}
+			return ctx.db.SetClass(ctx.User, child, classCode)
+		}
+	case "workflow":
+		var workflowID int
+		workflowID, err = strconv.Atoi(req.PostFormValue("workflow"))
+		apply = func(child *core.Node) error {
+			if err := child.RequirePermission(core.Admin, ctx.User); err != nil {
+				return err
+			}
+			return setWorkflow(ctx, child, false, workflowID)
+		}
+	case "release":
+		apply = func(child *core.Node) error {
+			return bulkRelease(ctx, child)
+		}
+	case "add-rule", "remove-rule":
+		apply, err = bulkRule(ctx, req.PostFormValue("action"), req.PostFormValue("group"), req.PostFormValue("permission"))
+	default:
+		err = errors.New("unknown action")
+	}
+	if err != nil {
+		return err
+	}
+
+	var results = []bulkResult{}
+
+	for _, slug := range req.PostForm["nodes[]"] {
+		var location = path.Join(selected.Location(), slug)
+		child, err := ctx.Open(location)
+		if err == nil {
+			err = apply(child)
+		}
+		results = append(results, bulkResult{
+			Location: location,
+			Err:      err,
+		})
+	}
+
+	return bulkTmpl.Execute(w, &bulkData{
+		context:  ctx,
+		Selected: selected,
+		Results:  results,
+	})
+}
+
+func bulkMove(ctx *context, selected *core.Node, parentUrl string) (func(*core.Node) error, error) {
+
+	if !path.IsAbs(parentUrl) {
+		parentUrl = path.Join(selected.Location(), parentUrl)
+	}
+
+	newParent, err := ctx.Open(parentUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = newParent.RequirePermission(core.Create, ctx.User); err != nil {
+		return nil, err
+	}
+
+	return func(child *core.Node) error {
+		if err := child.Parent.RequirePermission(core.Remove, ctx.User); err != nil {
+			return err
+		}
+		return ctx.db.SetParent(ctx.User, child, newParent)
+	}, nil
+}
+
+// bulkRelease releases the latest version of a node by one step, like the release handler does.
+func bulkRelease(ctx *context, child *core.Node) error {
+
+	if child.MaxVersionNo() == 0 {
+		return errors.New("node has no versions")
+	}
+
+	latest, err := child.GetVersion(child.MaxVersionNo())
+	if err != nil {
+		return err
+	}
+
+	state, err := child.ReleaseState(latest, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	if !state.CanEditNode() {
+		return ErrAuth
+	}
+
+	return ctx.db.Release(ctx.User, child, latest, state, "bulk release")
+}
+
+func bulkRule(ctx *context, action, groupIDStr, permissionStr string) (func(*core.Node) error, error) {
+
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if action == "remove-rule" {
+		return func(child *core.Node) error {
+			if err := child.RequirePermission(core.Admin, ctx.User); err != nil {
+				return err
+			}
+			if err := preventLockout(ctx, child, map[int]interface{}{groupID: struct{}{}}); err != nil {
+				return err
+			}
+			return ctx.db.RemoveAccessRule(ctx.User, child, groupID)
+		}, nil
+	}
+
+	permission, err := strconv.Atoi(permissionStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(child *core.Node) error {
+		if err := child.RequirePermission(core.Admin, ctx.User); err != nil {
+			return err
+		}
+		if core.Permission(permission) == core.None {
+			if err := preventDenyLockout(ctx, child, groupID); err != nil {
+				return err
+			}
+		}
+		if err := ctx.db.AddAccessRule(ctx.User, child, groupID, core.Permission(permission), core.Validity{}); err != nil {
+			return fmt.Errorf("error adding rule: %v", err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var changeSetTmpl = tmpl(`<h1>Change Set &raquo;{{ .Selected.Name }}&laquo;</h1>
+
+	<p>
+		Created {{ FormatTs .Selected.TsCreated }}
+		{{ if .Selected.TsReleased }}&middot; <span class="badge badge-success">released {{ FormatTs .Selected.TsReleased }}</span>{{ end }}
+	</p>
+
+	<div class="table-responsive">
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Node</th>
+					<th>Version</th>
+					<th>Workflow group</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Items }}
+					<tr>
+						{{ if .Node }}
+							<td><a href="edit/{{ .VersionNo }}{{ .Node.Location }}">{{ .Node.Location }}</a></td>
+							<td>{{ .VersionNo }}</td>
+							<td>{{ .GroupName }}</td>
+						{{ else }}
+							<td colspan="3"><em>node {{ .NodeID }} is not accessible</em></td>
+						{{ end }}
+						<td>
+							{{ if and (not $.Selected.TsReleased) $.CanModify }}
+								<form method="post" style="display: inline;">
+									{{ $.CSRFField }}
+									<input type="hidden" name="node" value="{{ .NodeID }}">
+									<button type="submit" class="btn btn-sm btn-secondary" name="action" value="remove">Remove</button>
+								</form>
+							{{ end }}
+						</td>
+					</tr>
+				{{ else }}
+					<tr><td colspan="4">Add versions on their edit page.</td></tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</div>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		{{ if .Previewing }}
+			<button type="submit" class="btn btn-secondary" name="action" value="unpreview">Stop preview</button>
+		{{ else }}
+			<button type="submit" class="btn btn-secondary" name="action" value="preview">Preview</button>
+		{{ end }}
+		{{ if .Selected.TsReleased }}
+			<button type="submit" class="btn btn-warning" name="action" value="rollback">Roll back</button>
+		{{ else }}
+			<button type="submit" class="btn btn-primary" name="action" value="release">Release all</button>
+		{{ end }}
+		{{ if .CanModify }}
+			<button type="submit" class="btn btn-danger" name="action" value="delete">Delete change set</button>
+		{{ end }}
+	</form>`)
+
+type changeSetItemData struct {
+	core.DBChangeSetItem
+	Node      *core.Node // nil if not accessible
+	GroupName string
+}
+
+type changeSetData struct {
+	*context
+	Selected core.DBChangeSet
+}
+
+func (data *changeSetData) Items() ([]changeSetItemData, error) {
+
+	items, err := data.db.GetChangeSetItems(data.Selected.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]changeSetItemData, len(items))
+
+	for i, item := range items {
+		result[i].DBChangeSetItem = item
+		path, err := data.db.InternalPathByNodeID(item.NodeID())
+		if err != nil {
+			continue
+		}
+		n, err := data.Open(path)
+		if err != nil {
+			continue
+		}
+		v, err := n.GetVersion(item.VersionNo())
+		if err != nil {
+			continue
+		}
+		result[i].Node = n
+		if grp, err := data.db.GetGroupOrReaders(v.WorkflowGroupID()); err == nil {
+			result[i].GroupName = grp.Name()
+		}
+	}
+
+	return result, nil
+}
+
+// CanModify returns whether the user can remove items and delete the change set.
+func (data *changeSetData) CanModify() bool {
+	return canModifyChangeSet(data.context, data.Selected)
+}
+
+func (data *changeSetData) Previewing() bool {
+	var cs = data.PreviewChangeSet()
+	return cs != nil && cs.ID() == data.Selected.ID()
+}
+
+func changeSet(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	selected, err := ctx.db.GetChangeSet(id)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodPost {
+
+		switch req.PostFormValue("action") {
+
+		case "delete":
+			if !canModifyChangeSet(ctx, selected) {
+				return errors.New("only the creator or an admin can delete the change set")
+			}
+			if err := ctx.db.DeleteChangeSet(ctx.User, selected); err != nil {
+				return err
+			}
+			ctx.Success("change set %s has been deleted", selected.Name())
+			ctx.SeeOther("/changesets")
+			return nil
+
+		case "preview":
+			ctx.db.SessionManager.Put(req.Context(), "preview_changeset", selected.ID())
+			ctx.Success("previewing change set %s", selected.Name())
+
+		case "unpreview":
+			ctx.db.SessionManager.Remove(req.Context(), "preview_changeset")
+
+		case "release":
+			if err := ctx.db.ReleaseChangeSet(ctx.User, selected); err != nil {
+				return err
+			}
+			ctx.Success("change set %s has been released", selected.Name())
+
+		case "remove":
+			if !canModifyChangeSet(ctx, selected) {
+				return errors.New("only the creator or an admin can remove items from the change set")
+			}
+			nodeID, err := strconv.Atoi(req.PostFormValue("node"))
+			if err != nil {
+				return err
+			}
+			if err := ctx.db.RemoveChangeSetItem(ctx.User, selected, nodeID); err != nil {
+				return err
+			}
+
+		case "rollback":
+			if err := ctx.db.RollbackChangeSet(ctx.User, selected); err != nil {
+				return err
+			}
+			ctx.Success("change set %s has been rolled back", selected.Name())
+		}
+
+		ctx.SeeOther("/changeset/%d", selected.ID())
+		return nil
+	}
+
+	return changeSetTmpl.Execute(w, &changeSetData{
+		context:  ctx,
+		Selected: selected,
+	})
+}
+
+// canModifyChangeSet returns whether the user is the creator of the change set or a root admin.
+func canModifyChangeSet(ctx *context, cs core.DBChangeSet) bool {
+	return cs.UserID() == ctx.User.ID() || ctx.IsRootAdmin()
+}
+
+func changeSetAdd(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	versionNo, _ := strconv.Atoi(params.ByName("version"))
+	if versionNo == 0 {
+		versionNo = selected.MaxVersionNo()
+	}
+
+	selectedVersion, err := selected.GetVersion(versionNo)
+	if err != nil {
+		return err
+	}
+
+	changeSetID, err := strconv.Atoi(req.PostFormValue("changeset"))
+	if err != nil {
+		return err
+	}
+
+	cs, err := ctx.db.GetChangeSet(changeSetID)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.db.AddToChangeSet(ctx.User, cs, selected, selectedVersion); err != nil {
+		return err
+	}
+
+	ctx.Success("version %d has been added to change set %s", versionNo, cs.Name())
+	ctx.SeeOther("/edit/%d%s", versionNo, selected.Location())
+	return nil
+}
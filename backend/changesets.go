@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var changeSetsTmpl = tmpl(`<h1>Change Sets</h1>
+
+	<p>A change set contains versions of several nodes, which are previewed and released together.</p>
+
+	<ul>
+		{{ range .GetAllChangeSets }}
+			<li>
+				<a href="changeset/{{ .ID }}">{{ .Name }}</a>
+				{{ if .TsReleased }}<span class="badge badge-success">released {{ FormatTs .TsReleased }}</span>{{ end }}
+				{{ if eq .ID $.PreviewID }}<span class="badge badge-info">previewing</span>{{ end }}
+			</li>
+		{{ end }}
+	</ul>
+
+	<h2>Create Change Set</h2>
+
+	<form method="post" class="form-inline">
+		{{ $.CSRFField }}
+		<div class="form-group">
+			<input class="form-control" name="name" placeholder="Name" maxlength="128">
+			<button type="submit" class="btn btn-primary mx-sm-3">Create change set</button>
+		</div>
+	</form>`)
+
+type changeSetsData struct {
+	*context
+}
+
+func (data *changeSetsData) GetAllChangeSets() ([]core.DBChangeSet, error) {
+	return data.db.GetAllChangeSets()
+}
+
+func (data *changeSetsData) PreviewID() int {
+	if cs := data.PreviewChangeSet(); cs != nil {
+		return cs.ID()
+	}
+	return 0
+}
+
+func changeSets(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if req.Method == http.MethodPost {
+
+		var name = req.PostFormValue("name")
+
+		if err := ctx.db.InsertChangeSet(ctx.User, name); err != nil {
+			return err
+		}
+
+		ctx.Success("change set %s has been created", name)
+		ctx.SeeOther("/changesets")
+		return nil
+	}
+
+	return changeSetsTmpl.Execute(w, &changeSetsData{
+		context: ctx,
+	})
+}
@@ -4,6 +4,7 @@ package backend
 
 import (
 	"fmt"
+	"html"
 	"html/template"
 	"math"
 	"net/http"
@@ -18,10 +19,13 @@ const SelectPerPage = 20
 
 var chooseTmpl = tmpl(`{{ Breadcrumbs .Selected false }}
 
+	<form method="post" action="bulk{{ .Selected.Location }}">
+		{{ $.CSRFField }}
 	<div class="table-responsive">
 		<table class="table">
 			<thead>
 				<tr>
+					<th></th>
 					<th>Status</th>
 					<th>URL</th>
 					<th>Class</th>
@@ -31,13 +35,14 @@ var chooseTmpl = tmpl(`{{ Breadcrumbs .Selected false }}
 			<tbody>
 				<tr>
 					<tr class="table-light">
-					<td>{{ .WorkflowIndicator .Selected.DBNode }}</td>
+					<td></td>
+					<td>{{ .WorkflowIndicator .Selected.DBNode }} {{ .LockIndicator .Selected }}</td>
 					<td>{{ .Selected.Slug }}</td>
 					<td>{{ .Selected.Class.Name }} ({{ .Selected.Class.Code }})</td>
 					<td>{{ .Selected.ID }}</td>
 				</tr>
 				<tr class="table-light">
-					<td colspan="4" style="border-top: 0; text-align: center;">
+					<td colspan="5" style="border-top: 0; text-align: center;">
 						<a class="btn btn-sm btn-primary" href="edit/0{{ .Selected.Location }}">Edit</a>
 						<a class="btn btn-sm btn-primary" href="class{{ .Selected.Location }}">Set class</a>
 						{{ if CanCreate .User .Selected }}
@@ -50,17 +55,19 @@ var chooseTmpl = tmpl(`{{ Breadcrumbs .Selected false }}
 						{{ end }}
 						{{ if CanAdmin .User .Selected }}
 							<a class="btn btn-sm btn-primary" href="access{{ .Selected.Location }}">Access rules</a>
+							<a class="btn btn-sm btn-primary" href="permissions{{ .Selected.Location }}">Who can access</a>
 						{{ end }}
 					</td>
 				</tr>
 
 				{{ if len .Children}}
 					<tr>
-						<th colspan="4">Children</th>
+						<th colspan="5">Children</th>
 					</tr>
 					{{ range .Children }}
 						<tr>
-							<td>{{ $.WorkflowIndicator . }} </td>
+							<td><input type="checkbox" name="nodes[]" value="{{ .Slug }}"></td>
+							<td>{{ $.WorkflowIndicator . }} {{ $.LockIndicator . }}</td>
 							<td>
 								<a class="btn btn-sm btn-secondary" href="choose/1{{ $.Selected.Location }}/{{ .Slug }}">{{ .Slug }}</a>
 							</td>
@@ -72,6 +79,64 @@ var chooseTmpl = tmpl(`{{ Breadcrumbs .Selected false }}
 			</tbody>
 		</table>
 	</div>
+	{{ if len .Children }}
+		<h2>Bulk operation on selected children</h2>
+		<div class="form-group row">
+			<div class="col-md-4">
+				<select class="form-control" name="action">
+					<option value="move">Move to</option>
+					<option value="delete">Delete</option>
+					<option value="class">Set class</option>
+					<option value="workflow">Assign workflow</option>
+					<option value="release">Release latest version</option>
+					<option value="add-rule">Add access rule</option>
+					<option value="remove-rule">Remove access rule</option>
+				</select>
+			</div>
+			<div class="col-md-4">
+				<button type="submit" class="btn btn-primary">Apply</button>
+			</div>
+		</div>
+		<div class="form-group row">
+			<label class="col-md-4 col-form-label">New location (move)</label>
+			<div class="col-md-8">
+				<input class="form-control" name="parentUrl" value="{{ .Selected.Location }}">
+			</div>
+		</div>
+		<div class="form-group row">
+			<label class="col-md-4 col-form-label">Class (set class)</label>
+			<div class="col-md-8">
+				<select class="form-control" name="class">
+					{{ .SelectChildClass }}
+				</select>
+			</div>
+		</div>
+		<div class="form-group row">
+			<label class="col-md-4 col-form-label">Workflow (assign workflow)</label>
+			<div class="col-md-8">
+				<select class="form-control" name="workflow">
+					{{ .WriteWorkflowOptions nil }}
+				</select>
+			</div>
+		</div>
+		<div class="form-group row">
+			<label class="col-md-4 col-form-label">Group and permission (access rules)</label>
+			<div class="col-md-4">
+				<select class="form-control" name="group">
+					<option value="0">All Users</option>
+					{{ range .AllGroups }}
+						<option value="{{ .ID }}">{{ .Name }}</option>
+					{{ end }}
+				</select>
+			</div>
+			<div class="col-md-4">
+				<select class="form-control" name="permission">
+					` + permissionOptions + `
+				</select>
+			</div>
+		</div>
+	{{ end }}
+	</form>
 	<nav>
 		<ul class="pagination justify-content-center">
 			{{ range .PageLinks }}
@@ -90,6 +155,10 @@ func (data *chooseData) Children() ([]*core.Node, error) {
 	return data.Selected.GetChildren(data.Request.User, data.Selected.Class().SelectOrder(), SelectPerPage, (data.page-1)*SelectPerPage)
 }
 
+func (data *chooseData) SelectChildClass() template.HTML {
+	return SelectChildClass(data.db.ClassRegistry, data.Selected.Class().FeaturedChildClasses(), "")
+}
+
 func (data *chooseData) PageLinks() []template.HTML {
 
 	pagesTotal := 1
@@ -110,17 +179,38 @@ func (data *chooseData) PageLinks() []template.HTML {
 	)
 }
 
-func (*chooseData) WorkflowIndicator(e core.DBNode) template.HTML {
+// workflowStatus returns "empty" if the node has no versions, "released" if its latest version has been released, and "pending" else.
+func workflowStatus(e core.DBNode) string {
+	switch {
+	case e.MaxVersionNo() == 0:
+		return "empty"
+	case e.MaxVersionNo() == e.MaxWGZeroVersionNo():
+		return "released"
+	default:
+		return "pending"
+	}
+}
 
-	if e.MaxVersionNo() == 0 {
+func (*chooseData) WorkflowIndicator(e core.DBNode) template.HTML {
+	switch workflowStatus(e) {
+	case "empty":
 		return template.HTML(`<span class="alert-inline alert-warning">?</span>`)
+	case "released":
+		return template.HTML(`<span class="alert-inline alert-success" title="The latest version has been released.">&#10003;</span>`)
+	default:
+		return template.HTML(`<span class="alert-inline alert-danger" title="The latest version has not been released yet.">&hellip;</span>`)
 	}
+}
 
-	if e.MaxVersionNo() == e.MaxWGZeroVersionNo() {
-		return template.HTML(`<span class="alert-inline alert-success" title="The latest version has been released.">&#10003;</span>`)
+// LockIndicator shows whether someone is currently editing the node.
+func (data *chooseData) LockIndicator(n *core.Node) template.HTML {
+
+	lock, err := data.db.GetLock(n)
+	if err != nil || lock == nil {
+		return template.HTML("")
 	}
 
-	return template.HTML(`<span class="alert-inline alert-danger" title="The latest version has not been released yet.">&hellip;</span>`)
+	return template.HTML(fmt.Sprintf(`<span class="alert-inline alert-info" title="Being edited by %s since %s">&#9998;</span>`, html.EscapeString(lock.User.Name()), FormatTs(lock.TsAcquired())))
 }
 
 func choose(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func comment(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	versionNo, _ := strconv.Atoi(params.ByName("version"))
+	if versionNo == 0 {
+		versionNo = selected.MaxVersionNo()
+	}
+
+	selectedVersion, err := selected.GetVersion(versionNo)
+	if err != nil {
+		return err
+	}
+
+	// every member of the workflow groups can comment
+
+	state, err := selected.ReleaseState(selectedVersion, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	if !state.CanEditNode() {
+		return ErrAuth
+	}
+
+	lineFrom, _ := strconv.Atoi(req.PostFormValue("line_from")) // empty is zero
+	lineTo, _ := strconv.Atoi(req.PostFormValue("line_to"))
+
+	if err := ctx.db.AddComment(ctx.User, selected, selectedVersion, lineFrom, lineTo, req.PostFormValue("text")); err != nil {
+		ctx.Danger(err)
+	}
+
+	ctx.SeeOther("/edit/%d%s#comments", versionNo, selected.Location())
+	return nil
+}
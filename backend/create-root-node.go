@@ -13,6 +13,7 @@ var createRootNodeTmpl = tmpl(`<h1>Create root node</h1>
 	<p>There is no root node yet.</p>
 
 	<form method="post">
+		{{ $.CSRFField }}
 		<input type="submit" class="btn btn-primary" name="create" value="Create root node">
 	</form>`)
 
@@ -15,6 +15,7 @@ var createTmpl = tmpl(`<h1>Create node below {{ .Selected.Location }}</h1>
 	</p>
 
 	<form method="post">
+		{{ $.CSRFField }}
 		<div class="form-row">
 			<div class="col-md-7">
 				<input class="form-control" name="slug" placeholder="Slug" value="{{ .Slug }}" onkeyup="javascript:normalizeSlug(this);">
@@ -58,7 +59,7 @@ func create(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 	// POST
 
 	if req.Method == http.MethodPost {
-		if err := ctx.db.AddChild(selected, req.PostFormValue("slug"), req.PostFormValue("class")); err == nil {
+		if err := ctx.db.AddChild(ctx.User, selected, req.PostFormValue("slug"), req.PostFormValue("class")); err == nil {
 			ctx.SeeOther("/choose/1%s", selected.Location())
 			return nil
 		} else {
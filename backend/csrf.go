@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wansing/perspective/util"
+)
+
+// csrfTokenKey is the session key of the synchronizer token which every backend POST request must contain.
+const csrfTokenKey = "csrf_token"
+
+var ErrCSRF = errors.New("the form has expired, please reload the page and try again")
+
+// CSRFToken returns the synchronizer token of the session. It is created on first use.
+func (ctx *context) CSRFToken() (string, error) {
+	var httpCtx = ctx.httpReq.Context()
+	var token = ctx.db.SessionManager.GetString(httpCtx, csrfTokenKey)
+	if token == "" {
+		var err error
+		if token, err = util.RandomString32(); err != nil {
+			return "", err
+		}
+		ctx.db.SessionManager.Put(httpCtx, csrfTokenKey, token)
+	}
+	return token, nil
+}
+
+// CSRFField returns a hidden input which contains the synchronizer token. It must be put into every form whose method is POST.
+func (ctx *context) CSRFField() (template.HTML, error) {
+	token, err := ctx.CSRFToken()
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, csrfTokenKey, template.HTMLEscapeString(token))), nil
+}
+
+// checkCSRF verifies the Origin or Referer header and the synchronizer token of a state-changing request.
+// The token is read from the form or from the X-CSRF-Token header. Requests which are authenticated with an API token are exempt, because browsers don't send the Authorization header on their own.
+func (ctx *context) checkCSRF(req *http.Request) error {
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	if ctx.APIToken() != nil {
+		return nil
+	}
+
+	if err := ctx.checkOrigin(req); err != nil {
+		return err
+	}
+
+	var want = ctx.db.SessionManager.GetString(req.Context(), csrfTokenKey)
+	var got = req.Header.Get("X-CSRF-Token")
+	if got == "" {
+		got = req.PostFormValue(csrfTokenKey)
+	}
+	if want == "" || subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
+
+// checkOrigin returns an error if the Origin header, or else the Referer header, refers to another host than the request or the public url.
+// If browsers send neither, the synchronizer token is considered sufficient.
+func (ctx *context) checkOrigin(req *http.Request) error {
+
+	var source = req.Header.Get("Origin")
+	if source == "" {
+		source = req.Header.Get("Referer")
+	}
+	if source == "" {
+		return nil
+	}
+
+	sourceURL, err := url.Parse(source)
+	if err != nil || sourceURL.Host == "" {
+		return errors.New("invalid origin") // includes "null"
+	}
+
+	if strings.EqualFold(sourceURL.Host, req.Host) {
+		return nil
+	}
+	if publicURL, err := url.Parse(ctx.db.PublicURL); err == nil && publicURL.Host != "" && strings.EqualFold(sourceURL.Host, publicURL.Host) {
+		return nil
+	}
+	return fmt.Errorf("cross-origin request from %s refused", sourceURL.Host)
+}
@@ -15,6 +15,7 @@ var deleteTmpl = tmpl(`<h1>Delete {{ .Selected.Location }}</h1>
 	</p>
 
 	<form method="post">
+		{{ $.CSRFField }}
 		<input type="submit" class="btn btn-primary" name="delete" value="Delete">
 	</form>`)
 
@@ -43,7 +44,7 @@ func del(w http.ResponseWriter, req *http.Request, ctx *context, params httprout
 	// delete
 
 	if req.PostFormValue("delete") != "" {
-		if err := ctx.db.DeleteNode(selected); err == nil {
+		if err := ctx.db.DeleteNode(ctx.User, selected); err == nil {
 			ctx.SeeOther("/choose/1%s", selected.Parent.Location())
 			return nil
 		} else {
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wansing/perspective/core"
@@ -26,13 +27,19 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 			&middot; Version: {{ .SelectedVersion.VersionNo }} ({{ FormatTs .SelectedVersion.TsChanged }})
 			&middot; Workflow group: <em><strong>{{ .State.WorkflowGroup.Name }}</strong></em>
 
+			{{ with .Approver }}
+				&middot; Approvals: {{ .Approvals }} of {{ .RequiredApprovals }}{{ if .HasApproved }} (including yours){{ end }}
+			{{ end }}
+
 			{{ with .State.ReleaseToGroup }}
 				&middot;
 				<form style="display: inline;" action="{{ $.Prefix }}release/{{ $.SelectedVersion.VersionNo }}{{ $.Selected.Location }}" method="post" enctype="multipart/form-data">
-					<button type="submit" class="btn btn-sm btn-secondary" id="release_button">Release</button>
+					{{ $.CSRFField }}
+					<button type="submit" class="btn btn-sm btn-secondary" id="release_button">{{ $.ReleaseLabel }}</button>
+					to <em>{{ .Name }}</em>
+					<input class="form-control form-control-sm d-inline-block" style="width: 12rem;" name="comment" placeholder="Comment (optional)" maxlength="1000">
 					<!-- might delete old versions -->
 				</form>
-				to <em>{{ .Name }}</em>
 			{{ end }}
 
 			{{ if and .State.RevokeToGroup .State.ReleaseToGroup }}
@@ -42,14 +49,54 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 			{{ with .State.RevokeToGroup }}
 				&middot;
 				<form style="display: inline;" action="{{ $.Prefix }}revoke/{{ $.SelectedVersion.VersionNo }}{{ $.Selected.Location }}" method="post" enctype="multipart/form-data">
+					{{ $.CSRFField }}
 					<button type="submit" class="btn btn-sm btn-secondary" id="revoke_button">Revoke</button>
+					to <em>{{ .Name }}</em>
+					<input class="form-control form-control-sm d-inline-block" style="width: 12rem;" name="comment" placeholder="Comment (optional)" maxlength="1000">
 					<!-- might delete old versions -->
 				</form>
-				to <em>{{ .Name }}</em>
 			{{ end }}
 		{{ end }}
 	</div>
 
+	{{ if ne .SelectedVersion.VersionNo 0 }}
+		{{ with .OpenChangeSets }}
+			<form class="form-inline mb-3" action="{{ $.Prefix }}changeset-add/{{ $.SelectedVersion.VersionNo }}{{ $.Selected.Location }}" method="post">
+				{{ $.CSRFField }}
+				<select class="form-control form-control-sm" name="changeset">
+					{{ range . }}
+						<option value="{{ .ID }}">{{ .Name }}</option>
+					{{ end }}
+				</select>
+				<button type="submit" class="btn btn-sm btn-secondary ml-2">Add version to change set</button>
+			</form>
+		{{ end }}
+	{{ end }}
+
+	{{ with .Lock }}
+		<div class="alert alert-warning">
+			This node is being edited by <em>{{ .User.Name }}</em> since {{ FormatTs .TsAcquired }}.
+			{{ if CanAdmin $.User $.Selected }}
+				<form style="display: inline;" action="{{ $.Prefix }}unlock{{ $.Selected.Location }}" method="post">
+					{{ $.CSRFField }}
+					<button type="submit" class="btn btn-sm btn-secondary">Break lock</button>
+				</form>
+			{{ end }}
+		</div>
+	{{ end }}
+
+	<div class="alert alert-warning" id="lock_conflict" style="display: none;"></div>
+
+	{{ if .HoldsLock }}
+		<div class="alert alert-info">
+			You are holding the edit lock of this node.
+			<form style="display: inline;" action="{{ $.Prefix }}unlock{{ $.Selected.Location }}" method="post">
+				{{ $.CSRFField }}
+				<button type="submit" class="btn btn-sm btn-secondary" id="unlock_button">Release lock</button>
+			</form>
+		</div>
+	{{ end }}
+
 	{{ if ne .SelectedVersion.VersionNo .Selected.MaxVersionNo }}
 		<div class="alert alert-warning">
 			You are editing an old version: {{ .SelectedVersion.VersionNo }} of {{ .Selected.MaxVersionNo }}.
@@ -60,6 +107,7 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 	{{ end }}
 
 	<form method="post" enctype="multipart/form-data">
+		{{ $.CSRFField }}
 
 		<div class="form-group">
 			<textarea class="form-control" id="content" name="content" onchange="changed();">{{ .Content }}</textarea>
@@ -102,6 +150,7 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 							<th>Time</th>
 							<th>Version note</th>
 							<th>Workflow group</th>
+							<th>Workflow history</th>
 							<th>Load</th>
 						</tr>
 					</thead>
@@ -156,6 +205,47 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 		</div>
 	</form>
 
+	{{ if ne .SelectedVersion.VersionNo 0 }}
+
+		{{ $Comments := .Comments }}
+
+		<h2 id="comments">{{ with $Comments }}{{ len . }} {{ end }}Review Comments on Version {{ .SelectedVersion.VersionNo }}</h2>
+
+		{{ range $Comments }}
+			<div class="card mb-2">
+				<div class="card-body py-2">
+					<div class="small text-muted">
+						{{ .Username }}, {{ FormatTs .Ts }}
+						{{ if .LineFrom }}&middot; line {{ .LineFrom }}{{ if ne .LineFrom .LineTo }}&ndash;{{ .LineTo }}{{ end }}{{ end }}
+					</div>
+					{{ with .Excerpt }}
+						<pre class="bg-light p-1 mb-1">{{ . }}</pre>
+					{{ end }}
+					<div style="white-space: pre-wrap;">{{ .Text }}</div>
+				</div>
+			</div>
+		{{ end }}
+
+		<form action="{{ $.Prefix }}comment/{{ .SelectedVersion.VersionNo }}{{ .Selected.Location }}" method="post">
+			{{ $.CSRFField }}
+			<div class="form-group row">
+				<div class="col-lg-8">
+					<textarea class="form-control" name="text" rows="2" placeholder="Comment" maxlength="10000"></textarea>
+				</div>
+				<div class="col-lg-1">
+					<input class="form-control" type="number" min="1" name="line_from" placeholder="Line" title="First line (optional)">
+				</div>
+				<div class="col-lg-1">
+					<input class="form-control" type="number" min="1" name="line_to" placeholder="to" title="Last line (optional)">
+				</div>
+				<div class="col-lg-2">
+					<button type="submit" class="btn btn-secondary form-control">Comment</button>
+				</div>
+			</div>
+		</form>
+
+	{{ end }}
+
 	{{ with .Info }}
 		<a class="collapse-link">
 			<h2>{{ $.Selected.Class.Name }}</h2>
@@ -244,8 +334,50 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 			if(editLatestLink) {
 				editLatestLink.onclick = function() { return confirm('Änderungern verwerfen?'); };
 			}
+
+			var unlockButton = document.getElementById('unlock_button');
+
+			if(unlockButton) {
+				unlockButton.onclick = function() { return confirm('Änderungern verwerfen?'); };
+			}
+
+			acquireLock();
+		}
+
+		// the edit lock is acquired when the content is changed, and kept alive until the page is left
+
+		var heartbeat = null;
+
+		function acquireLock() {
+
+			if(heartbeat) {
+				return;
+			}
+
+			function sendHeartbeat() {
+				fetch('lock{{ .Selected.Location }}', {method: 'POST', credentials: 'same-origin', headers: {'X-CSRF-Token': '{{ $.CSRFToken }}'}}).then(function(response) {
+					var conflict = document.getElementById('lock_conflict');
+					if(response.status == 409) {
+						response.text().then(function(text) {
+							conflict.textContent = text;
+							conflict.style.display = '';
+						});
+					} else {
+						conflict.style.display = 'none';
+					}
+				});
+			}
+
+			sendHeartbeat();
+			heartbeat = setInterval(sendHeartbeat, {{ .HeartbeatInterval }});
 		}
 
+		document.getElementById('content').addEventListener('input', changed);
+
+		{{ if .HoldsLock }}
+			acquireLock();
+		{{ end }}
+
 		function setTsNow(idString, value) {
 			var now = new Date();
 			var nowString = now.getDate() + '.' + (now.getMonth() + 1) + '.' + now.getFullYear() + ' '
@@ -262,18 +394,61 @@ var editTmpl = tmpl(`{{ Breadcrumbs .Selected true }}
 
 type editData struct {
 	*context
+	Lock            *core.Lock // held by another user, or nil
+	HoldsLock       bool       // whether the current user holds the edit lock
 	Selected        *core.Node
 	SelectedVersion core.DBVersion
-	State           *core.ReleaseState
+	State           core.ReleaseState
 	Content         string
 	VersionNote     string
 	WorkflowGroupID int // recommended workflow group if the content is edited
 }
 
+// Approver returns the release state if it requires multiple approvals, else nil.
+func (data *editData) Approver() core.Approver {
+	if approver, ok := data.State.(core.Approver); ok {
+		return approver
+	}
+	return nil
+}
+
+// ReleaseLabel returns the label of the release button. If the release state requires multiple approvals and this is not the last one, the version is just approved.
+func (data *editData) ReleaseLabel() string {
+	if approver := data.Approver(); approver != nil && approver.Approvals()+1 < approver.RequiredApprovals() {
+		return fmt.Sprintf("Approve (%d of %d)", approver.Approvals()+1, approver.RequiredApprovals())
+	}
+	return "Release"
+}
+
+// OpenChangeSets returns the change sets which have not been released yet.
+func (data *editData) OpenChangeSets() ([]core.DBChangeSet, error) {
+	all, err := data.db.GetAllChangeSets()
+	if err != nil {
+		return nil, err
+	}
+	var open = []core.DBChangeSet{}
+	for _, cs := range all {
+		if cs.TsReleased() == 0 {
+			open = append(open, cs)
+		}
+	}
+	return open, nil
+}
+
+// Comments returns the review comments of the selected version. Comments of earlier versions are carried along when a new version is saved.
+func (data *editData) Comments() ([]core.DBComment, error) {
+	return data.Selected.GetComments(data.SelectedVersion)
+}
+
 func (data *editData) GetFiles() ([]os.FileInfo, error) {
 	return data.Selected.Folder().Files()
 }
 
+// HeartbeatInterval returns the interval of edit lock heartbeats in milliseconds.
+func (data *editData) HeartbeatInterval() int64 {
+	return int64(core.LockTimeout/time.Millisecond) / 4
+}
+
 func (data *editData) Info() template.HTML {
 	return template.HTML(data.Selected.Class().Info())
 }
@@ -287,6 +462,11 @@ func (data *editData) VersionHistory() (template.HTML, error) {
 		return template.HTML(""), err
 	}
 
+	transitions, err := data.Selected.GetTransitions()
+	if err != nil {
+		return template.HTML(""), err
+	}
+
 	for _, v := range versions {
 
 		w.WriteString(`
@@ -308,19 +488,38 @@ func (data *editData) VersionHistory() (template.HTML, error) {
 			w.WriteString(html.EscapeString(grp.Name()))
 		}
 
-		w.WriteString(`
+		w.WriteString(`</td>
+			<td>`)
+
+		for _, t := range transitions[v.VersionNo()] {
+			w.WriteString(`<div class="small">` + FormatTs(t.Ts()) + ` ` + html.EscapeString(t.Username()) + `: ` + html.EscapeString(data.groupName(t.FromGroupID())) + ` &rarr; ` + html.EscapeString(data.groupName(t.ToGroupID())))
+			if t.Comment() != "" {
+				w.WriteString(` <em>(` + html.EscapeString(t.Comment()) + `)</em>`)
+			}
+			w.WriteString(`</div>`)
+		}
+
+		w.WriteString(`</td>
 			<td>
 				<a href="edit/` + strconv.Itoa(v.VersionNo()) + data.Selected.Location() + `">Open</a>
 			</td>
 		`)
 
-		w.WriteString(`</td>
+		w.WriteString(`
 			</tr>`)
 	}
 
 	return template.HTML(w.String()), nil
 }
 
+// groupName returns the name of a group, or a placeholder if the group has been deleted.
+func (data *editData) groupName(groupID int) string {
+	if grp, err := data.db.GetGroupOrReaders(groupID); err == nil {
+		return grp.Name()
+	}
+	return fmt.Sprintf("(group %d)", groupID)
+}
+
 func edit(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
 
 	selected, err := ctx.Open(params.ByName("path"))
@@ -350,6 +549,25 @@ func edit(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 		return ErrAuth
 	}
 
+	// opening the edit page does not acquire the edit lock, the page acquires it when the content is changed
+	var lock *core.Lock
+	var holdsLock bool
+	if req.Method == http.MethodPost {
+		// keep the lock if the user input is shown again, it is released below if the content has been saved
+		if lock, err = ctx.db.AcquireLock(selected, ctx.User); err != nil {
+			return err
+		}
+		holdsLock = lock == nil
+	} else {
+		if lock, err = ctx.db.GetLock(selected); err != nil {
+			return err
+		}
+		if lock != nil && lock.UserID() == ctx.User.ID() {
+			lock = nil
+			holdsLock = true
+		}
+	}
+
 	var content = selectedVersion.Content()
 
 	var versionNote string
@@ -379,7 +597,10 @@ func edit(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 		var uploadFiles = req.MultipartForm.File["upload[]"]
 		defer req.MultipartForm.RemoveAll()
 
-		if err = doEdit(ctx, selected, selectedVersion, content, versionNote, ctx.User.Name(), workflowGroupID, deleteFiles, uploadFiles); err == nil {
+		if err = doEdit(ctx, selected, selectedVersion, content, versionNote, workflowGroupID, deleteFiles, uploadFiles); err == nil {
+			if err = ctx.db.ReleaseLock(selected, ctx.User); err != nil {
+				return err
+			}
 			ctx.SeeOther("/edit/%d%s", 0 /* evaluates to max version number, might be racey */, selected.Location())
 			return nil
 		} else {
@@ -390,6 +611,8 @@ func edit(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 
 	return editTmpl.Execute(w, &editData{
 		context:         ctx,
+		Lock:            lock,
+		HoldsLock:       holdsLock,
 		Selected:        selected,
 		SelectedVersion: selectedVersion,
 		State:           state,
@@ -399,7 +622,7 @@ func edit(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 	})
 }
 
-func doEdit(ctx *context, selected *core.Node, selectedVersion core.DBVersion, content, versionNote, username string, workflowGroupID int, deleteFiles []string, uploadFiles []*multipart.FileHeader) error {
+func doEdit(ctx *context, selected *core.Node, selectedVersion core.DBVersion, content, versionNote string, workflowGroupID int, deleteFiles []string, uploadFiles []*multipart.FileHeader) error {
 
 	// delete files
 
@@ -428,7 +651,7 @@ func doEdit(ctx *context, selected *core.Node, selectedVersion core.DBVersion, c
 	// edit content (versioned)
 
 	if content != selectedVersion.Content() {
-		if err := ctx.db.Edit(selected, selectedVersion, content, versionNote, username, workflowGroupID); err != nil {
+		if err := ctx.db.Edit(ctx.User, selected, selectedVersion, content, versionNote, workflowGroupID); err != nil {
 			return err
 		}
 	}
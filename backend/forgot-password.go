@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var forgotPasswordTmpl = tmpl(`<h1>Forgot Password</h1>
+	<form method="post" style="max-width: 20rem; margin: auto;">
+		{{ $.CSRFField }}
+		<p>Enter your email address. If an account exists, we'll send you a link for resetting your password.</p>
+		<div class="form-group">
+			<label>E-Mail</label>
+			<input type="text" class="form-control" name="email" required autofocus>
+		</div>
+		<div class="form-group">
+			<button type="submit" class="btn btn-primary">Send link</button>
+			<a class="btn btn-secondary" href="login">Cancel</a>
+		</div>
+	</form>`)
+
+func forgotPassword(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if req.Method == http.MethodPost {
+		if err := ctx.db.RequestPasswordReset(req.PostFormValue("email")); err != nil {
+			ctx.Danger(err)
+			ctx.SeeOther("/forgot-password")
+			return nil
+		}
+		ctx.Success("If the account exists, an email has been sent.")
+		ctx.SeeOther("/login")
+		return nil
+	}
+
+	return forgotPasswordTmpl.Execute(w, ctx)
+}
@@ -2,8 +2,10 @@ package backend
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wansing/perspective/core"
@@ -13,52 +15,245 @@ var groupTmpl = tmpl(`<h1>Group &raquo;{{ .Selected.Name }}&laquo;</h1>
 
 	<h2>Members</h2>
 
-	<ul>
-		{{ range .Members }}
-			<li>{{ UserLink . }}</li>
-		{{ else }}
-			No members.
+	{{ $validities := .Validities }}
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<ul>
+			{{ range .DirectMembers }}
+				<li>
+					{{ if $.RootAdmin }}{{ UserLink . }}{{ else }}{{ .Name }}{{ end }}
+					{{ with index $validities .ID }}<small class="text-muted">{{ . }}</small>{{ end }}
+					<button type="submit" class="btn btn-sm btn-link" name="remove_member" value="{{ .ID }}">remove</button>
+				</li>
+			{{ else }}
+				No members.
+			{{ end }}
+			{{ range .InactiveMembers }}
+				<li class="text-muted" title="This membership does not apply at the moment.">
+					{{ if $.RootAdmin }}{{ UserLink .User }}{{ else }}{{ .User.Name }}{{ end }}
+					<small>{{ .Validity }}</small>
+					<button type="submit" class="btn btn-sm btn-link" name="remove_member" value="{{ .User.ID }}">remove</button>
+				</li>
+			{{ end }}
+		</ul>
+	</form>
+
+	{{ with .IndirectMembers }}
+		<h2>Members via subgroups</h2>
+		<ul>
+			{{ range . }}
+				<li>{{ if $.RootAdmin }}{{ UserLink . }}{{ else }}{{ .Name }}{{ end }}</li>
+			{{ end }}
+		</ul>
+	{{ end }}
+
+	{{ if .RootAdmin }}
+
+		<h2>Subgroups</h2>
+
+		<p>Members of a subgroup are members of this group too.</p>
+
+		<form method="post">
+			{{ $.CSRFField }}
+			<ul>
+				{{ range .Subgroups }}
+					<li>
+						{{ GroupLink . }}
+						<button type="submit" class="btn btn-sm btn-link" name="remove_subgroup" value="{{ .ID }}">remove</button>
+					</li>
+				{{ else }}
+					No subgroups.
+				{{ end }}
+			</ul>
+		</form>
+
+		<form method="post" class="form-inline mb-3">
+			{{ $.CSRFField }}
+			<div class="form-group">
+				<select class="form-control" name="add_subgroup">
+					{{ range .AllGroups }}
+						{{ if ne .ID $.Selected.ID }}
+							<option value="{{ .ID }}">{{ .Name }}</option>
+						{{ end }}
+					{{ end }}
+				</select>
+				<button type="submit" class="btn btn-primary mx-sm-3">Add subgroup</button>
+			</div>
+		</form>
+
+		{{ with .Supergroups }}
+			<h2>Contained in</h2>
+			<ul>
+				{{ range . }}
+					<li>{{ GroupLink . }}</li>
+				{{ end }}
+			</ul>
 		{{ end }}
-	</ul>
+
+		<h2>Two-Factor Authentication</h2>
+
+		<form method="post" class="mb-3">
+			{{ $.CSRFField }}
+			<input type="hidden" name="set_totp_required" value="1">
+			<div class="form-check mb-2">
+				<input class="form-check-input" type="checkbox" name="totp_required" id="totp_required" {{ if .TOTPRequired }}checked{{ end }}>
+				<label class="form-check-label" for="totp_required">Members (including members of subgroups) must use two-factor authentication for the backend</label>
+			</div>
+			<button type="submit" class="btn btn-primary">Save</button>
+		</form>
+
+		<h2>Managers</h2>
+
+		<p>Managers can add and remove members of this group and invite new users to it. They don't get any other administrative permissions.</p>
+
+		<form method="post">
+			{{ $.CSRFField }}
+			<ul>
+				{{ range .Managers }}
+					<li>
+						{{ UserLink . }}
+						<button type="submit" class="btn btn-sm btn-link" name="remove_manager" value="{{ .ID }}">remove</button>
+					</li>
+				{{ else }}
+					No managers.
+				{{ end }}
+			</ul>
+		</form>
+
+		<form method="post" class="form-inline mb-3">
+			{{ $.CSRFField }}
+			<div class="form-group">
+				<input class="form-control" name="add_manager" placeholder="Email address or user ID">
+				<button type="submit" class="btn btn-primary mx-sm-3">Add manager</button>
+			</div>
+		</form>
+
+	{{ end }}
 
 	<h2>Add member</h2>
 
-	<form method="post" class="form-inline">
-		<div class="form-group">
-			<input type="number" class="form-control" name="user_id" placeholder="User ID">
-			<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Add user to group</button>
-		</div>
-	</form>`)
+	{{ if and (not .RootAdmin) .GrantsAdmin }}
+		<p>This group grants admin permission, so only root admins can add members.</p>
+	{{ else }}
+		<form method="post">
+			{{ $.CSRFField }}
+			<div class="form-inline">
+				<input class="form-control" name="member" placeholder="Email address or user ID">
+				<input type="datetime-local" class="form-control ml-sm-2" name="valid_from" title="valid from (optional)">
+				<input type="datetime-local" class="form-control ml-sm-2" name="valid_until" title="valid until (optional)">
+				<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Add user to group</button>
+			</div>
+			{{ if and .MailEnabled .UsersWriteable }}
+				<div class="form-check mt-2">
+					<input class="form-check-input" type="checkbox" name="invite" id="invite">
+					<label class="form-check-label" for="invite">Invite the user by email if there is no account yet</label>
+				</div>
+			{{ end }}
+		</form>
+	{{ end }}`)
 
 type groupData struct {
 	*context
-	Selected core.DBGroup
+	Selected  core.DBGroup
+	RootAdmin bool // group managers see the members only
+}
+
+func (data *groupData) DirectMembers() ([]core.DBUser, error) {
+	memberIDs, err := data.Selected.DirectMembers()
+	if err != nil {
+		return nil, err
+	}
+	return data.users(memberIDs)
 }
 
-func (data *groupData) Members() ([]core.DBUser, error) {
+// IndirectMembers returns the users who are members because of a subgroup only.
+func (data *groupData) IndirectMembers() ([]core.DBUser, error) {
+
+	memberIDs, err := data.Selected.Members()
+	if err != nil {
+		return nil, err
+	}
 
-	var memberIDs, err = data.Selected.Members()
+	directIDs, err := data.Selected.DirectMembers()
 	if err != nil {
 		return nil, err
 	}
 
-	var members = []core.DBUser{}
-	for memberID := range memberIDs { // map: group id -> interface{}
-		member, err := data.db.GetUser(memberID)
+	for directID := range directIDs {
+		delete(memberIDs, directID)
+	}
+
+	return data.users(memberIDs)
+}
+
+func (data *groupData) Validities() (map[int]core.Validity, error) {
+	return data.db.GetTimedMemberships(data.Selected)
+}
+
+type timedMember struct {
+	User     core.DBUser
+	Validity core.Validity
+}
+
+// InactiveMembers returns the direct memberships whose validity does not include the current time.
+func (data *groupData) InactiveMembers() ([]timedMember, error) {
+
+	validities, err := data.db.GetTimedMemberships(data.Selected)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []timedMember{}
+
+	for userID, validity := range validities {
+		if validity.ActiveNow() {
+			continue
+		}
+		user, err := data.db.GetUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, timedMember{user, validity})
+	}
+
+	return result, nil
+}
+
+func (data *groupData) users(ids map[int]interface{}) ([]core.DBUser, error) {
+	var users = []core.DBUser{}
+	for id := range ids { // map: user id -> interface{}
+		user, err := data.db.GetUser(id)
 		if err != nil {
 			return nil, err
 		}
-		members = append(members, member)
+		users = append(users, user)
 	}
+	return users, nil
+}
 
-	return members, nil
+func (data *groupData) TOTPRequired() (bool, error) {
+	required, err := data.db.GetTOTPRequiredGroups()
+	return required[data.Selected.ID()], err
 }
 
-func group(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+func (data *groupData) GrantsAdmin() (bool, error) {
+	return data.db.GrantsAdmin(data.Selected)
+}
 
-	if !ctx.IsRootAdmin() {
-		return errors.New("unauthorized")
-	}
+func (data *groupData) Managers() ([]core.DBUser, error) {
+	return data.db.GetGroupManagers(data.Selected)
+}
+
+func (data *groupData) Subgroups() ([]core.DBGroup, error) {
+	return data.db.GetSubgroups(data.Selected)
+}
+
+func (data *groupData) Supergroups() ([]core.DBGroup, error) {
+	return data.db.GetSupergroups(data.Selected)
+}
+
+func group(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
 
 	selectedID, err := strconv.Atoi(params.ByName("id"))
 	if err != nil {
@@ -70,33 +265,195 @@ func group(w http.ResponseWriter, req *http.Request, ctx *context, params httpro
 		return err
 	}
 
+	var rootAdmin = ctx.IsRootAdmin()
+	if !rootAdmin {
+		canManage, err := ctx.CanManageGroup(selected)
+		if err != nil {
+			return err
+		}
+		if !canManage {
+			return errors.New("unauthorized")
+		}
+	}
+
 	if req.Method == http.MethodPost {
 
-		if addUserID := req.PostFormValue("user_id"); addUserID != "" {
+		if member := strings.TrimSpace(req.PostFormValue("member")); member != "" {
 
-			userID, err := strconv.Atoi(addUserID)
+			// managers must not be able to make anyone an administrator
+			if !rootAdmin {
+				grantsAdmin, err := ctx.db.GrantsAdmin(selected)
+				if err != nil {
+					return err
+				}
+				if grantsAdmin {
+					ctx.Danger(errors.New("this group grants admin permission, so only root admins can add members"))
+					ctx.SeeOther("/group/%d", selected.ID())
+					return nil
+				}
+			}
+
+			validity, err := core.ParseValidity(req.PostFormValue("valid_from"), req.PostFormValue("valid_until"))
 			if err != nil {
 				ctx.Danger(err)
 				return nil
 			}
 
+			var invited bool
+			user, err := userByNameOrID(ctx, member)
+			if err != nil && req.PostFormValue("invite") != "" && strings.Contains(member, "@") {
+				if user, err = ctx.db.InviteUser(ctx.User, member); err != nil {
+					return err
+				}
+				invited = true
+			}
+			if err != nil {
+				ctx.Danger(fmt.Errorf("user %s not found", member))
+				ctx.SeeOther("/group/%d", selected.ID())
+				return nil
+			}
+
+			if err = ctx.db.Join(ctx.User, selected, user, validity); err != nil {
+				return err
+			}
+
+			if invited {
+				ctx.Success("user %s has been invited and added to group %s", user.Name(), selected.Name())
+			} else {
+				ctx.Success("user %s has been added to group %s", user.Name(), selected.Name())
+			}
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		if removeMemberID := req.PostFormValue("remove_member"); removeMemberID != "" {
+
+			userID, err := strconv.Atoi(removeMemberID)
+			if err != nil {
+				return err
+			}
+
+			user, err := ctx.db.GetUser(userID)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.db.Leave(ctx.User, selected, user); err != nil {
+				return err
+			}
+
+			ctx.Success("user %s has been removed from group %s", user.Name(), selected.Name())
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		// everything else is for root admins only
+
+		if !rootAdmin {
+			return errors.New("unauthorized")
+		}
+
+		if manager := strings.TrimSpace(req.PostFormValue("add_manager")); manager != "" {
+
+			user, err := userByNameOrID(ctx, manager)
+			if err != nil {
+				ctx.Danger(fmt.Errorf("user %s not found", manager))
+				ctx.SeeOther("/group/%d", selected.ID())
+				return nil
+			}
+
+			if err = ctx.db.AddGroupManager(ctx.User, selected, user); err != nil {
+				return err
+			}
+
+			ctx.Success("user %s manages group %s now", user.Name(), selected.Name())
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		if removeManagerID := req.PostFormValue("remove_manager"); removeManagerID != "" {
+
+			userID, err := strconv.Atoi(removeManagerID)
+			if err != nil {
+				return err
+			}
+
 			user, err := ctx.db.GetUser(userID)
 			if err != nil {
 				return err
 			}
 
-			if err = ctx.db.GroupDB.Join(selected, user); err != nil {
+			if err = ctx.db.RemoveGroupManager(ctx.User, selected, user); err != nil {
 				return err
 			}
 
-			ctx.Success("user %s has been added to group %s", user.Name(), selected.Name())
+			ctx.Success("user %s no longer manages group %s", user.Name(), selected.Name())
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		if req.PostFormValue("set_totp_required") != "" {
+			var required = req.PostFormValue("totp_required") != ""
+			if err := ctx.db.SetTOTPRequired(ctx.User, selected, required); err != nil {
+				return err
+			}
+			ctx.Success("settings of group %s have been saved", selected.Name())
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		if addSubgroupID := req.PostFormValue("add_subgroup"); addSubgroupID != "" {
+
+			sub, err := subgroupByID(ctx, addSubgroupID)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.db.AddSubgroup(ctx.User, selected, sub); err != nil {
+				ctx.Danger(err)
+			} else {
+				ctx.Success("group %s has been added to group %s", sub.Name(), selected.Name())
+			}
+			ctx.SeeOther("/group/%d", selected.ID())
+			return nil
+		}
+
+		if removeSubgroupID := req.PostFormValue("remove_subgroup"); removeSubgroupID != "" {
+
+			sub, err := subgroupByID(ctx, removeSubgroupID)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.db.RemoveSubgroup(ctx.User, selected, sub); err != nil {
+				return err
+			}
+
+			ctx.Success("group %s has been removed from group %s", sub.Name(), selected.Name())
 			ctx.SeeOther("/group/%d", selected.ID())
 			return nil
 		}
 	}
 
 	return groupTmpl.Execute(w, &groupData{
-		context:  ctx,
-		Selected: selected,
+		context:   ctx,
+		Selected:  selected,
+		RootAdmin: rootAdmin,
 	})
 }
+
+func subgroupByID(ctx *context, idStr string) (core.DBGroup, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.db.GetGroup(id)
+}
+
+// userByNameOrID returns the user with the given id if s is a number, else the user with the given name (email address).
+func userByNameOrID(ctx *context, s string) (core.DBUser, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return ctx.db.GetUser(id)
+	}
+	return ctx.db.GetUserByName(s)
+}
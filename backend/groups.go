@@ -17,38 +17,59 @@ var groupsTmpl = tmpl(`<h1>Groups</h1>
 		{{ end }}
 	</ul>
 
-	<h2>Create Group</h2>
+	{{ if .RootAdmin }}
 
-	<form method="post" class="form-inline">
-		<div class="form-group">
-			<input class="form-control" name="group_name" placeholder="Group name">
-			<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Create group</button>
-		</div>
-	</form>`)
+		<h2>Create Group</h2>
+
+		<form method="post" class="form-inline">
+			{{ $.CSRFField }}
+			<div class="form-group">
+				<input class="form-control" name="group_name" placeholder="Group name">
+				<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Create group</button>
+			</div>
+		</form>
+
+	{{ end }}`)
 
 type groupsData struct {
 	*context
+	RootAdmin bool
 }
 
+// Groups returns all groups to root admins, and the managed groups to group managers.
 func (data *groupsData) Groups() ([]core.DBGroup, error) {
-	return data.db.GetAllGroups(10000, 0) // assuming there are not more than 10k groups
+	if data.RootAdmin {
+		return data.db.GetAllGroups(10000, 0) // assuming there are not more than 10k groups
+	}
+	return data.ManagedGroups()
 }
 
 func groups(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
 
-	if !ctx.IsRootAdmin() {
-		return errors.New("unauthorized")
+	var rootAdmin = ctx.IsRootAdmin()
+	if !rootAdmin {
+		managesGroups, err := ctx.ManagesGroups()
+		if err != nil {
+			return err
+		}
+		if !managesGroups {
+			return errors.New("unauthorized")
+		}
 	}
 
 	if req.Method == http.MethodPost {
 
+		if !rootAdmin {
+			return errors.New("unauthorized")
+		}
+
 		newGroupName := strings.TrimSpace(req.PostFormValue("group_name"))
 
 		if newGroupName == "" {
 			return errors.New("missing name")
 		}
 
-		if err := ctx.db.InsertGroup(newGroupName); err != nil {
+		if err := ctx.db.InsertGroup(ctx.User, newGroupName); err != nil {
 			return err
 		}
 
@@ -58,6 +79,7 @@ func groups(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 	}
 
 	return groupsTmpl.Execute(w, &groupsData{
-		context: ctx,
+		context:   ctx,
+		RootAdmin: rootAdmin,
 	})
 }
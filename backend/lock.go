@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+// lock acquires or refreshes the edit lock of a node. It is called periodically by the edit page after the content has been changed.
+// If another user holds the lock, it responds with 409 Conflict and the holder.
+func lock(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	// CanEditNode does not depend on the version
+	state, err := selected.ReleaseState(core.NoVersion{}, ctx.User)
+	if err != nil {
+		return err
+	}
+	if !state.CanEditNode() {
+		return ErrAuth
+	}
+
+	lock, err := ctx.db.AcquireLock(selected, ctx.User)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		http.Error(w, fmt.Sprintf("This node is being edited by %s since %s.", lock.User.Name(), FormatTs(lock.TsAcquired())), http.StatusConflict)
+		return nil
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// unlock releases the edit lock of a node. Admins of the node can break locks of other users.
+func unlock(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	lock, err := ctx.db.GetLock(selected)
+	if err != nil {
+		return err
+	}
+
+	if lock != nil && lock.UserID() != ctx.User.ID() {
+		if err := selected.RequirePermission(core.Admin, ctx.User); err != nil {
+			return err
+		}
+		if err := ctx.db.BreakLock(selected); err != nil {
+			return err
+		}
+		ctx.Success("lock of %s has been broken", lock.User.Name())
+	} else {
+		if err := ctx.db.ReleaseLock(selected, ctx.User); err != nil {
+			return err
+		}
+		ctx.Success("your edit lock has been released")
+	}
+
+	ctx.SeeOther("/edit/0%s", selected.Location())
+	return nil
+}
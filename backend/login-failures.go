@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var loginFailuresTmpl = tmpl(`<h1>Failed Logins</h1>
+
+	<p>Logins are delayed after some failed attempts, and locked for some time after many failed attempts. Failures are counted per account and per IP address.</p>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Account or IP address</th>
+					<th>Failures</th>
+					<th>Last failure</th>
+					<th>Blocked until</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Failures }}
+					<tr>
+						<td>{{ .Key }}</td>
+						<td>{{ .Count }}</td>
+						<td>{{ FormatTs .LastTs }}</td>
+						<td>
+							{{ if $.Blocked . }}
+								{{ if .Locked }}<span class="badge badge-danger">locked</span>{{ end }}
+								{{ FormatTs (.BlockedUntil.Unix) }}
+							{{ end }}
+						</td>
+						<td><button type="submit" class="btn btn-sm btn-secondary" name="unlock" value="{{ .Key }}">Unlock</button></td>
+					</tr>
+				{{ else }}
+					<tr>
+						<td colspan="5">No failed logins.</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</form>`)
+
+type loginFailuresData struct {
+	*context
+}
+
+func (data *loginFailuresData) Failures() ([]core.LoginFailure, error) {
+	return data.db.GetLoginFailures()
+}
+
+func (data *loginFailuresData) Blocked(lf core.LoginFailure) bool {
+	return lf.BlockedUntil().After(time.Now())
+}
+
+func loginFailures(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.IsRootAdmin() {
+		return errors.New("unauthorized")
+	}
+
+	if req.Method == http.MethodPost {
+		var key = req.PostFormValue("unlock")
+		if err := ctx.db.UnlockLogin(ctx.User, key); err != nil {
+			return err
+		}
+		ctx.Success("%s has been unlocked", key)
+		ctx.SeeOther("/login-failures")
+		return nil
+	}
+
+	return loginFailuresTmpl.Execute(w, &loginFailuresData{
+		context: ctx,
+	})
+}
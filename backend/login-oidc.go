@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// loginOIDC redirects to the OpenID Connect provider. It is requested by the login form, so the "remember me" checkbox is considered.
+func loginOIDC(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if ctx.LoggedIn() {
+		ctx.SeeOther("/")
+		return nil
+	}
+
+	authURL, err := ctx.StartOIDCLogin(req.PostFormValue("remember") != "")
+	if err != nil {
+		return err
+	}
+
+	ctx.SeeOther("%s", authURL)
+	return nil
+}
+
+// loginOIDCCallback is where the OpenID Connect provider redirects the user to.
+func loginOIDCCallback(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	var query = req.URL.Query()
+
+	if errCode := query.Get("error"); errCode != "" {
+		ctx.Danger(errors.New("single sign-on failed: " + errCode + " " + query.Get("error_description")))
+		ctx.SeeOther("/login")
+		return nil
+	}
+
+	if err := ctx.LoginOIDC(query.Get("state"), query.Get("code")); err != nil {
+		ctx.Danger(err)
+		ctx.SeeOther("/login")
+		return nil
+	}
+
+	ctx.SeeOther("/")
+	return nil
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var loginTOTPTmpl = tmpl(`<h1>Login</h1>
+	<form method="post" style="max-width: 20rem; margin: auto;">
+		{{ $.CSRFField }}
+		<div class="form-group">
+			<label>Code from your authenticator app, or a recovery code</label>
+			<input type="text" class="form-control" name="code" autocomplete="one-time-code" required autofocus>
+		</div>
+		<div class="form-group">
+			<button type="submit" class="btn btn-primary" name="login">Login</button>
+			<a class="btn btn-secondary" href="login">Cancel</a>
+		</div>
+	</form>`)
+
+// loginTOTP is the second step of the login, if the user has enabled TOTP.
+func loginTOTP(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.PendingLogin() {
+		ctx.SeeOther("/login")
+		return nil
+	}
+
+	if req.Method == http.MethodPost {
+		if err := ctx.LoginSecondFactor(req.PostFormValue("code")); err != nil {
+			ctx.Danger(err)
+			ctx.SeeOther("/login-totp") // redirects to /login if the pending login has been cancelled
+		} else {
+			ctx.SeeOther("/")
+		}
+		return nil
+	}
+
+	return loginTOTPTmpl.Execute(w, ctx)
+}
@@ -5,12 +5,14 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
 )
 
 var ErrLogin = errors.New("wrong username or password")
 
 var loginTmpl = tmpl(`<h1>Login</h1>
 	<form method="post" style="max-width: 20rem; margin: auto;">
+		{{ $.CSRFField }}
 		<div class="form-group">
 			<label>E-Mail</label>
 			<input type="text" class="form-control" name="email" value="{{ .Email }}" required autofocus>
@@ -19,9 +21,22 @@ var loginTmpl = tmpl(`<h1>Login</h1>
 			<label>Password</label>
 			<input type="password" class="form-control" name="password" required>
 		</div>
+		<div class="form-group form-check">
+			<input type="checkbox" class="form-check-input" id="remember" name="remember" value="1">
+			<label class="form-check-label" for="remember">Remember me on this device</label>
+		</div>
 		<div class="form-group">
 			<button type="submit" class="btn btn-primary" name="login">Login</button>
+			{{ if and .MailEnabled .UsersWriteable }}
+				<a class="btn btn-link" href="forgot-password">Forgot password?</a>
+			{{ end }}
 		</div>
+		{{ if .OIDCEnabled }}
+			<hr>
+			<div class="form-group">
+				<button type="submit" class="btn btn-secondary btn-block" formaction="login-oidc" formnovalidate>Login with single sign-on</button>
+			</div>
+		{{ end }}
 	</form>`)
 
 type loginData struct {
@@ -38,10 +53,15 @@ func login(w http.ResponseWriter, req *http.Request, ctx *context, params httpro
 		email = req.PostFormValue("email")
 		password := req.PostFormValue("password")
 
-		err := ctx.Login(email, password)
+		err := ctx.Login(email, password, req.PostFormValue("remember") != "")
 		if err == nil {
 			ctx.SeeOther("/")
 			return nil
+		} else if errors.Is(err, core.ErrSecondFactor) {
+			ctx.SeeOther("/login-totp")
+			return nil
+		} else if errors.As(err, &core.ErrLoginThrottled{}) {
+			ctx.Danger(err)
 		} else {
 			ctx.Danger(ErrLogin)
 			// keep POST data for email field
@@ -16,6 +16,7 @@ var moveTmpl = tmpl(`<h1>Move {{ .Selected.Location }}</h1>
 	</p>
 
 	<form method="post">
+		{{ $.CSRFField }}
 		<div class="form-group row">
 			<label class="col-sm-2 col-form-label">Current location</label>
 			<div class="col-sm-10">
@@ -82,7 +83,7 @@ func move(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 			return err
 		}
 
-		if err = ctx.db.SetParent(selected, newParent); err == nil {
+		if err = ctx.db.SetParent(ctx.User, selected, newParent); err == nil {
 			ctx.SeeOther("/choose/1%s", selected.Location())
 			return nil
 		} else {
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var permissionsTmpl = tmpl(`<h1>Who can access {{ .Selected.Location }}</h1>
+
+	<p>
+		<a class="btn btn-secondary" href="choose/1{{ .Selected.Location }}">Back</a>
+		<a class="btn btn-secondary" href="access{{ .Selected.Location }}">Access rules</a>
+	</p>
+
+	<h2>Groups</h2>
+
+	<table class="table table-sm">
+		<thead>
+			<tr>
+				<th>Group</th>
+				<th>Permission</th>
+				<th>Edit</th>
+				<th>Granted by</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{ range .GroupPermissions }}
+				<tr>
+					<td>{{ GroupLink .Group }}</td>
+					<td>{{ .Permission.String }}</td>
+					<td>{{ if .CanEdit }}yes{{ end }}</td>
+					<td>
+						{{ range .Grants }}
+							<div>{{ GrantLink . }}</div>
+						{{ end }}
+					</td>
+				</tr>
+			{{ end }}
+		</tbody>
+	</table>
+
+	<h2>Users</h2>
+
+	<p>Only members of the groups above are listed. All other logged-in users have the permission of "other users".</p>
+
+	<table class="table table-sm">
+		<thead>
+			<tr>
+				<th>User</th>
+				<th>Permission</th>
+				<th>Edit</th>
+				<th>Granted by</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{ range .UserPermissions }}
+				<tr {{ if eq .Permission.String "none" }}class="text-muted"{{ end }}>
+					<td>{{ if gt .User.ID 0 }}{{ UserLink .User }}{{ else }}{{ .User.Name }}{{ end }}</td>
+					<td>{{ .Permission.String }}</td>
+					<td>{{ if .CanEdit }}yes{{ end }}</td>
+					<td>
+						{{ range .Grants }}
+							<div>{{ GrantLink . }}</div>
+						{{ end }}
+					</td>
+				</tr>
+			{{ end }}
+		</tbody>
+	</table>`)
+
+type permissionsData struct {
+	*context
+	Selected *core.Node
+}
+
+func (data *permissionsData) GroupPermissions() ([]core.GroupPermission, error) {
+	return data.db.GroupPermissions(data.Selected)
+}
+
+func (data *permissionsData) UserPermissions() ([]core.UserPermission, error) {
+	return data.db.UserPermissions(data.Selected)
+}
+
+// permissions shows the effective permissions of all groups and users on a node.
+func permissions(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	if err = selected.RequirePermission(core.Admin, ctx.User); err != nil {
+		return err
+	}
+
+	return permissionsTmpl.Execute(w, &permissionsData{
+		context:  ctx,
+		Selected: selected,
+	})
+}
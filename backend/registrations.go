@@ -0,0 +1,267 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var registrationsTmpl = tmpl(`<h1>Registrations</h1>
+
+	<p>Visitors sign up on nodes of the class "registration". After they have confirmed their email address, they are in the pending group until they are approved here.</p>
+
+	<h2>Registration forms</h2>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Node</th>
+					<th>Pending group</th>
+					<th>Member group</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Configs }}
+					<tr>
+						<td>{{ if .Path }}<a href="choose/1{{ .Path }}">{{ .Path }}</a>{{ else }}node {{ .NodeID }} (deleted){{ end }}</td>
+						<td>{{ with .Pending }}{{ GroupLink . }}{{ else }}<span class="text-muted">no approval</span>{{ end }}</td>
+						<td>{{ with .Member }}{{ GroupLink . }}{{ end }}</td>
+						<td>
+							<button type="submit" class="btn btn-sm btn-link" name="disable_node" value="{{ .NodeID }}">disable</button>
+						</td>
+					</tr>
+				{{ else }}
+					<tr>
+						<td colspan="4">Registration is not enabled on any node.</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</form>
+
+	<p>Groups which grant admin permission on any node can't be chosen.</p>
+
+	<form method="post" class="form-inline mb-3">
+		{{ $.CSRFField }}
+		<input type="text" class="form-control" name="enable_node" placeholder="/path/to/node" required>
+		<select class="form-control ml-sm-2" name="pending_group" title="pending group">
+			<option value="0">no approval</option>
+			{{ range .AllGroups }}
+				<option value="{{ .ID }}">{{ .Name }}</option>
+			{{ end }}
+		</select>
+		<select class="form-control ml-sm-2" name="member_group" title="member group">
+			{{ range .AllGroups }}
+				<option value="{{ .ID }}">{{ .Name }}</option>
+			{{ end }}
+		</select>
+		<button type="submit" class="btn btn-primary mx-sm-3">Enable registration</button>
+	</form>
+
+	<h2>Pending registrations</h2>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>User</th>
+					<th>Registration form</th>
+					<th>Signed up</th>
+					<th>Pending group</th>
+					<th>Member group</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range .Registrations }}
+					<tr>
+						<td>{{ UserLink .User }}</td>
+						<td><a href="choose/1{{ .NodePath }}">{{ .NodePath }}</a></td>
+						<td>{{ FormatTs .Created }}</td>
+						<td>{{ with .Pending }}{{ GroupLink . }}{{ end }}</td>
+						<td>{{ with .Member }}{{ GroupLink . }}{{ end }}</td>
+						<td>
+							{{ if .Confirmed }}
+								<button type="submit" class="btn btn-sm btn-success" name="approve" value="{{ .UserID }}">Approve</button>
+							{{ else }}
+								<span class="text-muted">email address not confirmed</span>
+							{{ end }}
+							<button type="submit" class="btn btn-sm btn-danger" name="reject" value="{{ .UserID }}" title="Delete the user">Reject</button>
+						</td>
+					</tr>
+				{{ else }}
+					<tr>
+						<td colspan="6">No pending registrations.</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	</form>`)
+
+type registrationsData struct {
+	*context
+}
+
+type registrationEntry struct {
+	core.Registration
+	User    core.DBUser
+	Pending core.DBGroup // nil if no approval is required, or if the group has been deleted
+	Member  core.DBGroup // nil if the group has been deleted
+}
+
+type registrationConfigEntry struct {
+	core.RegistrationConfig
+	Path    string       // empty if the node has been deleted
+	Pending core.DBGroup // nil if no approval is required, or if the group has been deleted
+	Member  core.DBGroup // nil if the group has been deleted
+}
+
+func (data *registrationsData) Configs() ([]registrationConfigEntry, error) {
+	configs, err := data.db.GetRegistrationConfigs()
+	if err != nil {
+		return nil, err
+	}
+	var entries = make([]registrationConfigEntry, 0, len(configs))
+	for _, config := range configs {
+		var entry = registrationConfigEntry{
+			RegistrationConfig: config,
+		}
+		if path, err := data.db.InternalPathByNodeID(config.NodeID); err == nil {
+			entry.Path = path
+		}
+		if g, err := data.db.GroupDB.GetGroup(config.PendingGroup); err == nil && config.PendingGroup != 0 {
+			entry.Pending = g
+		}
+		if g, err := data.db.GroupDB.GetGroup(config.MemberGroup); err == nil {
+			entry.Member = g
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (data *registrationsData) Registrations() ([]registrationEntry, error) {
+	registrations, err := data.db.GetRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	var entries = make([]registrationEntry, 0, len(registrations))
+	for _, reg := range registrations {
+		u, err := data.db.GetUser(reg.UserID)
+		if err != nil {
+			continue // user has been deleted
+		}
+		var entry = registrationEntry{
+			Registration: reg,
+			User:         u,
+		}
+		if g, err := data.db.GroupDB.GetGroup(reg.PendingGroup); err == nil && reg.PendingGroup != 0 {
+			entry.Pending = g
+		}
+		if g, err := data.db.GroupDB.GetGroup(reg.MemberGroup); err == nil {
+			entry.Member = g
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func registrations(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.IsRootAdmin() {
+		return errors.New("unauthorized")
+	}
+
+	if req.Method == http.MethodPost {
+
+		if path := strings.Trim(req.PostFormValue("enable_node"), "/"); path != "" {
+
+			n, err := ctx.Open("/" + path)
+			if err != nil {
+				return err
+			}
+
+			pendingID, err := strconv.Atoi(req.PostFormValue("pending_group"))
+			if err != nil {
+				return err
+			}
+
+			memberID, err := strconv.Atoi(req.PostFormValue("member_group"))
+			if err != nil {
+				return err
+			}
+
+			if err := ctx.db.SetRegistrationConfig(ctx.User, n, core.RegistrationConfig{
+				PendingGroup: pendingID,
+				MemberGroup:  memberID,
+				Approval:     pendingID != 0,
+			}); err != nil {
+				ctx.Danger(err)
+			} else {
+				ctx.Success("registration has been enabled on %s", n.Location())
+			}
+			ctx.SeeOther("/registrations")
+			return nil
+		}
+
+		if disableNode := req.PostFormValue("disable_node"); disableNode != "" {
+
+			nodeID, err := strconv.Atoi(disableNode)
+			if err != nil {
+				return err
+			}
+
+			if err := ctx.db.DeleteRegistrationConfig(ctx.User, nodeID); err != nil {
+				return err
+			}
+
+			ctx.Success("registration has been disabled")
+			ctx.SeeOther("/registrations")
+			return nil
+		}
+
+		var approve = req.PostFormValue("approve") != ""
+
+		var value = req.PostFormValue("reject")
+		if approve {
+			value = req.PostFormValue("approve")
+		}
+
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		u, err := ctx.db.GetUser(userID)
+		if err != nil {
+			return err
+		}
+
+		if approve {
+			if err := ctx.db.ApproveRegistration(ctx.User, u); err != nil {
+				return err
+			}
+			ctx.Success("registration of %s has been approved", u.Name())
+		} else {
+			if err := ctx.db.RejectRegistration(ctx.User, u); err != nil {
+				return err
+			}
+			ctx.Success("registration of %s has been rejected", u.Name())
+		}
+
+		ctx.SeeOther("/registrations")
+		return nil
+	}
+
+	return registrationsTmpl.Execute(w, &registrationsData{
+		context: ctx,
+	})
+}
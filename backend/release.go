@@ -1,7 +1,6 @@
 package backend
 
 import (
-	"errors"
 	"net/http"
 	"strconv"
 
@@ -25,7 +24,11 @@ func release(w http.ResponseWriter, req *http.Request, ctx *context, params http
 		return err
 	}
 
-	defer ctx.SeeOther("/edit/%d%s", versionNo, selected.Location())
+	if req.PostFormValue("return") == "tasks" {
+		defer ctx.SeeOther("/tasks")
+	} else {
+		defer ctx.SeeOther("/edit/%d%s", versionNo, selected.Location())
+	}
 
 	state, err := selected.ReleaseState(selectedVersion, ctx.User)
 	if err != nil {
@@ -36,12 +39,7 @@ func release(w http.ResponseWriter, req *http.Request, ctx *context, params http
 		return ErrAuth
 	}
 
-	releaseToGroup := state.ReleaseToGroup()
-	if releaseToGroup == nil {
-		return errors.New("no release group")
-	}
-
-	if err = ctx.db.SetWorkflowGroup(selected, selectedVersion, (*releaseToGroup).ID()); err != nil {
+	if err = ctx.db.Release(ctx.User, selected, selectedVersion, state, req.PostFormValue("comment")); err != nil {
 		return err
 	}
 
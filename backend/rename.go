@@ -15,6 +15,7 @@ var renameTmpl = tmpl(`<h1>Rename {{ .Selected.Location }}</h1>
 		</p>
 
 		<form method="post">
+			{{ $.CSRFField }}
 			<div class="form-group row">
 				<label class="col-sm-2 col-form-label">Location</label>
 				<div class="col-sm-10">
@@ -67,7 +68,7 @@ func rename(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 
 		newSlug = req.PostFormValue("slug")
 
-		if err = ctx.db.SetSlug(selected, newSlug); err == nil {
+		if err = ctx.db.SetSlug(ctx.User, selected, newSlug); err == nil {
 			ctx.SeeOther("/choose/1%s", selected.Location())
 			return nil
 		} else {
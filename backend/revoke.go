@@ -25,7 +25,11 @@ func revoke(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 		return err
 	}
 
-	defer ctx.SeeOther("/edit/%d%s", versionNo, selected.Location())
+	if req.PostFormValue("return") == "tasks" {
+		defer ctx.SeeOther("/tasks")
+	} else {
+		defer ctx.SeeOther("/edit/%d%s", versionNo, selected.Location())
+	}
 
 	state, err := selected.ReleaseState(selectedVersion, ctx.User)
 	if err != nil {
@@ -41,7 +45,7 @@ func revoke(w http.ResponseWriter, req *http.Request, ctx *context, params httpr
 		return errors.New("no revoke group")
 	}
 
-	if err = ctx.db.SetWorkflowGroup(selected, selectedVersion, (*revokeToGroup).ID()); err != nil {
+	if err = ctx.db.SetWorkflowGroup(ctx.User, selected, selectedVersion, (*revokeToGroup).ID(), req.PostFormValue("comment")); err != nil {
 		return err
 	}
 
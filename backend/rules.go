@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/wansing/perspective/core"
@@ -32,18 +33,58 @@ var rulesTmpl = tmpl(`<h1>All Access Rules</h1>
 
 	<h2>Other Permissions</h2>
 
+	<p>A closer rule takes precedence over a more distant rule. Rules of different groups on the same node add up. Admin rules on the root node apply everywhere.</p>
+
 	<table class="table">
 		<tr>
 			<th>Node</th>
 			<th>Group</th>
 			<th>Permission</th>
+			<th>Validity</th>
+			<th>Effect</th>
 		</tr>
 
 		{{ range .Rules }}
-			<tr>
+			<tr {{ if .Inactive }}class="text-muted"{{ end }}>
 				<td><a class="btn btn-sm btn-secondary" href="access{{ .Url }}">{{ .Url }}</a></td>
 				<td>{{ GroupLink .Group }}</td>
 				<td>{{ .Permission.String }}</td>
+				<td>{{ .Validity }}</td>
+				<td>
+					{{ if .Inactive }}
+						does not apply at the moment
+					{{ else if .Everywhere }}
+						applies everywhere
+					{{ else if eq .Permission.String "none" }}
+						denies access to this subtree, unless another group of the user has a rule on this node
+					{{ else }}
+						grants {{ .Permission.String }} on this subtree
+						{{ with .RestrictedBy }}
+							except:
+							<ul class="mb-0">
+								{{ range . }}
+									<li><a href="access{{ . }}">{{ . }}</a></li>
+								{{ end }}
+							</ul>
+						{{ end }}
+					{{ end }}
+				</td>
+			</tr>
+		{{ end }}
+	</table>
+
+	<h2>Inheritance Blocks</h2>
+
+	<p>Rules of ancestor nodes don't apply to these nodes and their descendants, except admin rules of the root node.</p>
+
+	<table class="table">
+		<tr>
+			<th>Node</th>
+		</tr>
+
+		{{ range .InheritanceBlocks }}
+			<tr>
+				<td><a class="btn btn-sm btn-secondary" href="access{{ . }}">{{ . }}</a></td>
 			</tr>
 		{{ end }}
 	</table>`)
@@ -54,9 +95,41 @@ type rulesData struct {
 
 // for view only
 type rule struct {
-	Url        string
-	Group      core.DBGroup
-	Permission core.Permission
+	Url          string
+	Group        core.DBGroup
+	Permission   core.Permission
+	Validity     core.Validity
+	Inactive     bool     // validity does not include the current time
+	Everywhere   bool     // admin rule of the root node
+	RestrictedBy []string // locations of descendant nodes where the rule does not apply because of a deny rule or an inheritance block
+}
+
+// isDescendant returns whether location is below ancestor.
+func isDescendant(location, ancestor string) bool {
+	if ancestor == "/" {
+		return location != "/"
+	}
+	return strings.HasPrefix(location, ancestor+"/")
+}
+
+func (data *rulesData) InheritanceBlocks() ([]string, error) {
+
+	blocks, err := data.db.GetInheritanceBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]string, 0, len(blocks))
+	for nodeID := range blocks {
+		url, err := data.db.InternalPathByNodeID(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, url)
+	}
+
+	sort.Strings(result)
+	return result, nil
 }
 
 func (data *rulesData) WorkflowAssignments() (result []struct {
@@ -101,33 +174,78 @@ func (data *rulesData) Rules() ([]rule, error) {
 		return nil, err
 	}
 
+	timedRules, err := data.db.GetTimedAccessRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var validities = make(map[int]map[int]core.Validity) // node id -> (group id -> validity)
+	for _, tr := range timedRules {
+		if tr.ActiveNow() {
+			if validities[tr.NodeID] == nil {
+				validities[tr.NodeID] = make(map[int]core.Validity)
+			}
+			validities[tr.NodeID][tr.GroupID] = tr.Validity
+		}
+	}
+
 	result := make([]rule, 0, len(rawRules))
 
 	for nodeID, groupMap := range rawRules {
 
 		for groupID, permInt := range groupMap {
 
-			url, err := data.db.InternalPathByNodeID(nodeID)
+			r, err := data.makeRule(nodeID, groupID, permInt)
 			if err != nil {
 				return nil, err
 			}
 
-			grp, err := data.db.GetGroup(groupID)
-			if err != nil {
-				return nil, fmt.Errorf("error getting group %d: %v", groupID, err)
-			}
+			r.Validity = validities[nodeID][groupID]
+			r.Everywhere = nodeID == core.RootID && r.Permission == core.Admin
+			result = append(result, r)
+		}
+	}
 
-			perm := core.Permission(permInt)
-			if !perm.Valid() {
-				return nil, fmt.Errorf("invalid permission: %d", permInt)
-			}
+	// expired and future rules
+
+	for _, tr := range timedRules {
+
+		if tr.ActiveNow() {
+			continue
+		}
+
+		r, err := data.makeRule(tr.NodeID, tr.GroupID, tr.Permission)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Validity = tr.Validity
+		r.Inactive = true
+		result = append(result, r)
+	}
+
+	// restrictions by deny rules and inheritance blocks
+
+	blocks, err := data.InheritanceBlocks()
+	if err != nil {
+		return nil, err
+	}
 
-			result = append(result, rule{
-				url,
-				grp,
-				perm,
-			})
+	for i := range result {
+		if result[i].Everywhere || result[i].Inactive || result[i].Permission == core.None {
+			continue
 		}
+		for _, block := range blocks {
+			if isDescendant(block, result[i].Url) {
+				result[i].RestrictedBy = append(result[i].RestrictedBy, block)
+			}
+		}
+		for _, other := range result {
+			if other.Permission == core.None && !other.Inactive && (other.Group.ID() == result[i].Group.ID() || other.Group.ID() == 0) && isDescendant(other.Url, result[i].Url) {
+				result[i].RestrictedBy = append(result[i].RestrictedBy, other.Url)
+			}
+		}
+		sort.Strings(result[i].RestrictedBy)
 	}
 
 	sort.Slice(
@@ -143,6 +261,30 @@ func (data *rulesData) Rules() ([]rule, error) {
 	return result, nil
 }
 
+func (data *rulesData) makeRule(nodeID, groupID, permInt int) (rule, error) {
+
+	url, err := data.db.InternalPathByNodeID(nodeID)
+	if err != nil {
+		return rule{}, err
+	}
+
+	grp, err := data.db.GetGroup(groupID)
+	if err != nil {
+		return rule{}, fmt.Errorf("error getting group %d: %v", groupID, err)
+	}
+
+	perm := core.Permission(permInt)
+	if !perm.Valid() {
+		return rule{}, fmt.Errorf("invalid permission: %d", permInt)
+	}
+
+	return rule{
+		Url:        url,
+		Group:      grp,
+		Permission: perm,
+	}, nil
+}
+
 func rules(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
 
 	if !ctx.IsRootAdmin() {
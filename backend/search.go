@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+const SearchLimit = 100
+
+var searchTmpl = tmpl(`<h1>Search</h1>
+
+	<form class="form-inline mb-3" action="search">
+		<input class="form-control mr-2" name="q" value="{{ .Term }}" placeholder="Slug, path or content" autofocus>
+		<button type="submit" class="btn btn-primary">Search</button>
+	</form>
+
+	{{ if .Term }}
+		{{ with .Results }}
+			<div class="table-responsive">
+				<table class="table table-sm">
+					<thead>
+						<tr>
+							<th>Status</th>
+							<th>Location</th>
+							<th>Class</th>
+							<th>Match</th>
+						</tr>
+					</thead>
+					<tbody>
+						{{ range . }}
+							<tr>
+								<td>{{ $.WorkflowIndicator .DBNode }}</td>
+								<td><a href="choose/1{{ .Location }}">{{ .Location }}</a></td>
+								<td>{{ .ClassCode }}</td>
+								<td>{{ if .InContent }}content{{ else }}path{{ end }}</td>
+							</tr>
+						{{ end }}
+					</tbody>
+				</table>
+			</div>
+			{{ if ge (len .) $.Limit }}
+				<p>Only the first {{ $.Limit }} results are shown.</p>
+			{{ end }}
+		{{ else }}
+			<p>No nodes found.</p>
+		{{ end }}
+	{{ end }}`)
+
+type searchData struct {
+	chooseData // for WorkflowIndicator
+	Limit      int
+	Results    []core.SearchResult
+	Term       string
+}
+
+func search(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	var term = req.URL.Query().Get("q")
+
+	results, err := ctx.db.SearchNodes(ctx.User, term, SearchLimit)
+	if err != nil {
+		return err
+	}
+
+	return searchTmpl.Execute(w, &searchData{
+		chooseData: chooseData{context: ctx},
+		Limit:      SearchLimit,
+		Results:    results,
+		Term:       term,
+	})
+}
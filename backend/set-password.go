@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var setPasswordTmpl = tmpl(`<h1>{{ if eq .Purpose "reset" }}Reset Password{{ else }}Welcome{{ end }}</h1>
+	<form method="post" style="max-width: 20rem; margin: auto;">
+		{{ $.CSRFField }}
+		<p>Set a password for <em>{{ .Selected.Name }}</em>.</p>
+		<div class="form-group">
+			<label>New password</label>
+			<input type="password" class="form-control" name="new1" required autofocus>
+		</div>
+		<div class="form-group">
+			<label>Repeat new password</label>
+			<input type="password" class="form-control" name="new2" required>
+		</div>
+		<div class="form-group">
+			<button type="submit" class="btn btn-primary">Set password</button>
+		</div>
+	</form>`)
+
+type setPasswordData struct {
+	*context
+	Selected core.DBUser
+	Purpose  string
+}
+
+// setPassword is the target of the links in password reset and invitation emails.
+func setPassword(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	var token = params.ByName("token")
+
+	selected, purpose, err := ctx.db.CheckPasswordToken(token)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodPost {
+
+		var new1 = req.PostFormValue("new1")
+		var new2 = req.PostFormValue("new2")
+
+		if new1 != new2 {
+			return errors.New("new passwords don't match")
+		}
+
+		u, err := ctx.db.SetPasswordByToken(token, new1)
+		if err != nil {
+			return err
+		}
+
+		if reg, err := ctx.db.GetRegistration(u.ID()); err == nil && reg.UserID != 0 {
+			ctx.Success("your email address has been confirmed, an administrator will review your registration")
+		} else {
+			ctx.Success("your password has been set, you can log in now")
+		}
+		ctx.SeeOther("/login")
+		return nil
+	}
+
+	return setPasswordTmpl.Execute(w, &setPasswordData{
+		context:  ctx,
+		Selected: selected,
+		Purpose:  purpose,
+	})
+}
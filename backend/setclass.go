@@ -15,6 +15,7 @@ var setClassTmpl = tmpl(`<h1>Set class of {{ .Selected.Location }}</h1>
 		</p>
 
 		<form method="post">
+			{{ $.CSRFField }}
 			<div class="form-group row">
 				<label class="col-sm-2 col-form-label">Class</label>
 				<div class="col-sm-10">
@@ -59,7 +60,7 @@ func setClass(w http.ResponseWriter, req *http.Request, ctx *context, params htt
 
 	if req.Method == http.MethodPost {
 		newClassCode = req.PostFormValue("class")
-		if err = ctx.db.SetClass(selected, newClassCode); err == nil {
+		if err = ctx.db.SetClass(ctx.User, selected, newClassCode); err == nil {
 			ctx.SeeOther("/choose/1%s", selected.Location())
 			return nil
 		} else {
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var tasksTmpl = tmpl(`<h1>My Tasks</h1>
+
+	<p>Nodes whose latest version is in one of your workflow groups, or which you can release. Oldest first.</p>
+
+	{{ with .Tasks }}
+		<div class="table-responsive">
+			<table class="table table-sm">
+				<thead>
+					<tr>
+						<th>Node</th>
+						<th>Version</th>
+						<th>Workflow group</th>
+						<th>Changed</th>
+						<th>Actions</th>
+					</tr>
+				</thead>
+				<tbody>
+					{{ range $task := . }}
+						<tr>
+							<td><a href="edit/{{ .Version.VersionNo }}{{ .Location }}">{{ .Location }}</a></td>
+							<td>{{ .Version.VersionNo }}: {{ .Version.VersionNote }}</td>
+							<td>{{ .State.WorkflowGroup.Name }}</td>
+							<td>{{ FormatTs .Version.TsChanged }} ({{ $.Age .Version.TsChanged }})</td>
+							<td>
+								<a class="btn btn-sm btn-secondary" href="edit/{{ .Version.VersionNo }}{{ .Location }}">Open</a>
+								{{ with $task.State.ReleaseToGroup }}
+									<form style="display: inline;" action="{{ $.Prefix }}release/{{ $task.Version.VersionNo }}{{ $task.Location }}" method="post">
+										{{ $.CSRFField }}
+										<input type="hidden" name="return" value="tasks">
+										<button type="submit" class="btn btn-sm btn-secondary" title="to {{ .Name }}">Release</button>
+									</form>
+								{{ end }}
+								{{ with $task.State.RevokeToGroup }}
+									<form style="display: inline;" action="{{ $.Prefix }}revoke/{{ $task.Version.VersionNo }}{{ $task.Location }}" method="post">
+										{{ $.CSRFField }}
+										<input type="hidden" name="return" value="tasks">
+										<button type="submit" class="btn btn-sm btn-secondary" title="to {{ .Name }}">Revoke</button>
+									</form>
+								{{ end }}
+							</td>
+						</tr>
+					{{ end }}
+				</tbody>
+			</table>
+		</div>
+	{{ else }}
+		<p>Nothing to do.</p>
+	{{ end }}`)
+
+type tasksData struct {
+	*context
+	Tasks []*core.Task
+}
+
+// Age returns a rough human-readable age of a timestamp.
+func (data *tasksData) Age(ts int64) string {
+	var age = time.Since(time.Unix(ts, 0))
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%d minutes", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%d days", int(age.Hours()/24))
+	}
+}
+
+func tasks(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	tasks, err := ctx.db.GetTasks(ctx.User)
+	if err != nil {
+		return err
+	}
+
+	return tasksTmpl.Execute(w, &tasksData{
+		context: ctx,
+		Tasks:   tasks,
+	})
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+const TreeChildrenLimit = 500
+
+var treeTmpl = tmpl(`<h1>Tree</h1>
+
+	<ul id="tree" class="list-unstyled">
+		<li data-location="{{ .Selected.Location }}" data-children="{{ .ChildrenCount }}">
+			<a href="choose/1{{ .Selected.Location }}">{{ .Selected.Slug }}</a>
+		</li>
+	</ul>
+
+	<style>
+		#tree ul {
+			padding-left: 1.5rem;
+		}
+		#tree li {
+			margin: 0.2rem 0;
+		}
+		.tree-toggle {
+			display: inline-block;
+			width: 1.5rem;
+			padding: 0;
+		}
+	</style>
+
+	<script>
+
+		var indicators = {
+			"empty": '<span class="alert-inline alert-warning">?</span>',
+			"released": '<span class="alert-inline alert-success" title="The latest version has been released.">&#10003;</span>',
+			"pending": '<span class="alert-inline alert-danger" title="The latest version has not been released yet.">&hellip;</span>'
+		};
+
+		function addToggle(li) {
+			if(li.dataset.children == "0") {
+				return;
+			}
+			var toggle = document.createElement("button");
+			toggle.className = "btn btn-sm btn-light tree-toggle";
+			toggle.textContent = "+";
+			toggle.addEventListener("click", function() {
+				var ul = li.querySelector("ul");
+				if(ul) {
+					ul.hidden = !ul.hidden;
+					toggle.textContent = ul.hidden ? "+" : "−";
+					return;
+				}
+				toggle.disabled = true;
+				fetch("tree-children" + li.dataset.location, {credentials: "same-origin"})
+					.then(function(response) {
+						if(!response.ok) {
+							throw new Error(response.statusText);
+						}
+						return response.json();
+					})
+					.then(function(result) {
+						var ul = document.createElement("ul");
+						ul.className = "list-unstyled";
+						result.children.forEach(function(child) {
+							ul.appendChild(makeItem(child));
+						});
+						if(result.more) {
+							var more = document.createElement("li");
+							more.innerHTML = '<a href="choose/1' + li.dataset.location + '">more&hellip;</a>';
+							ul.appendChild(more);
+						}
+						li.appendChild(ul);
+						toggle.textContent = "−";
+						toggle.disabled = false;
+					})
+					.catch(function(err) {
+						toggle.textContent = "!";
+						toggle.title = err.message;
+					});
+			});
+			li.insertBefore(toggle, li.firstChild);
+		}
+
+		function makeItem(child) {
+			var li = document.createElement("li");
+			li.dataset.location = child.location;
+			li.dataset.children = child.children;
+			var link = document.createElement("a");
+			link.href = "choose/1" + child.location;
+			link.textContent = child.slug;
+			li.appendChild(link);
+			li.insertAdjacentHTML("beforeend", " " + indicators[child.workflow] + " ");
+			var class_ = document.createElement("small");
+			class_.className = "text-muted";
+			class_.textContent = child.class + (child.children > 0 ? " (" + child.children + ")" : "");
+			li.appendChild(class_);
+			addToggle(li);
+			return li;
+		}
+
+		addToggle(document.querySelector("#tree > li"));
+
+	</script>`)
+
+type treeData struct {
+	*context
+	Selected *core.Node
+}
+
+func (data *treeData) ChildrenCount() (int, error) {
+	return data.Selected.CountReadableChildren(data.User)
+}
+
+func tree(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open("/")
+	if err != nil {
+		return err
+	}
+
+	if err := selected.RequirePermission(core.Read, ctx.User); err != nil {
+		return err
+	}
+
+	return treeTmpl.Execute(w, &treeData{
+		context:  ctx,
+		Selected: selected,
+	})
+}
+
+type treeChild struct {
+	ID       int    `json:"id"`
+	Slug     string `json:"slug"`
+	Location string `json:"location"`
+	Class    string `json:"class"`
+	Workflow string `json:"workflow"` // see workflowStatus
+	Children int    `json:"children"`
+}
+
+// treeChildren returns the readable children of a node as JSON.
+func treeChildren(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	selected, err := ctx.Open(params.ByName("path"))
+	if err != nil {
+		return err
+	}
+
+	if err := selected.RequirePermission(core.Read, ctx.User); err != nil {
+		return err
+	}
+
+	children, err := selected.GetChildren(ctx.User, selected.Class().SelectOrder(), TreeChildrenLimit, 0)
+	if err != nil {
+		return err
+	}
+
+	count, err := selected.CountReadableChildren(ctx.User)
+	if err != nil {
+		return err
+	}
+
+	var result = struct {
+		Children []treeChild `json:"children"`
+		More     bool        `json:"more"`
+	}{
+		Children: make([]treeChild, len(children)),
+		More:     count > len(children),
+	}
+
+	for i, child := range children {
+		grandchildren, err := child.CountReadableChildren(ctx.User)
+		if err != nil {
+			return err
+		}
+		result.Children[i] = treeChild{
+			ID:       child.ID(),
+			Slug:     child.Slug(),
+			Location: child.Location(),
+			Class:    child.ClassCode(),
+			Workflow: workflowStatus(child.DBNode),
+			Children: grandchildren,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
@@ -1,15 +1,23 @@
 package backend
 
 import (
+	"encoding/base64"
 	"errors"
+	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/skip2/go-qrcode"
 	"github.com/wansing/perspective/core"
 )
 
+// totpSecretKey is the session key of the TOTP secret which is being enrolled.
+const totpSecretKey = "totp_secret"
+
 var userTmpl = tmpl(`<h1>User &raquo;{{ .Selected.Name }}&laquo;</h1>
 
 	<h2>Groups</h2>
@@ -20,9 +28,225 @@ var userTmpl = tmpl(`<h1>User &raquo;{{ .Selected.Name }}&laquo;</h1>
 		{{ end }}
 	</ul>
 
+	<h2>Permissions</h2>
+
+	<table class="table table-sm">
+		<thead>
+			<tr>
+				<th>Subtree</th>
+				<th>Permission</th>
+				<th>Edit</th>
+				<th>Granted by</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{ range .SubtreePermissions }}
+				<tr>
+					<td><a href="choose/1{{ .Location }}">{{ .Location }}</a></td>
+					<td>{{ .Permission.String }}</td>
+					<td>{{ if .CanEdit }}yes{{ end }}</td>
+					<td>{{ GrantLink .Grant }}</td>
+				</tr>
+			{{ end }}
+		</tbody>
+	</table>
+
+	<h2>Notifications</h2>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<div class="form-group row">
+			<label class="col-sm-6 col-form-label">When a version is put into one of my workflow groups</label>
+			<div class="col-sm-6">
+				<select class="form-control" name="notification_mode">
+					{{ range .NotificationModes }}
+						<option {{ if eq . $.NotificationMode }}selected{{ end }} value="{{ . }}">{{ $.NotificationModeName . }}</option>
+					{{ end }}
+				</select>
+			</div>
+		</div>
+		<button type="submit" class="btn btn-primary">Save</button>
+	</form>
+
+	<h2>Two-Factor Authentication</h2>
+
+	{{ if .RecoveryCodes }}
+		<div class="alert alert-warning">
+			<p>Two-factor authentication has been enabled. Store these recovery codes in a safe place. Each of them can be used once instead of a code from your authenticator app. They won't be shown again.</p>
+			<pre class="mb-0">{{ range .RecoveryCodes }}{{ . }}
+{{ end }}</pre>
+		</div>
+	{{ else if .HasTOTP }}
+		<p>Two-factor authentication is enabled.</p>
+		{{ if .IsSelf }}
+			{{ if not .TOTPRequired }}
+				<form method="post" class="form-inline">
+					{{ $.CSRFField }}
+					<input type="text" class="form-control mr-sm-2" name="totp_disable_code" placeholder="Code or recovery code" autocomplete="one-time-code" required>
+					<button type="submit" class="btn btn-secondary">Disable</button>
+				</form>
+			{{ end }}
+		{{ else if .IsRootAdmin }}
+			<form method="post">
+				{{ $.CSRFField }}
+				<button type="submit" class="btn btn-danger" name="totp_reset" value="1">Reset two-factor authentication of {{ .Selected.Name }}</button>
+			</form>
+		{{ end }}
+	{{ else if .IsSelf }}
+		{{ if .TOTPRequired }}
+			<p class="text-danger">Your group requires two-factor authentication.</p>
+		{{ end }}
+		<p>Scan this QR code with an authenticator app, or enter the secret manually. Then enter the code which the app shows.</p>
+		<p>
+			<img src="{{ .TOTPQRCode }}" alt="QR code" width="256" height="256"><br>
+			<code>{{ .TOTPSecret }}</code>
+		</p>
+		<form method="post" class="form-inline">
+			{{ $.CSRFField }}
+			<input type="text" class="form-control mr-sm-2" name="totp_code" placeholder="Code" autocomplete="one-time-code" required>
+			<button type="submit" class="btn btn-primary">Enable</button>
+		</form>
+	{{ else }}
+		<p>Two-factor authentication is not enabled.</p>
+	{{ end }}
+
+	<h2>Sessions</h2>
+
+	{{ with .Sessions }}
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Browser</th>
+					<th>IP address</th>
+					<th>Logged in</th>
+					<th>Last seen</th>
+					<th>Remembered</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range . }}
+					<tr>
+						<td>{{ .UserAgent }}</td>
+						<td>{{ .IP }}</td>
+						<td>{{ $.FormatDateTime .Created }}</td>
+						<td>{{ $.FormatDateTime .LastSeen }}</td>
+						<td>{{ if .Remember }}yes{{ end }}</td>
+						<td>
+							{{ if eq .ID $.SessionID }}
+								this session
+							{{ else }}
+								<form method="post">
+									{{ $.CSRFField }}
+									<button type="submit" class="btn btn-sm btn-danger" name="session_revoke" value="{{ .ID }}">Revoke</button>
+								</form>
+							{{ end }}
+						</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+		<form method="post">
+			{{ $.CSRFField }}
+			{{ if $.IsSelf }}
+				<button type="submit" class="btn btn-danger" name="logout_everywhere" value="1">Log out all other sessions</button>
+			{{ else }}
+				<button type="submit" class="btn btn-danger" name="logout_everywhere" value="1">Log out {{ $.Selected.Name }} everywhere</button>
+			{{ end }}
+		</form>
+	{{ else }}
+		<p>There are no active sessions.</p>
+	{{ end }}
+
+	<h2>API Tokens</h2>
+
+	{{ if .NewAPIToken }}
+		<div class="alert alert-warning">
+			<p>Your new API token has been created. Copy it now, it won't be shown again. Send it in the <code>Authorization: Bearer</code> header.</p>
+			<pre class="mb-0">{{ .NewAPIToken }}</pre>
+		</div>
+	{{ end }}
+
+	{{ with .APITokens }}
+		<table class="table table-sm">
+			<thead>
+				<tr>
+					<th>Name</th>
+					<th>Scope</th>
+					<th>Subtree</th>
+					<th>Created</th>
+					<th>Expires</th>
+					<th>Last used</th>
+					<th></th>
+				</tr>
+			</thead>
+			<tbody>
+				{{ range . }}
+					<tr {{ if .Expired }}class="text-muted"{{ end }}>
+						<td>{{ .Name }}</td>
+						<td>{{ .Scope }}</td>
+						<td>{{ if .WholeSite }}whole site{{ else }}<a href="choose/1{{ .NodePath }}">{{ .NodePath }}</a>{{ end }}</td>
+						<td>{{ $.FormatDateTime .Created }}</td>
+						<td>{{ if .Expired }}expired{{ else if .Expires }}{{ $.FormatDateTime .Expires }}{{ else }}never{{ end }}</td>
+						<td>{{ if .LastUsed }}{{ $.FormatDateTime .LastUsed }}{{ else }}never{{ end }}</td>
+						<td>
+							<form method="post">
+								{{ $.CSRFField }}
+								<button type="submit" class="btn btn-sm btn-danger" name="api_token_delete" value="{{ .ID }}">Revoke</button>
+							</form>
+						</td>
+					</tr>
+				{{ end }}
+			</tbody>
+		</table>
+	{{ else }}
+		<p>There are no API tokens.</p>
+	{{ end }}
+
+	{{ if .IsSelf }}
+		<form method="post">
+			{{ $.CSRFField }}
+			<div class="form-group row">
+				<label class="col-sm-6 col-form-label">Name</label>
+				<div class="col-sm-6">
+					<input type="text" class="form-control" name="api_token_name" placeholder="like deploy script" required>
+				</div>
+			</div>
+			<div class="form-group row">
+				<label class="col-sm-6 col-form-label">Scope</label>
+				<div class="col-sm-6">
+					<select class="form-control" name="api_token_scope">
+						{{ range .Scopes }}
+							<option value="{{ . }}">{{ . }}</option>
+						{{ end }}
+					</select>
+				</div>
+			</div>
+			<div class="form-group row">
+				<label class="col-sm-6 col-form-label">Limit to subtree (optional)</label>
+				<div class="col-sm-6">
+					<input type="text" class="form-control" name="api_token_subtree" placeholder="/path/to/node">
+				</div>
+			</div>
+			<div class="form-group row">
+				<label class="col-sm-6 col-form-label">Expires</label>
+				<div class="col-sm-6">
+					<select class="form-control" name="api_token_days">
+						<option value="30">in 30 days</option>
+						<option value="90" selected>in 90 days</option>
+						<option value="365">in a year</option>
+						<option value="0">never</option>
+					</select>
+				</div>
+			</div>
+			<button type="submit" class="btn btn-primary">Create API token</button>
+		</form>
+	{{ end }}
+
 	<h2>Change Password</h2>
 
 	<form method="post">
+		{{ $.CSRFField }}
 
 		<div class="form-group row">
 			<label class="col-sm-6 col-form-label">Current password</label>
@@ -51,13 +275,85 @@ var userTmpl = tmpl(`<h1>User &raquo;{{ .Selected.Name }}&laquo;</h1>
 
 type userData struct {
 	*context
-	Selected core.DBUser
+	Selected      core.DBUser
+	RecoveryCodes []string // shown once after TOTP has been enabled
+	NewAPIToken   string   // shown once after it has been created
+	totpSecret    string
+}
+
+func (data *userData) APITokens() ([]core.APIToken, error) {
+	return data.db.GetAPITokens(data.Selected.ID())
+}
+
+func (data *userData) Sessions() ([]core.Session, error) {
+	return data.db.GetSessions(data.Selected.ID())
+}
+
+func (data *userData) Scopes() []string {
+	return core.Scopes
+}
+
+func (data *userData) IsSelf() bool {
+	return data.Selected.ID() == data.User.ID()
+}
+
+func (data *userData) HasTOTP() (bool, error) {
+	return data.db.HasTOTP(data.Selected)
+}
+
+func (data *userData) TOTPRequired() (bool, error) {
+	return data.db.TOTPRequired(data.Selected)
+}
+
+// TOTPSecret returns the secret which is being enrolled.
+func (data *userData) TOTPSecret() string {
+	return data.totpSecret
+}
+
+func (data *userData) TOTPQRCode() (template.URL, error) {
+	png, err := qrcode.Encode(core.TOTPURI(data.totpIssuer(), data.Selected.Name(), data.totpSecret), qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+func (data *userData) totpIssuer() string {
+	if u, err := url.Parse(data.db.PublicURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "perspective"
 }
 
 func (data *userData) Groups() ([]core.DBGroup, error) {
 	return data.db.GetGroupsOf(data.Selected)
 }
 
+func (data *userData) SubtreePermissions() ([]core.SubtreePermission, error) {
+	return data.db.SubtreePermissions(data.Selected)
+}
+
+func (data *userData) NotificationMode() (string, error) {
+	return data.db.GetNotificationMode(data.Selected.ID())
+}
+
+func (data *userData) NotificationModes() []string {
+	return core.NotificationModes
+}
+
+func (data *userData) NotificationModeName(mode string) string {
+	switch mode {
+	case core.NotifyImmediately:
+		return "send an email immediately"
+	case core.NotifyDigest:
+		return "send a digest"
+	case core.NotifyNever:
+		return "don't notify me"
+	default:
+		return mode
+	}
+}
+
 func user(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
 
 	selectedID, err := strconv.Atoi(params.ByName("id"))
@@ -74,6 +370,178 @@ func user(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 		return errors.New("unauthorized")
 	}
 
+	if ctx.APIToken() != nil {
+		return errors.New("user settings can't be accessed with an API token")
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("api_token_name") != "" {
+
+		if selected.ID() != ctx.User.ID() {
+			return errors.New("unauthorized")
+		}
+
+		var subtree *core.Node
+		if path := strings.Trim(req.PostFormValue("api_token_subtree"), "/"); path != "" {
+			if subtree, err = ctx.Open("/" + path); err != nil {
+				return err
+			}
+		}
+
+		days, err := strconv.Atoi(req.PostFormValue("api_token_days"))
+		if err != nil || days < 0 {
+			return errors.New("invalid expiry")
+		}
+
+		token, err := ctx.db.CreateAPIToken(ctx.User, selected, req.PostFormValue("api_token_name"), req.PostFormValue("api_token_scope"), subtree, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+
+		totpSecret, err := pendingTOTPSecret(req, ctx, selected)
+		if err != nil {
+			return err
+		}
+
+		return userTmpl.Execute(w, &userData{
+			context:     ctx,
+			Selected:    selected,
+			NewAPIToken: token,
+			totpSecret:  totpSecret,
+		})
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("api_token_delete") != "" {
+
+		tokenID, err := strconv.Atoi(req.PostFormValue("api_token_delete"))
+		if err != nil {
+			return err
+		}
+
+		tokens, err := ctx.db.GetAPITokens(selected.ID())
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tokens {
+			if t.ID == tokenID {
+				if err := ctx.db.DeleteAPIToken(ctx.User, selected, t); err != nil {
+					return err
+				}
+				ctx.Success("API token %s has been revoked", t.Name)
+			}
+		}
+
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("session_revoke") != "" {
+
+		sessions, err := ctx.db.GetSessions(selected.ID())
+		if err != nil {
+			return err
+		}
+
+		for _, s := range sessions {
+			if s.ID == req.PostFormValue("session_revoke") && s.ID != ctx.SessionID() {
+				if err := ctx.db.RevokeSession(ctx.User, selected, s); err != nil {
+					return err
+				}
+				ctx.Success("the session has been revoked")
+			}
+		}
+
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("logout_everywhere") != "" {
+
+		if err := ctx.db.LogoutEverywhere(ctx.User, selected, ownSessionID(ctx, selected)); err != nil {
+			return err
+		}
+
+		ctx.Success("%s has been logged out everywhere", selected.Name())
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("totp_code") != "" {
+
+		if selected.ID() != ctx.User.ID() {
+			return errors.New("unauthorized")
+		}
+
+		var secret = ctx.db.SessionManager.GetString(req.Context(), totpSecretKey)
+		if secret == "" {
+			return errors.New("no pending secret")
+		}
+
+		recoveryCodes, err := ctx.db.EnableTOTP(ctx.User, selected, secret, req.PostFormValue("totp_code"))
+		if err != nil {
+			ctx.Danger(err)
+			ctx.SeeOther("/user/%d", selected.ID())
+			return nil
+		}
+
+		ctx.db.SessionManager.Remove(req.Context(), totpSecretKey)
+
+		return userTmpl.Execute(w, &userData{
+			context:       ctx,
+			Selected:      selected,
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("totp_disable_code") != "" {
+
+		if selected.ID() != ctx.User.ID() {
+			return errors.New("unauthorized")
+		}
+
+		if required, err := ctx.db.TOTPRequired(selected); err != nil || required {
+			return errors.New("your group requires two-factor authentication")
+		}
+
+		if err := ctx.db.VerifySecondFactor(selected, req.PostFormValue("totp_disable_code")); err != nil {
+			ctx.Danger(err)
+			ctx.SeeOther("/user/%d", selected.ID())
+			return nil
+		}
+
+		if err := ctx.db.DisableTOTP(ctx.User, selected); err != nil {
+			return err
+		}
+
+		ctx.Success("two-factor authentication has been disabled")
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("totp_reset") != "" {
+
+		if !ctx.IsRootAdmin() {
+			return errors.New("unauthorized")
+		}
+
+		if err := ctx.db.DisableTOTP(ctx.User, selected); err != nil {
+			return err
+		}
+
+		ctx.Success("two-factor authentication of %s has been reset", selected.Name())
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
+	if req.Method == http.MethodPost && req.PostFormValue("notification_mode") != "" {
+		if err = ctx.db.SetNotificationMode(selected, req.PostFormValue("notification_mode")); err != nil {
+			return err
+		}
+		ctx.Success("notification settings of %s have been saved", selected.Name())
+		ctx.SeeOther("/user/%d", selected.ID())
+		return nil
+	}
+
 	if req.Method == http.MethodPost {
 
 		var new1 = req.PostFormValue("new1")
@@ -87,17 +555,52 @@ func user(w http.ResponseWriter, req *http.Request, ctx *context, params httprou
 			return errors.New("new password is empty") // we could use zxcvbn instead, or leave it to the UserDB
 		}
 
-		if err = ctx.db.ChangePassword(selected, req.PostFormValue("old"), new1); err != nil {
+		// sessions which might have been taken over are logged out, but the user stays logged in
+		if err = ctx.db.ChangePassword(ctx.User, selected, req.PostFormValue("old"), new1, ownSessionID(ctx, selected)); err != nil {
 			return err
 		}
 
-		ctx.Success("password of %s has been changed", selected.Name())
+		ctx.Success("password of %s has been changed, all other sessions have been logged out", selected.Name())
 		ctx.SeeOther("/user/%d", selected.ID())
 		return nil
 	}
 
+	totpSecret, err := pendingTOTPSecret(req, ctx, selected)
+	if err != nil {
+		return err
+	}
+
 	return userTmpl.Execute(w, &userData{
-		context:  ctx,
-		Selected: selected,
+		context:    ctx,
+		Selected:   selected,
+		totpSecret: totpSecret,
 	})
 }
+
+// ownSessionID returns the id of the current session if the user views the own page, so it is kept by LogoutEverywhere and ChangePassword.
+func ownSessionID(ctx *context, selected core.DBUser) string {
+	if selected.ID() != ctx.User.ID() {
+		return ""
+	}
+	return ctx.SessionID()
+}
+
+// pendingTOTPSecret returns the secret which is being enrolled, if the user views the own page and has not enabled TOTP yet.
+// The secret is kept in the session until TOTP is enabled, so reloading the page doesn't invalidate the QR code.
+func pendingTOTPSecret(req *http.Request, ctx *context, selected core.DBUser) (string, error) {
+	if selected.ID() != ctx.User.ID() {
+		return "", nil
+	}
+	hasTOTP, err := ctx.db.HasTOTP(selected)
+	if err != nil || hasTOTP {
+		return "", err
+	}
+	var secret = ctx.db.SessionManager.GetString(req.Context(), totpSecretKey)
+	if secret == "" {
+		if secret, err = core.NewTOTPSecret(); err != nil {
+			return "", err
+		}
+		ctx.db.SessionManager.Put(req.Context(), totpSecretKey, secret)
+	}
+	return secret, nil
+}
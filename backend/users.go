@@ -20,11 +20,15 @@ var usersTmpl = tmpl(`<h1>Users</h1>
 	<h2>Create User</h2>
 
 	<form method="post" class="form-inline">
+		{{ $.CSRFField }}
 		<div class="form-group">
 			<input type="email" class="form-control" name="mail_user" placeholder="Email address">
 			<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Create user</button>
+			{{ if and .MailEnabled .UsersWriteable }}
+				<button type="submit" class="btn btn-primary" name="invite" value="1" title="Create the user and send a link for setting the password">Invite user</button>
+			{{ end }}
 		</div>
-	</div>`)
+	</form>`)
 
 type usersData struct {
 	*context
@@ -48,7 +52,17 @@ func users(w http.ResponseWriter, req *http.Request, ctx *context, params httpro
 			return errors.New("missing email address")
 		}
 
-		if _, err := ctx.db.InsertUser(newUserMail); err != nil {
+		if req.PostFormValue("invite") != "" {
+			u, err := ctx.db.InviteUser(ctx.User, newUserMail)
+			if err != nil {
+				return err
+			}
+			ctx.Success("user %s has been invited", u.Name())
+			ctx.SeeOther("/users")
+			return nil
+		}
+
+		if _, err := ctx.db.InsertUser(ctx.User, newUserMail); err != nil {
 			return err
 		}
 
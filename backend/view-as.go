@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wansing/perspective/core"
+)
+
+var viewAsTmpl = tmpl(`<h1>View Site As</h1>
+
+	<p>See the site like another user, a member of a group, or a guest does. This affects the site only, not the backend. While viewing the site as someone else, you can't change anything there.</p>
+
+	<form method="post">
+		{{ $.CSRFField }}
+		<div class="form-group row">
+			<label class="col-sm-3 col-form-label">Identity</label>
+			<div class="col-sm-6">
+				<select class="form-control" name="view_as">
+					<option value="guest">Guest</option>
+					<optgroup label="Members of group">
+						{{ range .AllGroups }}
+							<option value="group:{{ .ID }}">{{ .Name }}</option>
+						{{ end }}
+					</optgroup>
+					<optgroup label="Users">
+						{{ range .AllUsers }}
+							<option value="user:{{ .ID }}">{{ .Name }}</option>
+						{{ end }}
+					</optgroup>
+				</select>
+			</div>
+			<div class="col-sm-3">
+				<button type="submit" class="btn btn-primary">View as</button>
+			</div>
+		</div>
+	</form>
+
+	{{ if .ViewAsName }}
+		<form method="post">
+			{{ $.CSRFField }}
+			<a class="btn btn-secondary" href="/" target="_blank">View site</a>
+			<button type="submit" class="btn btn-secondary" name="stop" value="1">Stop viewing as {{ .ViewAsName }}</button>
+		</form>
+	{{ end }}`)
+
+type viewAsData struct {
+	*context
+}
+
+func (data *viewAsData) AllUsers() ([]core.DBUser, error) {
+	return data.db.GetAllUsers(100000, 0) // assuming there are not more than 100k users
+}
+
+func viewAs(w http.ResponseWriter, req *http.Request, ctx *context, params httprouter.Params) error {
+
+	if !ctx.IsRootAdmin() {
+		return errors.New("unauthorized")
+	}
+
+	if req.Method == http.MethodPost {
+		if req.PostFormValue("stop") != "" {
+			ctx.db.SessionManager.Remove(req.Context(), core.ViewAsKey)
+		} else {
+			identity, err := ctx.db.ViewAsIdentity(req.PostFormValue("view_as"))
+			if err != nil {
+				return err
+			}
+			ctx.db.SessionManager.Put(req.Context(), core.ViewAsKey, req.PostFormValue("view_as"))
+			ctx.Success("you view the site as %s now", identity.Name())
+		}
+		ctx.SeeOther("/view-as")
+		return nil
+	}
+
+	return viewAsTmpl.Execute(w, &viewAsData{
+		context: ctx,
+	})
+}
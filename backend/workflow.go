@@ -12,6 +12,9 @@ import (
 var workflowTmpl = tmpl(`<h1>Workflow &raquo;{{ .Selected.Name }}&laquo;</h1>
 
 	<form method="post">
+		{{ $.CSRFField }}
+
+		<h2>Groups</h2>
 
 		{{ range $i, $e := .Selected.Groups }}
 			<div class="form-group">
@@ -33,6 +36,22 @@ var workflowTmpl = tmpl(`<h1>Workflow &raquo;{{ .Selected.Name }}&laquo;</h1>
 			</select>
 		</div>
 
+		<h2>Model</h2>
+
+		<div class="form-group">
+			{{ range .Models }}
+				<div class="form-check">
+					<input class="form-check-input" type="radio" name="model" id="model-{{ . }}" value="{{ . }}" {{ if eq . $.Model }}checked{{ end }}>
+					<label class="form-check-label" for="model-{{ . }}">{{ $.ModelName . }}</label>
+				</div>
+			{{ end }}
+		</div>
+
+		<div class="form-group form-inline">
+			<label for="approvals" title="Groups with fewer members require the approval of all members.">Required approvals per group (approval model only):</label>
+			<input class="form-control ml-2" type="number" min="1" id="approvals" name="approvals" value="{{ .Selected.RequiredApprovals }}">
+		</div>
+
 		<button class="btn btn-primary" type="submit">Save</button>
 	</form>
 
@@ -43,6 +62,22 @@ type workflowData struct {
 	Selected *core.Workflow
 }
 
+// Model returns the workflow model of the selected workflow, falling back to the default model.
+func (data *workflowData) Model() string {
+	if m := data.Selected.Model(); m != "" {
+		return m
+	}
+	return core.WorkflowModels[0]
+}
+
+func (data *workflowData) ModelName(model string) string {
+	return core.WorkflowModelName(model)
+}
+
+func (data *workflowData) Models() []string {
+	return core.WorkflowModels
+}
+
 func (data *workflowData) AllGroups() ([]core.DBGroup, error) {
 	return data.db.GetAllGroups(10000, 0) // assuming there are not more than 10k groups
 }
@@ -79,10 +114,21 @@ func workflow(w http.ResponseWriter, req *http.Request, ctx *context, params htt
 			groupIDs = append(groupIDs, groupID)
 		}
 
-		if err := ctx.db.UpdateWorkflow(selected.DBWorkflow, groupIDs); err != nil {
+		if err := ctx.db.UpdateWorkflow(ctx.User, selected.DBWorkflow, groupIDs); err != nil {
 			return err
 		}
 
+		requiredApprovals, _ := strconv.Atoi(req.PostFormValue("approvals"))
+		if requiredApprovals < 1 {
+			requiredApprovals = 1
+		}
+
+		if model := req.PostFormValue("model"); model != selected.Model() || requiredApprovals != selected.RequiredApprovals() {
+			if err := ctx.db.SetModel(ctx.User, selected.DBWorkflow, model, requiredApprovals); err != nil {
+				return err
+			}
+		}
+
 		ctx.Success("workflow %s has been updated", selected.Name())
 		ctx.SeeOther("/workflow/%d", selected.ID())
 		return nil
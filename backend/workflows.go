@@ -20,6 +20,7 @@ var workflowsTmpl = tmpl(`<h1>Workflows</h1>
 	<h2>Create Workflow</h2>
 
 	<form method="post" class="form-inline">
+		{{ $.CSRFField }}
 		<div class="form-group">
 			<input class="form-control" name="workflow_name" placeholder="Workflow name">
 			<button type="submit" class="btn btn-primary mx-sm-3" name="submit_add">Create workflow</button>
@@ -48,7 +49,7 @@ func workflows(w http.ResponseWriter, req *http.Request, ctx *context, params ht
 			return errors.New("missing workflow name")
 		}
 
-		if err := ctx.db.InsertWorkflow(newWorkflowName); err != nil {
+		if err := ctx.db.InsertWorkflow(ctx.User, newWorkflowName); err != nil {
 			return err
 		}
 
@@ -0,0 +1,111 @@
+package classes
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/wansing/perspective/core"
+)
+
+func init() {
+
+	var tmpl = template.Must(template.New("").Parse(`
+		{{if .LoggedIn}}
+			<p>You are logged in already.</p>
+		{{else if .Disabled}}
+			<p>Registration is not available at the moment.</p>
+		{{else}}
+			<form method="post" class="registration">
+				<p>
+					<label for="registration_email">Email address</label>
+					<input type="email" id="registration_email" name="registration_email" required>
+				</p>
+				<p style="display: none;">
+					<label for="registration_website">Leave this field empty</label>
+					<input type="text" id="registration_website" name="registration_website" tabindex="-1" autocomplete="off">
+				</p>
+				<p>
+					<button type="submit">Sign up</button>
+				</p>
+				<p>You will receive an email with a link. Follow it to confirm your email address and to set your password.{{if .Approval}} An administrator will review your registration then.{{end}}</p>
+			</form>
+		{{end}}`))
+
+	Register(func() core.Class {
+		return &Registration{
+			tmpl: tmpl,
+		}
+	})
+}
+
+// Registration lets visitors sign up. The groups which they join are configured by root admins under Registrations in the backend, see core.RegistrationConfig.
+type Registration struct {
+	tmpl *template.Template
+}
+
+func (*Registration) Code() string {
+	return "registration"
+}
+
+func (*Registration) Name() string {
+	return "Registration form"
+}
+
+func (*Registration) Info() string {
+	return `<p>Visitors sign up with their email address and confirm it. Then they join the pending group, and an administrator approves them under Registrations in the backend, which moves them into the member group.</p>
+
+<p>A root admin must enable registration for this node under Registrations in the backend and choose the groups there. The content of this node is not used.</p>`
+}
+
+func (*Registration) FeaturedChildClasses() []string {
+	return nil
+}
+
+func (*Registration) SelectOrder() core.Order {
+	return core.AlphabeticallyAsc
+}
+
+type registrationData struct {
+	LoggedIn bool
+	Disabled bool
+	Approval bool
+}
+
+func (t *Registration) Run(r *core.Query) error {
+
+	if err := r.Recurse(); err != nil {
+		return err
+	}
+
+	var config, err = r.RegistrationConfig()
+	var disabled = err == core.ErrRegistrationDisabled
+	if err != nil && !disabled {
+		return err
+	}
+
+	if email := r.PostFormValue("registration_email"); email != "" {
+		var err error
+		if r.PostFormValue("registration_website") == "" { // honeypot field, which humans don't see
+			err = r.Register(email)
+		}
+		if err == nil {
+			r.Success("Thank you! Please check your email and follow the link to confirm your registration.")
+		} else {
+			r.Danger(err)
+		}
+		r.SeeOther("%s", r.Node.Link())
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.tmpl.Execute(buf, &registrationData{
+		LoggedIn: r.LoggedIn(),
+		Disabled: disabled,
+		Approval: config.Approval,
+	}); err != nil {
+		return err
+	}
+	r.Set("body", buf.String())
+
+	return nil
+}
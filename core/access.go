@@ -1,8 +1,14 @@
 package core
 
+// AccessDB stores access rules. GetAccessRules and GetAllAccessRules return only rules whose validity includes the current time.
 type AccessDB interface {
-	GetAccessRules(nodeID int) (map[int]int, error)  // group id -> permission
-	GetAllAccessRules() (map[int]map[int]int, error) // node id -> (group id -> permission)
-	InsertAccessRule(nodeID int, groupID int, perm int) error
+	DeleteExpiredAccessRules(before int64) (int64, error)                        // returns the number of deleted rules
+	GetAccessRules(nodeID int) (map[int]int, error)                              // group id -> permission
+	GetAllAccessRules() (map[int]map[int]int, error)                             // node id -> (group id -> permission)
+	GetInheritanceBlocks() (map[int]bool, error)                                 // node ids of nodes which block inheritance
+	GetTimedAccessRules() ([]TimedAccessRule, error)                             // rules with a limited validity, including expired and future ones
+	InsertAccessRule(nodeID int, groupID int, perm int, validity Validity) error // replaces an existing rule of the group on the node
+	IsInheritanceBlocked(nodeID int) (bool, error)
 	RemoveAccessRule(nodeID int, groupID int) error
+	SetInheritanceBlocked(nodeID int, blocked bool) error
 }
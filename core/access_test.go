@@ -0,0 +1,267 @@
+package core
+
+import (
+	"testing"
+)
+
+// testAccessDB implements the read methods of AccessDB which are used by permission checks. Validities are tested in sqldb.
+type testAccessDB struct {
+	AccessDB
+	rules  map[int]map[int]int // node id -> (group id -> permission)
+	blocks map[int]bool
+}
+
+func (db *testAccessDB) GetAccessRules(nodeID int) (map[int]int, error) {
+	return db.rules[nodeID], nil
+}
+
+func (db *testAccessDB) IsInheritanceBlocked(nodeID int) (bool, error) {
+	return db.blocks[nodeID], nil
+}
+
+type testGroup struct {
+	id      int
+	members map[int]interface{}
+}
+
+func (g testGroup) ID() int                                     { return g.id }
+func (g testGroup) Name() string                                { return "test group" }
+func (g testGroup) DirectMembers() (map[int]interface{}, error) { return g.members, nil }
+func (g testGroup) HasMember(u DBUser) (bool, error)            { _, ok := g.members[u.ID()]; return ok, nil }
+func (g testGroup) Members() (map[int]interface{}, error)       { return g.members, nil }
+
+type testNode struct {
+	DBNode
+	id   int
+	slug string
+}
+
+func (n testNode) ID() int {
+	return n.id
+}
+
+func (n testNode) Slug() string {
+	return n.slug
+}
+
+// memberOf returns a user who is a member of the given groups.
+func memberOf(groupIDs ...int) DBUser {
+	var gv = GroupViewer{}
+	for _, id := range groupIDs {
+		gv.Groups = append(gv.Groups, testGroup{id: id})
+	}
+	return gv
+}
+
+const (
+	testEditors = 10
+	testBlocked = 11
+	testAdmins  = 20
+)
+
+func TestRequirePermission(t *testing.T) {
+
+	// root (1) > a (2) > b (3)
+	var db = &CoreDB{}
+	var root = db.NewNode(nil, testNode{id: RootID})
+	var a = db.NewNode(root, testNode{id: 2})
+	var b = db.NewNode(a, testNode{id: 3})
+
+	var tests = []struct {
+		name   string
+		rules  map[int]map[int]int
+		blocks map[int]bool
+		user   DBUser
+		node   *Node
+		perm   Permission
+		want   bool
+	}{
+		{
+			name:  "inherited grant",
+			rules: map[int]map[int]int{2: {testEditors: int(Create)}},
+			user:  memberOf(testEditors),
+			node:  b,
+			perm:  Create,
+			want:  true,
+		},
+		{
+			name:  "grant does not include higher permission",
+			rules: map[int]map[int]int{2: {testEditors: int(Create)}},
+			user:  memberOf(testEditors),
+			node:  b,
+			perm:  Remove,
+			want:  false,
+		},
+		{
+			name:  "grant and deny on the same node",
+			rules: map[int]map[int]int{3: {testEditors: int(Read), testBlocked: int(None)}},
+			user:  memberOf(testEditors, testBlocked),
+			node:  b,
+			perm:  Read,
+			want:  true,
+		},
+		{
+			name:  "deny on the same node as a grant of another group",
+			rules: map[int]map[int]int{3: {testEditors: int(Read), testBlocked: int(None)}},
+			user:  memberOf(testBlocked),
+			node:  b,
+			perm:  Read,
+			want:  false,
+		},
+		{
+			name:  "deny stops the walk up the tree",
+			rules: map[int]map[int]int{1: {testEditors: int(Create)}, 3: {testEditors: int(None)}},
+			user:  memberOf(testEditors),
+			node:  b,
+			perm:  Read,
+			want:  false,
+		},
+		{
+			name:  "deny of another group stops the walk up the tree",
+			rules: map[int]map[int]int{2: {testEditors: int(Create)}, 3: {testBlocked: int(None)}},
+			user:  memberOf(testEditors, testBlocked),
+			node:  b,
+			perm:  Read,
+			want:  false,
+		},
+		{
+			name:  "deny does not apply to the parent",
+			rules: map[int]map[int]int{1: {testEditors: int(Create)}, 3: {testEditors: int(None)}},
+			user:  memberOf(testEditors),
+			node:  a,
+			perm:  Create,
+			want:  true,
+		},
+		{
+			name:  "closer grant overrides distant deny",
+			rules: map[int]map[int]int{2: {testEditors: int(None)}, 3: {testEditors: int(Read)}},
+			user:  memberOf(testEditors),
+			node:  b,
+			perm:  Read,
+			want:  true,
+		},
+		{
+			name:   "inheritance block",
+			rules:  map[int]map[int]int{1: {AllUsers{}.ID(): int(Read)}},
+			blocks: map[int]bool{3: true},
+			user:   nil,
+			node:   b,
+			perm:   Read,
+			want:   false,
+		},
+		{
+			name:   "inheritance block does not apply to the parent",
+			rules:  map[int]map[int]int{1: {AllUsers{}.ID(): int(Read)}},
+			blocks: map[int]bool{3: true},
+			user:   nil,
+			node:   a,
+			perm:   Read,
+			want:   true,
+		},
+		{
+			name:   "rule on a blocking node",
+			rules:  map[int]map[int]int{3: {testEditors: int(Read)}},
+			blocks: map[int]bool{3: true},
+			user:   memberOf(testEditors),
+			node:   b,
+			perm:   Read,
+			want:   true,
+		},
+		{
+			name:   "inheritance block between node and grant",
+			rules:  map[int]map[int]int{1: {testEditors: int(Create)}},
+			blocks: map[int]bool{2: true},
+			user:   memberOf(testEditors),
+			node:   b,
+			perm:   Read,
+			want:   false,
+		},
+		{
+			name:  "guests can't get more than read",
+			rules: map[int]map[int]int{1: {AllUsers{}.ID(): int(Create)}},
+			user:  nil,
+			node:  b,
+			perm:  Create,
+			want:  false,
+		},
+		{
+			name:   "root admin is exempt from inheritance blocks",
+			rules:  map[int]map[int]int{1: {testAdmins: int(Admin)}},
+			blocks: map[int]bool{2: true},
+			user:   memberOf(testAdmins),
+			node:   b,
+			perm:   Admin,
+			want:   true,
+		},
+		{
+			name:  "root admin is exempt from deny rules",
+			rules: map[int]map[int]int{1: {testAdmins: int(Admin)}, 3: {testAdmins: int(None)}},
+			user:  memberOf(testAdmins),
+			node:  b,
+			perm:  Read,
+			want:  true,
+		},
+		{
+			name:  "admin on a subtree is not exempt from deny rules",
+			rules: map[int]map[int]int{2: {testAdmins: int(Admin)}, 3: {testAdmins: int(None)}},
+			user:  memberOf(testAdmins),
+			node:  b,
+			perm:  Read,
+			want:  false,
+		},
+		{
+			name:   "lower permission on the root is not exempt",
+			rules:  map[int]map[int]int{1: {testEditors: int(Remove)}},
+			blocks: map[int]bool{3: true},
+			user:   memberOf(testEditors),
+			node:   b,
+			perm:   Read,
+			want:   false,
+		},
+	}
+
+	for _, test := range tests {
+		db.AccessDB = &testAccessDB{
+			rules:  test.rules,
+			blocks: test.blocks,
+		}
+		var err = test.node.requirePermissionRecursive(test.perm, test.user, nil)
+		if got := err == nil; got != test.want {
+			t.Errorf("%s: got %v, want %v (error: %v)", test.name, got, test.want, err)
+		}
+	}
+}
+
+func TestRequirePermissionRules(t *testing.T) {
+
+	var db = &CoreDB{
+		AccessDB: &testAccessDB{
+			rules: map[int]map[int]int{
+				1: {testAdmins: int(Admin)},
+				2: {testEditors: int(Create)},
+				3: {testEditors: int(Read), testBlocked: int(None)},
+			},
+		},
+	}
+	var root = db.NewNode(nil, testNode{id: RootID})
+	var a = db.NewNode(root, testNode{id: 2})
+	var b = db.NewNode(a, testNode{id: 3})
+
+	// the closest grant is returned, the rule on node 2 is not reached
+	var rules = make(map[int]map[int]interface{})
+	if err := b.requirePermissionRecursive(Read, memberOf(testEditors, testBlocked), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || len(rules[3]) != 1 || rules[3][testEditors] == nil {
+		t.Errorf("got rules %v, want the read rule of node 3", rules)
+	}
+
+	// the root admin rule is returned as a fallback
+	rules = make(map[int]map[int]interface{})
+	if err := b.requirePermissionRecursive(Create, memberOf(testAdmins), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[RootID][testAdmins] == nil {
+		t.Errorf("got rules %v, want the admin rule of the root", rules)
+	}
+}
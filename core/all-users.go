@@ -23,6 +23,10 @@ func (AllUsers) Leave(DBUser) error {
 	return errors.New("can't leave")
 }
 
+func (AllUsers) DirectMembers() (map[int]interface{}, error) {
+	return nil, errors.New("not available")
+}
+
 func (AllUsers) HasMember(DBUser) (bool, error) {
 	return true, nil
 }
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/wansing/perspective/util"
+)
+
+// API token scopes
+const (
+	ScopeRead  = "read"  // read nodes
+	ScopeEdit  = "edit"  // additionally create, edit, release and remove nodes
+	ScopeAdmin = "admin" // everything the user can do
+)
+
+// Scopes contains all API token scopes, from the lowest to the highest.
+var Scopes = []string{ScopeRead, ScopeEdit, ScopeAdmin}
+
+const (
+	apiTokenPrefix = "pt_"
+	apiTokenTouch  = time.Minute // LastUsed is updated at most once in this duration
+)
+
+var ErrInvalidAPIToken = errors.New("invalid or expired API token")
+
+// An APIToken allows scripts to authenticate as a user. Only its SHA-256 hash is stored.
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Hash     string
+	Scope    string // ScopeRead, ScopeEdit or ScopeAdmin
+	NodeID   int    // limits the token to a subtree, 0 for the whole site
+	NodePath string // location of the node at the time of creation, see isAncestor
+	Created  int64
+	Expires  int64 // 0 for never
+	LastUsed int64 // 0 for never
+}
+
+// An APITokenDB stores API tokens.
+type APITokenDB interface {
+	DeleteAPIToken(userID, id int) error
+	GetAPIToken(hash string) (APIToken, error) // returns a zero ID if the token does not exist
+	GetAPITokens(userID int) ([]APIToken, error)
+	InsertAPIToken(t APIToken) error
+	TouchAPIToken(id int, ts int64) error
+}
+
+// maxPermission returns the highest permission which the scope allows.
+func (t APIToken) maxPermission() Permission {
+	switch t.Scope {
+	case ScopeRead:
+		return Read
+	case ScopeEdit:
+		return Remove
+	case ScopeAdmin:
+		return Admin
+	default:
+		return None
+	}
+}
+
+// CanEdit returns whether the scope allows editing nodes.
+func (t APIToken) CanEdit() bool {
+	return t.Scope == ScopeEdit || t.Scope == ScopeAdmin
+}
+
+// Expired returns whether the token has expired.
+func (t APIToken) Expired() bool {
+	return t.Expires != 0 && t.Expires < time.Now().Unix()
+}
+
+// WholeSite returns whether the token is not limited to a subtree.
+func (t APIToken) WholeSite() bool {
+	return t.NodeID == 0 || t.NodeID == RootID
+}
+
+// covers returns whether the node is in the subtree of the token.
+func (t APIToken) covers(n *Node) bool {
+	if t.WholeSite() {
+		return true
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p.ID() == t.NodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// isAncestor returns whether the node is an ancestor of the subtree of the token, so paths into the subtree can be opened.
+// It compares locations, so it fails if the subtree has been moved. That only affects reading, as covers compares ids.
+func (t APIToken) isAncestor(n *Node) bool {
+	var location = n.Location()
+	return location == "" || location == "/" || strings.HasPrefix(t.NodePath, strings.TrimSuffix(location, "/")+"/")
+}
+
+// A TokenUser is a user who has authenticated with an API token. It has the id and the name of the user, so permission checks resolve to the same user, but they are limited by the scope and the subtree of the token.
+type TokenUser struct {
+	DBUser
+	Token APIToken
+}
+
+// tokenAllows returns false if u is a TokenUser whose token does not allow the permission on the node. If n is nil, the subtree is not checked.
+func tokenAllows(u DBUser, perm Permission, n *Node) bool {
+	tu, ok := u.(TokenUser)
+	if !ok {
+		return true
+	}
+	if perm > tu.Token.maxPermission() {
+		return false
+	}
+	if n == nil || tu.Token.covers(n) {
+		return true
+	}
+	return perm == Read && tu.Token.isAncestor(n)
+}
+
+// tokenAllowsEdit returns false if u is a TokenUser whose token does not allow editing the node.
+func tokenAllowsEdit(u DBUser, n *Node) bool {
+	tu, ok := u.(TokenUser)
+	if !ok {
+		return true
+	}
+	return tu.Token.CanEdit() && (n == nil || tu.Token.covers(n))
+}
+
+// CreateAPIToken creates a token for the user and returns it. The token is not stored and can't be shown again.
+func (c *CoreDB) CreateAPIToken(actor DBUser, u DBUser, name, scope string, subtree *Node, lifetime time.Duration) (string, error) {
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("missing name")
+	}
+
+	var validScope bool
+	for _, s := range Scopes {
+		if s == scope {
+			validScope = true
+		}
+	}
+	if !validScope {
+		return "", errors.New("invalid scope")
+	}
+
+	random, err := util.RandomString32()
+	if err != nil {
+		return "", err
+	}
+	var token = apiTokenPrefix + random
+
+	var now = time.Now()
+	var t = APIToken{
+		UserID:  u.ID(),
+		Name:    name,
+		Hash:    hashToken(token),
+		Scope:   scope,
+		Created: now.Unix(),
+	}
+	if subtree != nil {
+		t.NodeID = subtree.ID()
+		t.NodePath = subtree.Location()
+	}
+	if lifetime > 0 {
+		t.Expires = now.Add(lifetime).Unix()
+	}
+
+	if err := c.APITokenDB.InsertAPIToken(t); err != nil {
+		return "", err
+	}
+
+	var where = "whole site"
+	if !t.WholeSite() {
+		where = t.NodePath
+	}
+	return token, c.audit(actor, AuditCreateAPIToken, t.NodeID, "%s: %s (%s, %s)", u.Name(), name, scope, where)
+}
+
+// DeleteAPIToken shadows APITokenDB.DeleteAPIToken.
+func (c *CoreDB) DeleteAPIToken(actor DBUser, u DBUser, t APIToken) error {
+	if err := c.APITokenDB.DeleteAPIToken(u.ID(), t.ID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditDeleteAPIToken, t.NodeID, "%s: %s", u.Name(), t.Name)
+}
+
+// authenticateToken returns the TokenUser of a valid token and updates its LastUsed timestamp.
+func (c *CoreDB) authenticateToken(token string) (TokenUser, error) {
+
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return TokenUser{}, ErrInvalidAPIToken
+	}
+
+	t, err := c.APITokenDB.GetAPIToken(hashToken(token))
+	if err != nil {
+		return TokenUser{}, err
+	}
+	if t.ID == 0 || t.Expired() {
+		return TokenUser{}, ErrInvalidAPIToken
+	}
+
+	u, err := c.UserDB.GetUser(t.UserID)
+	if err != nil {
+		return TokenUser{}, ErrInvalidAPIToken // user has been deleted
+	}
+
+	if now := time.Now(); now.Sub(time.Unix(t.LastUsed, 0)) > apiTokenTouch {
+		if err := c.APITokenDB.TouchAPIToken(t.ID, now.Unix()); err != nil {
+			return TokenUser{}, err
+		}
+		t.LastUsed = now.Unix()
+	}
+
+	return TokenUser{u, t}, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or an empty string.
+func bearerToken(header string) string {
+	const prefix = "bearer "
+	if len(header) > len(prefix) && strings.ToLower(header[:len(prefix)]) == prefix {
+		return strings.TrimSpace(header[len(prefix):])
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditAddAccessRule         = "add-access-rule"
+	AuditAddChild              = "add-child"
+	AuditAddGroupManager       = "add-group-manager"
+	AuditAddSubgroup           = "add-subgroup"
+	AuditApprove               = "approve"
+	AuditApproveRegistration   = "approve-registration"
+	AuditAssignWorkflow        = "assign-workflow"
+	AuditChangePassword        = "change-password"
+	AuditCreateAPIToken        = "create-api-token"
+	AuditDeleteAPIToken        = "delete-api-token"
+	AuditDeleteChangeSet       = "delete-change-set"
+	AuditDeleteExpired         = "delete-expired"
+	AuditDeleteNode            = "delete-node"
+	AuditDisableTOTP           = "disable-totp"
+	AuditEdit                  = "edit"
+	AuditEnableTOTP            = "enable-totp"
+	AuditInsertChangeSet       = "insert-change-set"
+	AuditInsertGroup           = "insert-group"
+	AuditInsertUser            = "insert-user"
+	AuditInsertWorkflow        = "insert-workflow"
+	AuditInviteUser            = "invite-user"
+	AuditJoin                  = "join"
+	AuditLeave                 = "leave"
+	AuditLoginFailed           = "login-failed"
+	AuditLogoutEverywhere      = "logout-everywhere"
+	AuditRegister              = "register"
+	AuditRejectRegistration    = "reject-registration"
+	AuditRemoveAccessRule      = "remove-access-rule"
+	AuditRemoveChangeSetItem   = "remove-change-set-item"
+	AuditRemoveGroupManager    = "remove-group-manager"
+	AuditRemoveSubgroup        = "remove-subgroup"
+	AuditRequestPasswordReset  = "request-password-reset"
+	AuditRevokeSession         = "revoke-session"
+	AuditSetClass              = "set-class"
+	AuditSetInheritance        = "set-inheritance"
+	AuditSetParent             = "set-parent"
+	AuditSetPasswordByToken    = "set-password-by-token"
+	AuditSetRegistrationConfig = "set-registration-config"
+	AuditSetSlug               = "set-slug"
+	AuditSetTOTPRequired       = "set-totp-required"
+	AuditSetWorkflowGroup      = "set-workflow-group"
+	AuditSetWorkflowModel      = "set-workflow-model"
+	AuditUnassignWorkflow      = "unassign-workflow"
+	AuditUnlockLogin           = "unlock-login"
+	AuditUpdateWorkflow        = "update-workflow"
+	AuditUseRecoveryCode       = "use-recovery-code"
+)
+
+// AuditActions contains all audit actions, in alphabetical order.
+var AuditActions = []string{
+	AuditAddAccessRule,
+	AuditAddChild,
+	AuditAddGroupManager,
+	AuditAddSubgroup,
+	AuditApprove,
+	AuditApproveRegistration,
+	AuditAssignWorkflow,
+	AuditChangePassword,
+	AuditCreateAPIToken,
+	AuditDeleteAPIToken,
+	AuditDeleteChangeSet,
+	AuditDeleteExpired,
+	AuditDeleteNode,
+	AuditDisableTOTP,
+	AuditEdit,
+	AuditEnableTOTP,
+	AuditInsertChangeSet,
+	AuditInsertGroup,
+	AuditInsertUser,
+	AuditInsertWorkflow,
+	AuditInviteUser,
+	AuditJoin,
+	AuditLeave,
+	AuditLoginFailed,
+	AuditLogoutEverywhere,
+	AuditRegister,
+	AuditRejectRegistration,
+	AuditRemoveAccessRule,
+	AuditRemoveChangeSetItem,
+	AuditRemoveGroupManager,
+	AuditRemoveSubgroup,
+	AuditRequestPasswordReset,
+	AuditRevokeSession,
+	AuditSetClass,
+	AuditSetInheritance,
+	AuditSetParent,
+	AuditSetPasswordByToken,
+	AuditSetRegistrationConfig,
+	AuditSetSlug,
+	AuditSetTOTPRequired,
+	AuditSetWorkflowGroup,
+	AuditSetWorkflowModel,
+	AuditUnassignWorkflow,
+	AuditUnlockLogin,
+	AuditUpdateWorkflow,
+	AuditUseRecoveryCode,
+}
+
+// A DBAuditEntry records an administrative or editorial action.
+//
+// The user name is stored along with the user id, so the entry remains meaningful if the user is deleted or renamed.
+type DBAuditEntry interface {
+	Ts() int64
+	UserID() int // zero if the action has been done from the command line
+	Username() string
+	Action() string
+	NodeID() int // zero if the action does not refer to a node
+	Details() string
+}
+
+// An AuditFilter restricts the result of AuditDB.GetAuditEntries. Zero values match everything.
+type AuditFilter struct {
+	Action   string
+	NodeID   int
+	Username string
+	From     int64 // inclusive
+	Until    int64 // exclusive
+}
+
+// An AuditDB stores an append-only log. It must not provide any means to modify or delete entries.
+type AuditDB interface {
+	CountAuditEntries(filter AuditFilter) (int, error)
+	GetAuditEntries(filter AuditFilter, limit, offset int) ([]DBAuditEntry, error) // latest first
+	InsertAuditEntry(ts int64, userID int, username string, action string, nodeID int, details string) error
+}
+
+// audit writes an entry to the audit log. The actor can be nil, e.g. if the action has been done from the command line.
+func (c *CoreDB) audit(actor DBUser, action string, nodeID int, format string, args ...interface{}) error {
+	var userID int
+	var username string
+	if actor != nil {
+		userID = actor.ID()
+		username = actor.Name()
+	}
+	var details = fmt.Sprintf(format, args...)
+	if tu, ok := actor.(TokenUser); ok {
+		details += " (API token " + tu.Token.Name + ")"
+	}
+	if err := c.AuditDB.InsertAuditEntry(time.Now().Unix(), userID, username, action, nodeID, details); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
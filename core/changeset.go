@@ -0,0 +1,266 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A DBChangeSet is a named set of versions of different nodes, which are released together.
+type DBChangeSet interface {
+	ID() int
+	Name() string
+	UserID() int // creator
+	TsCreated() int64
+	TsReleased() int64 // zero if the change set has not been released or has been rolled back
+}
+
+// A DBChangeSetItem refers to a version in a change set. A change set contains at most one version per node.
+type DBChangeSetItem interface {
+	NodeID() int
+	VersionNo() int
+	PrevGroupID() int // workflow group of the version before the change set was released
+}
+
+type ChangeSetDB interface {
+	DeleteChangeSet(id int) error
+	GetAllChangeSets() ([]DBChangeSet, error) // latest first
+	GetChangeSet(id int) (DBChangeSet, error)
+	GetChangeSetItems(changeSetID int) ([]DBChangeSetItem, error)
+	InsertChangeSet(name string, userID int, ts int64) error
+	PutChangeSetItem(changeSetID, nodeID, versionNo int) error // replaces the version of the node, if the node is in the change set already
+	RemoveChangeSetItem(changeSetID, nodeID int) error
+	SetChangeSetReleased(changeSetID int, ts int64, prevGroupIDs map[int]int) error // node id -> workflow group id, is ignored if ts is zero, returns ErrChangeSetState if the change set is released already (ts != 0) or not released (ts == 0)
+}
+
+// ErrChangeSetState is returned if a change set has been released or rolled back in the meantime.
+var ErrChangeSetState = errors.New("change set has been released or rolled back in the meantime")
+
+// InsertChangeSet shadows ChangeSetDB.InsertChangeSet.
+func (c *CoreDB) InsertChangeSet(actor DBUser, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name can't be empty")
+	}
+	if err := c.ChangeSetDB.InsertChangeSet(name, actor.ID(), time.Now().Unix()); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditInsertChangeSet, 0, "%s", name)
+}
+
+// DeleteChangeSet shadows ChangeSetDB.DeleteChangeSet.
+func (c *CoreDB) DeleteChangeSet(actor DBUser, cs DBChangeSet) error {
+	if err := c.ChangeSetDB.DeleteChangeSet(cs.ID()); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditDeleteChangeSet, 0, "%s", cs.Name())
+}
+
+// RemoveChangeSetItem shadows ChangeSetDB.RemoveChangeSetItem.
+func (c *CoreDB) RemoveChangeSetItem(actor DBUser, cs DBChangeSet, nodeID int) error {
+	if cs.TsReleased() != 0 {
+		return errors.New("change set has been released already")
+	}
+	if err := c.ChangeSetDB.RemoveChangeSetItem(cs.ID(), nodeID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRemoveChangeSetItem, nodeID, "%s: node %d", cs.Name(), nodeID)
+}
+
+// AddToChangeSet adds a version to a change set. The actor must be able to edit the node.
+func (c *CoreDB) AddToChangeSet(actor DBUser, cs DBChangeSet, n *Node, v DBVersion) error {
+
+	if cs.TsReleased() != 0 {
+		return errors.New("change set has been released already")
+	}
+
+	state, err := n.ReleaseState(v, actor)
+	if err != nil {
+		return err
+	}
+
+	if !state.CanEditNode() {
+		return ErrUnauthorized
+	}
+
+	return c.ChangeSetDB.PutChangeSetItem(cs.ID(), n.ID(), v.VersionNo())
+}
+
+// changeSetEntry is a change set item along with its node and version, opened by the actor.
+type changeSetEntry struct {
+	item    DBChangeSetItem
+	node    *Node
+	version *Version
+	state   ReleaseState
+}
+
+func (c *CoreDB) openChangeSet(actor DBUser, cs DBChangeSet) ([]changeSetEntry, error) {
+
+	items, err := c.ChangeSetDB.GetChangeSetItems(cs.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("change set is empty")
+	}
+
+	var entries = make([]changeSetEntry, len(items))
+
+	for i, item := range items {
+
+		path, err := c.InternalPathByNodeID(item.NodeID())
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := c.Open(actor, nil, NewQueue("/"+RootSlug+path))
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := n.GetVersion(item.VersionNo())
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := n.ReleaseState(v, actor)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[i] = changeSetEntry{item, n, v, state}
+	}
+
+	return entries, nil
+}
+
+// ReleaseChangeSet releases all versions of a change set in one transaction. The actor must be allowed to release each version to Readers.
+func (c *CoreDB) ReleaseChangeSet(actor DBUser, cs DBChangeSet) error {
+
+	if cs.TsReleased() != 0 {
+		return errors.New("change set has been released already")
+	}
+
+	entries, err := c.openChangeSet(actor, cs)
+	if err != nil {
+		return err
+	}
+
+	var changes = make([]WorkflowGroupChange, 0, len(entries))
+	var prevGroupIDs = make(map[int]int)
+
+	for _, e := range entries {
+		if !e.state.IsSaveGroup(0) {
+			return fmt.Errorf("you are not allowed to release %s", e.node.Location())
+		}
+		changes = append(changes, WorkflowGroupChange{e.node.DBNode, e.version, 0})
+		prevGroupIDs[e.node.ID()] = e.version.WorkflowGroupID()
+	}
+
+	// Recording the released state first ensures that the change set is released only once, even if the steps after the release fail.
+	if err := c.ChangeSetDB.SetChangeSetReleased(cs.ID(), time.Now().Unix(), prevGroupIDs); err != nil {
+		return err
+	}
+
+	return c.applyChangeSet(actor, entries, changes, fmt.Sprintf("change set %s", cs.Name()), func() error {
+		return c.ChangeSetDB.SetChangeSetReleased(cs.ID(), 0, nil)
+	})
+}
+
+// RollbackChangeSet reverts the workflow groups of all versions of a released change set in one transaction.
+func (c *CoreDB) RollbackChangeSet(actor DBUser, cs DBChangeSet) error {
+
+	if cs.TsReleased() == 0 {
+		return errors.New("change set has not been released")
+	}
+
+	entries, err := c.openChangeSet(actor, cs)
+	if err != nil {
+		return err
+	}
+
+	var changes = make([]WorkflowGroupChange, 0, len(entries))
+
+	for _, e := range entries {
+		if !e.state.IsSaveGroup(e.item.PrevGroupID()) {
+			return fmt.Errorf("you are not allowed to roll back %s", e.node.Location())
+		}
+		changes = append(changes, WorkflowGroupChange{e.node.DBNode, e.version, e.item.PrevGroupID()})
+	}
+
+	if err := c.ChangeSetDB.SetChangeSetReleased(cs.ID(), 0, nil); err != nil {
+		return err
+	}
+
+	return c.applyChangeSet(actor, entries, changes, fmt.Sprintf("rollback of change set %s", cs.Name()), func() error {
+		return c.ChangeSetDB.SetChangeSetReleased(cs.ID(), cs.TsReleased(), nil)
+	})
+}
+
+// applyChangeSet changes the workflow groups in one transaction. If that fails, it calls revert, which should undo the recorded state of the change set.
+// Then it does what CoreDB.SetWorkflowGroup does after the change. Those steps are done for all nodes, even if some of them fail, and the first error is returned.
+func (c *CoreDB) applyChangeSet(actor DBUser, entries []changeSetEntry, changes []WorkflowGroupChange, comment string, revert func() error) error {
+
+	var oldWorkflowGroups = make([]int, len(entries))
+	var oldMaxWGZeroVersionNos = make([]int, len(entries))
+	for i, e := range entries {
+		oldWorkflowGroups[i] = e.version.WorkflowGroupID()
+		oldMaxWGZeroVersionNos[i] = e.node.MaxWGZeroVersionNo()
+	}
+
+	if err := c.NodeDB.SetWorkflowGroups(changes); err != nil {
+		if revertErr := revert(); revertErr != nil {
+			return fmt.Errorf("%v, and reverting the state of the change set failed: %v", err, revertErr)
+		}
+		return err
+	}
+
+	var firstErr error
+	for i, e := range entries {
+		if oldWorkflowGroups[i] == changes[i].GroupID {
+			continue
+		}
+		if err := c.workflowGroupChanged(actor, e.node, e.version, oldWorkflowGroups[i], changes[i].GroupID, oldMaxWGZeroVersionNos[i], comment); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("the workflow groups have been changed, but updating %s failed: %v", e.node.Location(), err)
+		}
+	}
+
+	return firstErr
+}
+
+// PreviewChangeSet returns the change set which the user previews, or nil.
+func (req *Request) PreviewChangeSet() DBChangeSet {
+	return req.previewChangeSet
+}
+
+// previewVersionNo returns the number of the version of n which should be displayed.
+// This is the version in the previewed change set, if the user can edit the node, else the latest released version.
+func (req *Request) previewVersionNo(n *Node) int {
+	if versionNo, ok := req.previewItems[n.ID()]; ok {
+		if v, err := n.GetVersion(versionNo); err == nil {
+			if state, err := n.ReleaseState(v, req.User); err == nil && state.CanEditNode() {
+				return versionNo
+			}
+		}
+	}
+	return n.MaxWGZeroVersionNo()
+}
+
+// loadPreview loads the change set whose id is stored in the session.
+func (req *Request) loadPreview(changeSetID int) {
+	cs, err := req.db.ChangeSetDB.GetChangeSet(changeSetID)
+	if err != nil {
+		return
+	}
+	items, err := req.db.ChangeSetDB.GetChangeSetItems(changeSetID)
+	if err != nil {
+		return
+	}
+	req.previewChangeSet = cs
+	req.previewItems = make(map[int]int)
+	for _, item := range items {
+		req.previewItems[item.NodeID()] = item.VersionNo()
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// A DBComment is a review comment on a version. It can be anchored to a range of lines of the content.
+// The anchored lines are stored as an excerpt, because comments are carried along to subsequent versions.
+type DBComment interface {
+	ID() int
+	VersionNo() int
+	UserID() int
+	Username() string // stored redundantly, so the comment remains meaningful if the user is deleted
+	Ts() int64
+	LineFrom() int // zero if the comment is not anchored
+	LineTo() int   // zero if the comment is not anchored
+	Excerpt() string
+	Text() string
+}
+
+type CommentDB interface {
+	CopyComments(nodeID, fromVersionNo, toVersionNo int) error
+	DeleteComments(nodeID int) error
+	GetComments(nodeID, versionNo int) ([]DBComment, error) // chronologically ascending
+	InsertComment(nodeID, versionNo, userID int, username string, ts int64, lineFrom, lineTo int, excerpt, text string) error
+}
+
+// AddComment adds a review comment to a version. Checking permissions is up to the caller.
+// If lineFrom and lineTo are zero, the comment is not anchored.
+func (c *CoreDB) AddComment(actor DBUser, n *Node, v DBVersion, lineFrom, lineTo int, text string) error {
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("comment can't be empty")
+	}
+
+	var excerpt string
+	if lineFrom != 0 || lineTo != 0 {
+		if lineTo == 0 {
+			lineTo = lineFrom
+		}
+		var lines = strings.Split(v.Content(), "\n")
+		if lineFrom < 1 || lineTo < lineFrom || lineTo > len(lines) {
+			return errors.New("invalid line range")
+		}
+		excerpt = strings.Join(lines[lineFrom-1:lineTo], "\n")
+	}
+
+	return c.CommentDB.InsertComment(n.ID(), v.VersionNo(), actor.ID(), actor.Name(), time.Now().Unix(), lineFrom, lineTo, excerpt, text)
+}
+
+// GetComments returns the review comments of a version.
+func (n *Node) GetComments(v DBVersionStub) ([]DBComment, error) {
+	return n.db.CommentDB.GetComments(n.ID(), v.VersionNo())
+}
@@ -5,30 +5,51 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/wansing/perspective/filestore"
+	"github.com/wansing/perspective/mail"
 	"github.com/wansing/perspective/upload"
 	"github.com/wansing/perspective/util"
 )
 
 type CoreDB struct {
 	AccessDB
+	APITokenDB
+	ApprovalDB
+	AuditDB
+	ChangeSetDB
 	ClassRegistry
+	CommentDB
 	EditorsDB
 	GroupDB
+	GroupManagerDB
 	IndexDB
+	LockDB
+	LoginFailureDB
 	NodeDB
+	NotificationDB
+	PasswordTokenDB
+	RegistrationDB
+	SessionIndexDB
+	TOTPDB
+	TransitionDB
 	UserDB
 	WorkflowDB
 	SessionManager *scs.SessionManager
 	Uploads        upload.Store
+	Mailer         mail.Mailer // nil if emails are disabled
+	OIDC           *OIDCLogin  // nil if single sign-on is disabled
 
 	HMACSecret string  // exported because main sets it
 	SqlDB      *sql.DB // required for some classes
+	PublicURL  string  // used for links in emails, without trailing slash
+
+	TrustedProxies []*net.IPNet // X-Forwarded-For is read from requests of these reverse proxies, see ClientIP
 }
 
 func (c *CoreDB) Init(sessionStore scs.Store, cookiePath string) error {
@@ -39,17 +60,17 @@ func (c *CoreDB) Init(sessionStore scs.Store, cookiePath string) error {
 		if err == nil {
 			log.Println("generating random HMAC secret")
 		} else {
-			return fmt.Errorf("error generating random HMAC secret: %v")
+			return fmt.Errorf("error generating random HMAC secret: %v", err)
 		}
 	}
 
 	c.SessionManager = scs.New()
 	c.SessionManager.Store = sessionStore
 	c.SessionManager.Cookie.Path = cookiePath + "/"         // 'The default value is "/". Passing the empty string "" will result in it being set to the path that the cookie was issued from.'
-	c.SessionManager.Cookie.Persist = false                 // Don't store cookie across browser sessions. Required for GDPR cookie consent exemption criterion B. https://ec.europa.eu/justice/article-29/documentation/opinion-recommendation/files/2012/wp194_en.pdf
-	c.SessionManager.Cookie.SameSite = http.SameSiteLaxMode // good CSRF protection if HTTP GET doesn't modify anything
+	c.SessionManager.Cookie.Persist = false                 // Don't store cookie across browser sessions. "Remember me" uses a separate cookie, see startSession. Required for GDPR cookie consent exemption criterion B. https://ec.europa.eu/justice/article-29/documentation/opinion-recommendation/files/2012/wp194_en.pdf
+	c.SessionManager.Cookie.SameSite = http.SameSiteLaxMode // good CSRF protection if HTTP GET doesn't modify anything, in addition to the synchronizer tokens of the backend
 	c.SessionManager.Cookie.Secure = false                  // else running on localhost or behind a http proxy fails
-	c.SessionManager.IdleTimeout = 12 * time.Hour
+	c.SessionManager.IdleTimeout = sessionIdleTimeout
 	c.SessionManager.Lifetime = 720 * time.Hour
 
 	resizer, err := filestore.FindResizer()
@@ -70,26 +91,40 @@ func (c *CoreDB) Init(sessionStore scs.Store, cookiePath string) error {
 }
 
 // AddAccessRule shadows AccessDB.InsertAccessRule.
-func (c *CoreDB) AddAccessRule(e *Node, groupID int, perm Permission) error {
+func (c *CoreDB) AddAccessRule(actor DBUser, e *Node, groupID int, perm Permission, validity Validity) error {
 	var group, err = c.GetGroup(groupID)
 	if err != nil {
 		return err
 	}
-	return c.AccessDB.InsertAccessRule(e.ID(), group.ID(), int(perm))
+	if err := c.AccessDB.InsertAccessRule(e.ID(), group.ID(), int(perm), validity); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditAddAccessRule, e.ID(), "%s: %s %s%s", e.Location(), group.Name(), perm, validity.suffix())
 }
 
 // RemoveAccessRule shadows AccessDB.RemoveAccessRule.
-func (c *CoreDB) RemoveAccessRule(e *Node, groupID int) error {
+func (c *CoreDB) RemoveAccessRule(actor DBUser, e *Node, groupID int) error {
 	// not checking if the group exists because not a lot can go wrong
-	return c.AccessDB.RemoveAccessRule(e.ID(), groupID)
+	if err := c.AccessDB.RemoveAccessRule(e.ID(), groupID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRemoveAccessRule, e.ID(), "%s: group %d", e.Location(), groupID)
 }
 
 // Edit adds a version to the receiver node.
-func (c *CoreDB) Edit(n *Node, v DBVersion, newContent, newVersionNote, username string, workflowGroupID int) error {
+func (c *CoreDB) Edit(actor DBUser, n *Node, v DBVersion, newContent, newVersionNote string, workflowGroupID int) error {
 	if v.Content() != newContent {
-		if err := c.AddVersion(n.DBNode, newContent, fmt.Sprintf("[%s] %s", username, strings.TrimSpace(newVersionNote)), workflowGroupID); err != nil {
+		if err := c.AddVersion(n.DBNode, newContent, fmt.Sprintf("[%s] %s", actor.Name(), strings.TrimSpace(newVersionNote)), workflowGroupID); err != nil {
 			return err
 		}
+		if v.VersionNo() != 0 {
+			// carry review comments along to the new version
+			if err := c.CommentDB.CopyComments(n.ID(), v.VersionNo(), n.MaxVersionNo()); err != nil {
+				return err
+			}
+		}
+		c.notifyWorkflowGroup(actor, n, n.MaxVersionNo(), workflowGroupID, newVersionNote)
+		return c.audit(actor, AuditEdit, n.ID(), "%s: version %d, workflow group %d", n.Location(), n.MaxVersionNo(), workflowGroupID)
 	}
 	return nil
 }
@@ -149,7 +184,11 @@ func (c *CoreDB) internalPathByNodeID(id int, maxDepth int) (string, error) {
 	return "/" + strings.Join(slugs, "/"), nil
 }
 
+// errDenied is returned by requireRule if a rule with permission None applies to the user.
+var errDenied = errors.New("denied")
+
 // requireRule checks if a node with a given id has a rule which gives permission to the user.
+// If no rule gives permission, but a rule with permission None applies to one of the groups of the user, then errDenied is returned.
 // If permittingRules is not nil, then it is populated.
 func (c *CoreDB) requireRule(required Permission, nodeID int, u DBUser, permittingRules *map[int]map[int]interface{}) error {
 
@@ -157,12 +196,16 @@ func (c *CoreDB) requireRule(required Permission, nodeID int, u DBUser, permitti
 		return ErrUnauthorized
 	}
 
+	if !tokenAllows(u, required, nil) {
+		return ErrUnauthorized
+	}
+
 	// don't check for Edit because that is not a Permission
 
 	var err error
 	var groups []DBGroup
 	if u != nil {
-		groups, err = c.GroupDB.GetGroupsOf(u)
+		groups, err = c.groupsOf(u)
 		if err != nil {
 			return err
 		}
@@ -174,12 +217,17 @@ func (c *CoreDB) requireRule(required Permission, nodeID int, u DBUser, permitti
 		return err
 	}
 
+	var denied = false
+
 	for _, group := range groups {
 		if myPermission, ok := nodeRules[group.ID()]; ok {
 			var myPerm = Permission(myPermission)
 			if !myPerm.Valid() {
 				return errors.New("invalid permission")
 			}
+			if myPerm == None {
+				denied = true
+			}
 			if myPerm >= required {
 				if permittingRules != nil {
 					if (*permittingRules)[nodeID] == nil {
@@ -197,6 +245,10 @@ func (c *CoreDB) requireRule(required Permission, nodeID int, u DBUser, permitti
 		return nil
 	}
 
+	if denied {
+		return errDenied
+	}
+
 	return ErrUnauthorized
 }
 
@@ -234,8 +286,43 @@ func (c *CoreDB) Open(user DBUser, parent *Node, queue *Queue) (*Node, error) {
 	return c.Open(user, n, queue)
 }
 
+// SetInheritanceBlocked shadows AccessDB.SetInheritanceBlocked.
+func (c *CoreDB) SetInheritanceBlocked(actor DBUser, e *Node, blocked bool) error {
+	if e.Parent == nil {
+		return errors.New("root node has no ancestors to inherit from")
+	}
+	if err := c.AccessDB.SetInheritanceBlocked(e.ID(), blocked); err != nil {
+		return err
+	}
+	var what = "inherit"
+	if blocked {
+		what = "block"
+	}
+	return c.audit(actor, AuditSetInheritance, e.ID(), "%s: %s", e.Location(), what)
+}
+
+// DeleteNode shadows NodeDB.DeleteNode.
+func (c *CoreDB) DeleteNode(actor DBUser, n *Node) error {
+	if err := c.NodeDB.DeleteNode(n.DBNode); err != nil {
+		return err
+	}
+	if err := c.TransitionDB.DeleteTransitions(n.ID()); err != nil {
+		return err
+	}
+	if err := c.CommentDB.DeleteComments(n.ID()); err != nil {
+		return err
+	}
+	if err := c.ApprovalDB.DeleteApprovals(n.ID()); err != nil {
+		return err
+	}
+	if err := c.AccessDB.SetInheritanceBlocked(n.ID(), false); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditDeleteNode, n.ID(), "%s", n.Location())
+}
+
 // SetClass shadows NodeDB.SetClass.
-func (c *CoreDB) SetClass(n *Node, classCode string) error {
+func (c *CoreDB) SetClass(actor DBUser, n *Node, classCode string) error {
 	classCode = strings.TrimSpace(classCode)
 	if classCode == "" {
 		return errors.New("class can't be empty")
@@ -243,11 +330,15 @@ func (c *CoreDB) SetClass(n *Node, classCode string) error {
 	if _, ok := c.ClassRegistry.Get(classCode); !ok {
 		return fmt.Errorf("class %s not found", classCode)
 	}
-	return c.NodeDB.SetClass(n.DBNode, classCode)
+	var oldClassCode = n.ClassCode()
+	if err := c.NodeDB.SetClass(n.DBNode, classCode); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditSetClass, n.ID(), "%s: %s to %s", n.Location(), oldClassCode, classCode)
 }
 
 // SetParent shadows NodeDB.SetParent.
-func (c *CoreDB) SetParent(n *Node, newParent *Node) error {
+func (c *CoreDB) SetParent(actor DBUser, n *Node, newParent *Node) error {
 
 	if n.Parent == nil {
 		return errors.New("can't move root node")
@@ -269,38 +360,64 @@ func (c *CoreDB) SetParent(n *Node, newParent *Node) error {
 		return err
 	}
 
+	var oldLocation = n.Location()
 	n.Parent = newParent
-	return nil
+	return c.audit(actor, AuditSetParent, n.ID(), "%s to %s", oldLocation, n.Location())
 }
 
 // SetSlug shadows NodeDB.SetSlug.
 // It does not care for duplicated slugs, the database must prevent them.
-func (c *CoreDB) SetSlug(n *Node, slug string) error {
+func (c *CoreDB) SetSlug(actor DBUser, n *Node, slug string) error {
 	slug = NormalizeSlug(slug)
 	if slug == "" {
 		return errors.New("slug can't be empty")
 	}
-	return c.NodeDB.SetSlug(n.DBNode, slug)
+	var oldLocation = n.Location()
+	if err := c.NodeDB.SetSlug(n.DBNode, slug); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditSetSlug, n.ID(), "%s to %s", oldLocation, n.Location())
 }
 
-// SetWorkflowGroup shadows NodeDB.SetWorkflowGroup.
-func (c *CoreDB) SetWorkflowGroup(n *Node, v *Version, newWorkflowGroup int) error {
+// SetWorkflowGroup shadows NodeDB.SetWorkflowGroup. It records the transition along with an optional comment.
+func (c *CoreDB) SetWorkflowGroup(actor DBUser, n *Node, v *Version, newWorkflowGroup int, comment string) error {
 
 	if v.WorkflowGroupID() == newWorkflowGroup {
 		return nil
 	}
 
+	var oldWorkflowGroup = v.WorkflowGroupID()
 	var oldMaxWGZeroVersionNo = n.MaxWGZeroVersionNo()
 
 	if err := c.NodeDB.SetWorkflowGroup(n.DBNode, v, newWorkflowGroup); err != nil {
 		return err
 	}
 
+	return c.workflowGroupChanged(actor, n, v, oldWorkflowGroup, newWorkflowGroup, oldMaxWGZeroVersionNo, comment)
+}
+
+// workflowGroupChanged is called after the workflow group of a version has been changed in the NodeDB.
+// It records the transition, updates the index if the released version has changed, and notifies the new workflow group.
+func (c *CoreDB) workflowGroupChanged(actor DBUser, n *Node, v *Version, oldWorkflowGroup, newWorkflowGroup, oldMaxWGZeroVersionNo int, comment string) error {
+
+	if err := c.TransitionDB.InsertTransition(n.ID(), v.VersionNo(), oldWorkflowGroup, newWorkflowGroup, actor.ID(), actor.Name(), time.Now().Unix(), strings.TrimSpace(comment)); err != nil {
+		return err
+	}
+
+	// approvals refer to the previous workflow group
+	if err := c.ApprovalDB.ClearApprovals(n.ID(), v.VersionNo()); err != nil {
+		return err
+	}
+
 	if oldMaxWGZeroVersionNo != n.MaxWGZeroVersionNo() { // if maxWGZeroVersionNo has changed
 
-		v, err := n.GetVersion(n.MaxWGZeroVersionNo())
-		if err != nil {
-			return err
+		var v = NewVersion(NoVersion{}) // if the last released version has been revoked, tags and timestamps are cleared
+		if n.MaxWGZeroVersionNo() != 0 {
+			var err error
+			v, err = n.GetVersion(n.MaxWGZeroVersionNo())
+			if err != nil {
+				return err
+			}
 		}
 
 		var tmpRequest = newDummyRequest()
@@ -326,15 +443,23 @@ func (c *CoreDB) SetWorkflowGroup(n *Node, v *Version, newWorkflowGroup int) err
 		}
 	}
 
-	return nil
+	c.notifyWorkflowGroup(actor, n, v.VersionNo(), newWorkflowGroup, comment)
+
+	return c.audit(actor, AuditSetWorkflowGroup, n.ID(), "%s: version %d from group %d to group %d", n.Location(), v.VersionNo(), oldWorkflowGroup, newWorkflowGroup)
 }
 
 // AssignWorkflow shadows EditorsDB.AssignWorkflow.
-func (c *CoreDB) AssignWorkflow(n *Node, childrenOnly bool, workflowID int) error {
-	return c.EditorsDB.AssignWorkflowID(n.ID(), childrenOnly, workflowID)
+func (c *CoreDB) AssignWorkflow(actor DBUser, n *Node, childrenOnly bool, workflowID int) error {
+	if err := c.EditorsDB.AssignWorkflowID(n.ID(), childrenOnly, workflowID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditAssignWorkflow, n.ID(), "%s: workflow %d, children only: %t", n.Location(), workflowID, childrenOnly)
 }
 
 // UnassignWorkflow shadows EditorsDB.UnassignWorkflow.
-func (c *CoreDB) UnassignWorkflow(n *Node, childrenOnly bool) error {
-	return c.EditorsDB.UnassignWorkflow(n.ID(), childrenOnly)
+func (c *CoreDB) UnassignWorkflow(actor DBUser, n *Node, childrenOnly bool) error {
+	if err := c.EditorsDB.UnassignWorkflow(n.ID(), childrenOnly); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditUnassignWorkflow, n.ID(), "%s: children only: %t", n.Location(), childrenOnly)
 }
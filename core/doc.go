@@ -12,12 +12,29 @@ When a member of the last group releases a version, its workflow group becomes "
 
   Example Workflow: economics department, editorial department, image team, editor-in-chief
 
-Different Workflow Models
+Workflow Models
 
-Workflows could be considered a democratic tool, where one member of every workflow group has to confirm every content change.
+Each workflow follows one of these models. ReleaseState is implemented for each of them.
 
-Workflows could be designed to represent work steps which have to be done by each group. Versions could be passed back as far as needed, and passed to the next group if a work step is done.
+Subset model (default): workflows are understood in terms of accountability. Workflow groups are in a subset relation. Any member of the last workflow group can publish on their own.
 
-Workflows could be understood in terms of accountability. Workflow groups would be in a subset relation. Any member of the last workflow group could publish on their own.
+Work step model: workflows represent work steps which have to be done by each group. Members of the current workflow group pass a version to the next group if their work step is done, or back to the previous group.
+
+Approval model: workflows are considered a democratic tool. Like in the work step model, but a configurable number of members of the current workflow group must approve a version before it is passed to the next group.
+
+Access Rules
+
+An access rule gives a permission on a node and its descendants to a group. Permissions are checked from the node up to the root:
+
+  1. If a rule of any group of the user on the current node gives the permission, it is granted.
+  2. Else if a rule of any group of the user on the current node has the permission "none", it is denied.
+  3. Else if the current node blocks inheritance, it is denied.
+  4. Else the parent node is checked.
+
+So rules of different groups on the same node add up, a closer rule takes precedence over a more distant rule, and "none" or an inheritance block restricts a subtree.
+Admin rules on the root node apply everywhere, so root admins can't lock themselves out.
+Members of workflow groups can read the node in any case, because they edit it.
+
+Access rules and group memberships can have a validity. Outside of it, they are ignored. Expired ones are deleted after a retention period.
 */
 package core
@@ -0,0 +1,381 @@
+package core
+
+import (
+	"sort"
+)
+
+// A Grant is the reason why someone has a permission: either an access rule or a workflow.
+type Grant struct {
+	Location     string    // location of the node which has the rule or the workflow assignment, empty if unknown
+	Group        DBGroup   // group of the access rule, nil if the grant is a workflow
+	Workflow     *Workflow // workflow whose groups can read and edit, nil if the grant is an access rule
+	ChildrenOnly bool      // workflow is assigned to descendant nodes only
+}
+
+// An EffectivePermission is the highest permission which a user or a group has on a node, along with the grants which cause it.
+// If the user or group has no permission, Permission is None and Grants is empty.
+type EffectivePermission struct {
+	Permission Permission
+	Grants     []Grant
+	CanEdit    bool // member of a workflow group, which implies Read
+}
+
+// A UserPermission is the effective permission of a user. User is Guest{} for visitors who are not logged in, and OtherUsers{} for users who are not listed.
+type UserPermission struct {
+	EffectivePermission
+	User DBUser
+}
+
+// A GroupPermission is the effective permission of a group, not considering other groups of its members.
+type GroupPermission struct {
+	EffectivePermission
+	Group DBGroup
+}
+
+// descendingPermissions are the permissions which are checked for the effective permission.
+var descendingPermissions = []Permission{Admin, Remove, Create, Read}
+
+// OtherUsers stands for logged-in users who are not a member of any group in GroupPermissions. Only the rules for all users apply to them, so they share one entry in UserPermissions.
+type OtherUsers struct{}
+
+func (OtherUsers) ID() int {
+	return -1 // not zero, else it would be a guest
+}
+
+func (OtherUsers) Name() string {
+	return "other users"
+}
+
+// UserPermissions returns the effective permissions of guests, of other users and of the members of all groups in GroupPermissions on the node, in this order.
+// Other users can't be affected by rules of their groups, so checking only the members of these groups is sufficient.
+func (c *CoreDB) UserPermissions(n *Node) ([]UserPermission, error) {
+
+	groupPermissions, err := c.GroupPermissions(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs = make(map[int]interface{})
+	for _, gp := range groupPermissions {
+		if gp.Group.ID() == 0 { // all users
+			continue
+		}
+		members, err := gp.Group.Members()
+		if err != nil {
+			return nil, err
+		}
+		for id := range members {
+			userIDs[id] = struct{}{}
+		}
+	}
+
+	var users = make([]DBUser, 0, len(userIDs))
+	for id := range userIDs {
+		if u, err := c.UserDB.GetUser(id); err == nil { // skip deleted users
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name() < users[j].Name()
+	})
+
+	var result = make([]UserPermission, 0, len(users)+2)
+
+	for _, u := range append([]DBUser{nil, OtherUsers{}}, users...) {
+		ep, err := c.userPermission(n, u)
+		if err != nil {
+			return nil, err
+		}
+		var up = UserPermission{
+			EffectivePermission: ep,
+			User:                u,
+		}
+		if u == nil {
+			up.User = Guest{}
+		}
+		result = append(result, up)
+	}
+
+	return result, nil
+}
+
+// userPermission determines the effective permission using RequirePermissionRules, so it is consistent with the actual checks.
+func (c *CoreDB) userPermission(n *Node, u DBUser) (EffectivePermission, error) {
+
+	var ep = EffectivePermission{Permission: None}
+
+	for _, perm := range descendingPermissions {
+		rules, err := n.RequirePermissionRules(perm, u)
+		if err != nil || len(rules) == 0 {
+			continue // an empty result means that the permission is granted by a workflow, see below
+		}
+		ep.Permission = perm
+		for nodeID, groupIDs := range rules {
+			location, err := c.InternalPathByNodeID(nodeID)
+			if err != nil {
+				return ep, err
+			}
+			for groupID := range groupIDs {
+				group, err := c.GetGroup(groupID)
+				if err != nil {
+					return ep, err
+				}
+				ep.Grants = append(ep.Grants, Grant{
+					Location: location,
+					Group:    group,
+				})
+			}
+		}
+		break
+	}
+
+	sortGrants(ep.Grants)
+
+	if u != nil {
+		workflow, isMember, err := c.workflowMembership(n, u)
+		if err != nil {
+			return ep, err
+		}
+		if isMember {
+			ep.CanEdit = true
+			ep.Grants = append(ep.Grants, Grant{Workflow: workflow})
+			if ep.Permission < Read {
+				ep.Permission = Read
+			}
+		}
+	}
+
+	return ep, nil
+}
+
+// workflowMembership returns the workflow of the node and whether the user is a member of any of its groups.
+func (c *CoreDB) workflowMembership(n *Node, u DBUser) (*Workflow, bool, error) {
+
+	workflow, err := n.GetWorkflow()
+	if err != nil {
+		return nil, false, nil // no workflow
+	}
+
+	groups, err := workflow.Groups()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, group := range groups {
+		isMember, err := group.HasMember(u)
+		if err != nil {
+			return nil, false, err
+		}
+		if isMember {
+			return workflow, true, nil
+		}
+	}
+
+	return workflow, false, nil
+}
+
+// GroupPermissions returns the effective permissions of all groups which have an access rule on the node or its ancestors, or which are part of the workflow of the node.
+// Deny rules and inheritance blocks are considered like in Node.RequirePermission.
+func (c *CoreDB) GroupPermissions(n *Node) ([]GroupPermission, error) {
+
+	var byID = make(map[int]*GroupPermission)
+	var get = func(group DBGroup) *GroupPermission {
+		gp, ok := byID[group.ID()]
+		if !ok {
+			gp = &GroupPermission{Group: group}
+			byID[group.ID()] = gp
+		}
+		return gp
+	}
+
+	var denied = make(map[int]bool) // group id -> a rule with permission None has been found
+
+	for p := n; p != nil; p = p.Parent {
+
+		rules, err := p.GetAssignedRules()
+		if err != nil {
+			return nil, err
+		}
+
+		for group, perm := range rules {
+			if denied[group.ID()] {
+				continue
+			}
+			var gp = get(group)
+			if perm == None {
+				denied[group.ID()] = true
+				if gp.Permission == 0 {
+					gp.Permission = None
+					gp.Grants = []Grant{{Location: p.Location(), Group: group}}
+				}
+				continue
+			}
+			if perm > gp.Permission {
+				gp.Permission = perm
+				gp.Grants = nil
+			}
+			if perm == gp.Permission {
+				gp.Grants = append(gp.Grants, Grant{
+					Location: p.Location(),
+					Group:    group,
+				})
+			}
+		}
+
+		blocked, err := c.IsInheritanceBlocked(p.ID())
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			break
+		}
+	}
+
+	// admin rules of the root node apply everywhere
+
+	rootRules, err := c.GetAccessRules(RootID)
+	if err != nil {
+		return nil, err
+	}
+
+	for groupID, perm := range rootRules {
+		if Permission(perm) != Admin {
+			continue
+		}
+		group, err := c.GetGroup(groupID)
+		if err != nil {
+			return nil, err
+		}
+		if gp := get(group); gp.Permission < Admin {
+			gp.Permission = Admin
+			gp.Grants = []Grant{{Location: "/", Group: group}}
+		}
+	}
+
+	if workflow, err := n.GetWorkflow(); err == nil {
+		groups, err := workflow.Groups()
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			var gp = get(group)
+			gp.CanEdit = true
+			gp.Grants = append(gp.Grants, Grant{Workflow: workflow})
+			if gp.Permission < Read {
+				gp.Permission = Read
+			}
+		}
+	}
+
+	var result = make([]GroupPermission, 0, len(byID))
+	for _, gp := range byID {
+		result = append(result, *gp)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Group.ID() < result[j].Group.ID()
+	})
+
+	return result, nil
+}
+
+// A SubtreePermission is a permission which a user has on a node and its descendants (or only its descendants, if ChildrenOnly is set).
+type SubtreePermission struct {
+	Grant
+	Permission Permission
+	CanEdit    bool
+}
+
+// SubtreePermissions returns the subtrees which the user can access, because of access rules of the groups of the user, or because the user is a member of a workflow group.
+// Rules with permission None are included, because they restrict the subtree. Inheritance blocks are not considered.
+func (c *CoreDB) SubtreePermissions(u DBUser) ([]SubtreePermission, error) {
+
+	groups, err := c.GroupDB.GetGroupsOf(u)
+	if err != nil {
+		return nil, err
+	}
+	groups = append(groups, AllUsers{})
+
+	allRules, err := c.GetAllAccessRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []SubtreePermission{}
+
+	for nodeID, nodeRules := range allRules {
+		for _, group := range groups {
+			permInt, ok := nodeRules[group.ID()]
+			if !ok {
+				continue
+			}
+			location, err := c.InternalPathByNodeID(nodeID)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, SubtreePermission{
+				Grant: Grant{
+					Location: location,
+					Group:    group,
+				},
+				Permission: Permission(permInt),
+			})
+		}
+	}
+
+	assignments, err := c.GetAllWorkflowAssignments()
+	if err != nil {
+		return nil, err
+	}
+
+	for nodeID, nodeAssignments := range assignments {
+		for childrenOnly, workflow := range nodeAssignments {
+			wfGroups, err := workflow.Groups()
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range wfGroups {
+				isMember, err := group.HasMember(u)
+				if err != nil {
+					return nil, err
+				}
+				if !isMember {
+					continue
+				}
+				location, err := c.InternalPathByNodeID(nodeID)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, SubtreePermission{
+					Grant: Grant{
+						Location:     location,
+						Workflow:     workflow,
+						ChildrenOnly: childrenOnly,
+					},
+					Permission: Read,
+					CanEdit:    true,
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Location == result[j].Location {
+			return result[i].Permission > result[j].Permission
+		}
+		return result[i].Location < result[j].Location
+	})
+
+	return result, nil
+}
+
+// sortGrants sorts grants by location and group id.
+func sortGrants(grants []Grant) {
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Location == grants[j].Location {
+			return grants[i].Group.ID() < grants[j].Group.ID()
+		}
+		return grants[i].Location < grants[j].Location
+	})
+}
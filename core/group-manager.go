@@ -0,0 +1,79 @@
+package core
+
+// A GroupManagerDB stores the managers of groups. Managers can add and remove members of their groups without being root admins.
+type GroupManagerDB interface {
+	AddGroupManager(groupID, userID int) error
+	GetGroupManagers(groupID int) ([]int, error) // user ids
+	GetManagedGroups(userID int) ([]int, error)  // group ids
+	RemoveGroupManager(groupID, userID int) error
+}
+
+// AddGroupManager shadows GroupManagerDB.AddGroupManager.
+func (c *CoreDB) AddGroupManager(actor DBUser, g DBGroup, u DBUser) error {
+	if err := c.GroupManagerDB.AddGroupManager(g.ID(), u.ID()); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditAddGroupManager, 0, "%s manages %s", u.Name(), g.Name())
+}
+
+// RemoveGroupManager shadows GroupManagerDB.RemoveGroupManager.
+func (c *CoreDB) RemoveGroupManager(actor DBUser, g DBGroup, u DBUser) error {
+	if err := c.GroupManagerDB.RemoveGroupManager(g.ID(), u.ID()); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRemoveGroupManager, 0, "%s no longer manages %s", u.Name(), g.Name())
+}
+
+// GetGroupManagers returns the managers of the group. Users which have been deleted are skipped.
+func (c *CoreDB) GetGroupManagers(g DBGroup) ([]DBUser, error) {
+	ids, err := c.GroupManagerDB.GetGroupManagers(g.ID())
+	if err != nil {
+		return nil, err
+	}
+	var managers = []DBUser{}
+	for _, id := range ids {
+		if u, err := c.UserDB.GetUser(id); err == nil {
+			managers = append(managers, u)
+		}
+	}
+	return managers, nil
+}
+
+// ManagedGroups returns the groups which the user manages. Groups which have been deleted are skipped.
+// API tokens must have the admin scope and must not be limited to a subtree.
+func (req *Request) ManagedGroups() ([]DBGroup, error) {
+	if !req.LoggedIn() {
+		return nil, nil
+	}
+	if t := req.APIToken(); t != nil && (!t.WholeSite() || t.Scope != ScopeAdmin) {
+		return nil, nil
+	}
+	ids, err := req.db.GroupManagerDB.GetManagedGroups(req.User.ID())
+	if err != nil {
+		return nil, err
+	}
+	var groups = []DBGroup{}
+	for _, id := range ids {
+		if g, err := req.db.GroupDB.GetGroup(id); err == nil {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// CanManageGroup returns whether the user can add and remove members of the group. That applies to root admins and to the managers of the group.
+func (req *Request) CanManageGroup(g DBGroup) (bool, error) {
+	if req.IsRootAdmin() {
+		return true, nil
+	}
+	managed, err := req.ManagedGroups()
+	if err != nil {
+		return false, err
+	}
+	for _, m := range managed {
+		if m.ID() == g.ID() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
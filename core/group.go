@@ -1,21 +1,35 @@
 package core
 
+import (
+	"errors"
+	"fmt"
+)
+
+// A DBGroup is a set of users. Groups can contain other groups, which are called subgroups. Members of a subgroup are members of the group too.
 type DBGroup interface {
 	ID() int
 	Name() string
-	HasMember(u DBUser) (bool, error)
-	Members() (map[int]interface{}, error)
+	DirectMembers() (map[int]interface{}, error) // members which are not in the group just because of a subgroup
+	HasMember(u DBUser) (bool, error)            // considers subgroups
+	Members() (map[int]interface{}, error)       // considers subgroups
 }
 
+// GroupDB stores groups and memberships. Memberships whose validity does not include the current time are ignored, except by GetTimedMemberships.
 type GroupDB interface {
+	AddSubgroup(g, sub DBGroup) error
 	Delete(g DBGroup) error
+	DeleteExpiredMemberships(before int64) (int64, error) // returns the number of deleted memberships
 	GetAllGroups(limit, offset int) ([]DBGroup, error)
 	GetGroup(id int) (DBGroup, error)
 	GetGroupByName(name string) (DBGroup, error)
-	GetGroupsOf(u DBUser) ([]DBGroup, error)
+	GetGroupsOf(u DBUser) ([]DBGroup, error)                 // considers subgroups
+	GetSubgroups(g DBGroup) ([]DBGroup, error)               // direct subgroups only
+	GetSupergroups(g DBGroup) ([]DBGroup, error)             // groups which contain g, directly or indirectly
+	GetTimedMemberships(g DBGroup) (map[int]Validity, error) // user id -> validity, direct memberships with a limited validity only, including expired and future ones
 	InsertGroup(name string) error
-	Join(g DBGroup, u DBUser) error
+	Join(g DBGroup, u DBUser, validity Validity) error
 	Leave(g DBGroup, u DBUser) error
+	RemoveSubgroup(g, sub DBGroup) error
 	Writeable() bool
 }
 
@@ -27,6 +41,98 @@ func (c *CoreDB) GetGroup(id int) (DBGroup, error) {
 	return c.GroupDB.GetGroup(id)
 }
 
+// InsertGroup shadows GroupDB.InsertGroup.
+func (c *CoreDB) InsertGroup(actor DBUser, name string) error {
+	if err := c.GroupDB.InsertGroup(name); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditInsertGroup, 0, "%s", name)
+}
+
+// Join shadows GroupDB.Join.
+func (c *CoreDB) Join(actor DBUser, g DBGroup, u DBUser, validity Validity) error {
+	if err := c.GroupDB.Join(g, u, validity); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditJoin, 0, "%s joins %s%s", u.Name(), g.Name(), validity.suffix())
+}
+
+// Leave shadows GroupDB.Leave.
+func (c *CoreDB) Leave(actor DBUser, g DBGroup, u DBUser) error {
+	if err := c.GroupDB.Leave(g, u); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditLeave, 0, "%s leaves %s", u.Name(), g.Name())
+}
+
+// AddSubgroup shadows GroupDB.AddSubgroup. It prevents cycles.
+func (c *CoreDB) AddSubgroup(actor DBUser, g, sub DBGroup) error {
+	if g.ID() == sub.ID() {
+		return errors.New("a group can't contain itself")
+	}
+	supergroups, err := c.GroupDB.GetSupergroups(g)
+	if err != nil {
+		return err
+	}
+	for _, sg := range supergroups {
+		if sg.ID() == sub.ID() {
+			return fmt.Errorf("%s contains %s already, so this would create a cycle", sub.Name(), g.Name())
+		}
+	}
+	if err := c.GroupDB.AddSubgroup(g, sub); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditAddSubgroup, 0, "%s contains %s", g.Name(), sub.Name())
+}
+
+// RemoveSubgroup shadows GroupDB.RemoveSubgroup.
+func (c *CoreDB) RemoveSubgroup(actor DBUser, g, sub DBGroup) error {
+	if err := c.GroupDB.RemoveSubgroup(g, sub); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRemoveSubgroup, 0, "%s no longer contains %s", g.Name(), sub.Name())
+}
+
+// GrantsAdmin returns whether members of the group get Admin permission on any node, because the group or a group which contains it has an Admin rule.
+// Timed rules count regardless of their validity.
+func (c *CoreDB) GrantsAdmin(g DBGroup) (bool, error) {
+
+	var groupIDs = map[int]bool{g.ID(): true}
+	if g.ID() != 0 {
+		supergroups, err := c.GroupDB.GetSupergroups(g)
+		if err != nil {
+			return false, err
+		}
+		for _, sg := range supergroups {
+			groupIDs[sg.ID()] = true
+		}
+	}
+
+	rules, err := c.AccessDB.GetAllAccessRules()
+	if err != nil {
+		return false, err
+	}
+	for _, nodeRules := range rules {
+		for groupID, perm := range nodeRules {
+			if groupIDs[groupID] && Permission(perm) == Admin {
+				return true, nil
+			}
+		}
+	}
+
+	timedRules, err := c.AccessDB.GetTimedAccessRules()
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range timedRules {
+		if groupIDs[rule.GroupID] && Permission(rule.Permission) == Admin {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (c *CoreDB) GetGroupOrReaders(id int) (DBGroup, error) {
 	if id == 0 {
 		return Readers{}, nil
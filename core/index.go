@@ -11,11 +11,15 @@ type IndexDB interface {
 // SetTags calls IndexDB.SetTags using n.ParentID(), n.ID() and n.TsChanged().
 // Ensure that you set tsChanged before.
 func (n *Node) SetTags(tags []string) error {
-	v, err := n.GetVersion(n.MaxWGZeroVersionNo())
-	if err != nil {
-		return err
+	var tsChanged int64 // zero if no version is released
+	if n.MaxWGZeroVersionNo() != 0 {
+		v, err := n.GetVersion(n.MaxWGZeroVersionNo())
+		if err != nil {
+			return err
+		}
+		tsChanged = v.TsChanged()
 	}
-	return n.db.SetTags(n.ParentID(), n.ID(), v.TsChanged(), tags)
+	return n.db.SetTags(n.ParentID(), n.ID(), tsChanged, tags)
 }
 
 func (n *Node) SetTimestamps(timestamps []int64) error {
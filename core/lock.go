@@ -0,0 +1,91 @@
+package core
+
+import (
+	"time"
+)
+
+// LockTimeout is the time after which an edit lock expires if no heartbeat is received.
+const LockTimeout = 2 * time.Minute
+
+// A DBLock is an advisory edit lock. It tells other editors that someone is currently editing a node.
+type DBLock interface {
+	NodeID() int
+	UserID() int
+	TsAcquired() int64
+	TsHeartbeat() int64
+}
+
+// A LockDB stores at most one edit lock per node.
+type LockDB interface {
+	GetLock(nodeID int) (DBLock, error) // returns (nil, nil) if there is no lock
+	Heartbeat(nodeID int, userID int, now int64) error
+	RemoveLock(nodeID int) error
+	SetLock(nodeID int, userID int, now int64) error // replaces any existing lock
+}
+
+// Lock wraps DBLock and holds the user who has acquired the lock.
+type Lock struct {
+	DBLock
+	User DBUser
+}
+
+func (l *Lock) expired(now int64) bool {
+	return l.TsHeartbeat() < now-int64(LockTimeout/time.Second)
+}
+
+// GetLock returns the active edit lock of the node, or nil if there is none or if it has expired.
+func (c *CoreDB) GetLock(n *Node) (*Lock, error) {
+	var dbLock, err = c.LockDB.GetLock(n.ID())
+	if err != nil {
+		return nil, err
+	}
+	if dbLock == nil {
+		return nil, nil
+	}
+	var lock = &Lock{
+		DBLock: dbLock,
+	}
+	if lock.expired(time.Now().Unix()) {
+		return nil, nil
+	}
+	lock.User, err = c.UserDB.GetUser(dbLock.UserID())
+	if err != nil {
+		lock.User = Guest{} // user has been deleted in the meantime
+	}
+	return lock, nil
+}
+
+// AcquireLock acquires the edit lock of the node for the given user, or refreshes it if the user already holds it.
+// If another user holds an active lock, it is returned and nothing is changed.
+// Else the returned Lock is nil.
+func (c *CoreDB) AcquireLock(n *Node, u DBUser) (*Lock, error) {
+	var lock, err = c.GetLock(n)
+	if err != nil {
+		return nil, err
+	}
+	var now = time.Now().Unix()
+	if lock == nil {
+		return nil, c.LockDB.SetLock(n.ID(), u.ID(), now)
+	}
+	if lock.UserID() == u.ID() {
+		return nil, c.LockDB.Heartbeat(n.ID(), u.ID(), now)
+	}
+	return lock, nil
+}
+
+// BreakLock removes any edit lock of the node. Checking permissions is up to the caller.
+func (c *CoreDB) BreakLock(n *Node) error {
+	return c.LockDB.RemoveLock(n.ID())
+}
+
+// ReleaseLock removes the edit lock of the node if it is held by the given user.
+func (c *CoreDB) ReleaseLock(n *Node, u DBUser) error {
+	var lock, err = c.GetLock(n)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.UserID() == u.ID() {
+		return c.LockDB.RemoveLock(n.ID())
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// A LoginFailure is the number of consecutive failed logins of an account or from an IP address.
+type LoginFailure struct {
+	Key    string // "account:<name>" or "ip:<address>"
+	Count  int
+	LastTs int64
+}
+
+// A LoginFailureDB stores failed logins, so throttling works across restarts.
+type LoginFailureDB interface {
+	DeleteLoginFailure(key string) error
+	DeleteLoginFailuresBefore(ts int64) error
+	GetLoginFailure(key string) (LoginFailure, error) // returns a zero Count if there is none
+	GetLoginFailures() ([]LoginFailure, error)        // ordered by LastTs, descending
+	RecordLoginFailure(key string, ts int64) error    // increments Count and sets LastTs
+}
+
+// A loginLimit defines the throttling of a kind of key.
+type loginLimit struct {
+	free    int // failures without delay
+	lockout int // failures which cause a lockout
+}
+
+var (
+	accountLimit = loginLimit{free: 3, lockout: 10}
+	ipLimit      = loginLimit{free: 20, lockout: 100} // many users can share an IP address
+)
+
+const (
+	loginMaxBackoff     = 15 * time.Minute
+	loginLockout        = time.Hour
+	loginFailuresExpire = 24 * time.Hour // consecutive failures are forgotten after this time
+)
+
+// ErrLoginThrottled is returned if a login is attempted too early after failed logins.
+type ErrLoginThrottled struct {
+	Until time.Time
+}
+
+func (e ErrLoginThrottled) Error() string {
+	var wait = time.Until(e.Until).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("too many failed logins, please try again in %s", wait)
+}
+
+func (lf LoginFailure) limit() loginLimit {
+	if strings.HasPrefix(lf.Key, "ip:") {
+		return ipLimit
+	}
+	return accountLimit
+}
+
+// Locked returns whether the key is locked out.
+func (lf LoginFailure) Locked() bool {
+	return lf.Count >= lf.limit().lockout
+}
+
+// BlockedUntil returns the time until which logins are refused. It is zero if no failures are recorded.
+// The delay doubles with each failure after the free ones, up to loginMaxBackoff. After the lockout number of failures, the lockout duration applies.
+func (lf LoginFailure) BlockedUntil() time.Time {
+	var limit = lf.limit()
+	if lf.Count < limit.free {
+		return time.Time{}
+	}
+	var last = time.Unix(lf.LastTs, 0)
+	if lf.Count >= limit.lockout {
+		return last.Add(loginLockout)
+	}
+	var delay = loginMaxBackoff
+	if shift := lf.Count - limit.free; shift < 10 {
+		if d := time.Second << uint(shift); d < loginMaxBackoff {
+			delay = d
+		}
+	}
+	return last.Add(delay)
+}
+
+func accountKey(name string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(name))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// remoteIP strips the port from http.Request.RemoteAddr.
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// trusted returns whether the IP address belongs to a trusted proxy.
+func (c *CoreDB) trusted(ip string) bool {
+	var parsed = net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range c.TrustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client. If the request comes from a trusted proxy, the X-Forwarded-For header is read from right to left, and the first address which is not a trusted proxy is returned.
+// The leftmost addresses are not used because the client can set them.
+func (req *Request) ClientIP() string {
+	var ip = remoteIP(req.request.RemoteAddr)
+	if !req.db.trusted(ip) {
+		return ip
+	}
+	var forwarded []string
+	for _, header := range req.request.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		var hop = strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break // malformed, don't trust anything left of it
+		}
+		ip = hop
+		if !req.db.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// checkLoginThrottle returns an ErrLoginThrottled if any of the keys is blocked.
+func (c *CoreDB) checkLoginThrottle(keys ...string) error {
+	var now = time.Now()
+	for _, key := range keys {
+		lf, err := c.LoginFailureDB.GetLoginFailure(key)
+		if err != nil {
+			return err
+		}
+		if time.Unix(lf.LastTs, 0).Add(loginFailuresExpire).Before(now) {
+			continue
+		}
+		if until := lf.BlockedUntil(); until.After(now) {
+			return ErrLoginThrottled{until}
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure records a failed login for the keys and writes it to the audit log.
+func (c *CoreDB) recordLoginFailure(keys ...string) error {
+	var now = time.Now()
+	for _, key := range keys {
+		// restart counting if the last failure is too old
+		lf, err := c.LoginFailureDB.GetLoginFailure(key)
+		if err != nil {
+			return err
+		}
+		if lf.Count > 0 && time.Unix(lf.LastTs, 0).Add(loginFailuresExpire).Before(now) {
+			if err := c.LoginFailureDB.DeleteLoginFailure(key); err != nil {
+				return err
+			}
+		}
+		if err := c.LoginFailureDB.RecordLoginFailure(key, now.Unix()); err != nil {
+			return err
+		}
+	}
+	return c.audit(nil, AuditLoginFailed, 0, "%s", strings.Join(keys, ", "))
+}
+
+// UnlockLogin shadows LoginFailureDB.DeleteLoginFailure.
+func (c *CoreDB) UnlockLogin(actor DBUser, key string) error {
+	if err := c.LoginFailureDB.DeleteLoginFailure(key); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditUnlockLogin, 0, "%s", key)
+}
+
+// DeleteOldLoginFailures removes failures which are older than loginFailuresExpire.
+func (c *CoreDB) DeleteOldLoginFailures() error {
+	return c.LoginFailureDB.DeleteLoginFailuresBefore(time.Now().Add(-loginFailuresExpire).Unix())
+}
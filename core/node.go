@@ -28,21 +28,31 @@ type NodeDB interface {
 	AddVersion(n DBNode, content, versionNote string, workflowGroupID int) error
 	CountChildren(id int) (int, error)
 	CountReleasedChildren(id int) (int, error)
-	DeleteNode(n DBNode) error
+	DeleteNode(n DBNode) error                                                   // also removes the versions, the change set items and the edit lock of the node
 	GetChildren(id int, order Order, limit, offset int) ([]DBNodeVersion, error) // version part can be empty, exists just because it makes caching easier
+	GetLatestVersionsInWorkflowGroups(groupIDs []int) ([]DBNodeVersion, error)   // nodes whose latest version is in one of the groups, oldest versions first
 	GetNodeByID(id int) (DBNode, error)
 	GetNodeBySlug(parentID int, slug string) (DBNode, error)
 	GetReleasedChildren(id int, order Order, limit, offset int) ([]DBNodeVersion, error)
 	GetVersion(id int, versionNo int) (DBVersion, error)
 	InsertNode(parentID int, slug string, class string) error
 	IsNotFound(err error) bool
+	SearchNodes(slugTerm, contentTerm string, limit, offset int) ([]DBNode, error) // nodes whose slug contains slugTerm, or whose latest or latest released version contains contentTerm, case-insensitive
 	SetClass(n DBNode, classCode string) error
 	SetParent(n DBNode, parent DBNode) error
 	SetSlug(n DBNode, slug string) error
 	SetWorkflowGroup(n DBNode, v DBVersionStub, groupID int) error // sets workflow group id of the current version
+	SetWorkflowGroups(changes []WorkflowGroupChange) error         // like SetWorkflowGroup, but all or nothing
 	Versions(id int) ([]DBVersionStub, error)
 }
 
+// A WorkflowGroupChange is used for changing the workflow groups of several versions in one transaction.
+type WorkflowGroupChange struct {
+	Node    DBNode
+	Version DBVersionStub
+	GroupID int
+}
+
 type NoVersion struct{}
 
 func (NoVersion) Content() string {
@@ -110,6 +120,26 @@ func (n *Node) CountReleasedChildren() (int, error) {
 	return n.db.CountReleasedChildren(n.ID())
 }
 
+// CountReadableChildren returns the number of children which the user can read. Unlike CountChildren, it considers access rules, so it is more expensive.
+func (n *Node) CountReadableChildren(user DBUser) (int, error) {
+	const batch = 500
+	var count = 0
+	for offset := 0; ; offset += batch {
+		children, err := n.db.GetChildren(n.ID(), AlphabeticallyAsc, batch, offset)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range children {
+			if err := n.db.NewNode(n, c).RequirePermission(Read, user); err == nil {
+				count++
+			}
+		}
+		if len(children) < batch {
+			return count, nil
+		}
+	}
+}
+
 func (n *Node) Depth() int {
 	var depth = 0
 	for n != nil {
@@ -248,9 +278,12 @@ func (n *Node) Versions() ([]DBVersionStub, error) {
 
 // AddChild adds a child node to the receiver node.
 // It does not care for duplicated slugs, the database must prevent them.
-func (c *CoreDB) AddChild(n *Node, slug, classCode string) error {
+func (c *CoreDB) AddChild(actor DBUser, n *Node, slug, classCode string) error {
 	if _, ok := c.ClassRegistry.Get(classCode); !ok {
 		return fmt.Errorf("class %s not found", classCode)
 	}
-	return c.InsertNode(n.DBNode.ID(), slug, classCode)
+	if err := c.InsertNode(n.DBNode.ID(), slug, classCode); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditAddChild, n.ID(), "%s: %s (%s)", n.Location(), slug, classCode)
 }
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Notification modes
+const (
+	NotifyImmediately = "immediately" // default
+	NotifyDigest      = "digest"
+	NotifyNever       = "never"
+)
+
+// NotificationModes contains all notification modes. The first one is the default.
+var NotificationModes = []string{NotifyImmediately, NotifyDigest, NotifyNever}
+
+// A NotificationDB stores the notification settings of users, and notifications which are queued for a digest.
+type NotificationDB interface {
+	DeleteDigestItems(userID int, until int64) error
+	GetDigestItems(until int64) (map[int][]string, error) // returns queued items (user id -> texts, chronologically ascending)
+	GetNotificationMode(userID int) (string, error)       // returns NotifyImmediately if nothing has been set
+	InsertDigestItem(userID int, ts int64, text string) error
+	SetNotificationMode(userID int, mode string) error
+}
+
+// SetNotificationMode shadows NotificationDB.SetNotificationMode.
+func (c *CoreDB) SetNotificationMode(u DBUser, mode string) error {
+	for _, m := range NotificationModes {
+		if m == mode {
+			return c.NotificationDB.SetNotificationMode(u.ID(), mode)
+		}
+	}
+	return errors.New("unknown notification mode")
+}
+
+// notifyWorkflowGroup notifies the members of a workflow group (except the actor) that a version has been put into their group.
+// Notifications are optional, so errors are logged only.
+func (c *CoreDB) notifyWorkflowGroup(actor DBUser, n *Node, versionNo int, groupID int, comment string) {
+
+	if c.Mailer == nil || groupID == 0 {
+		return
+	}
+
+	group, err := c.GroupDB.GetGroup(groupID)
+	if err != nil {
+		log.Printf("error notifying group %d: %v", groupID, err)
+		return
+	}
+
+	members, err := group.Members()
+	if err != nil {
+		log.Printf("error notifying group %d: %v", groupID, err)
+		return
+	}
+
+	var actorName = "system"
+	if actor != nil {
+		actorName = actor.Name()
+	}
+
+	var text = fmt.Sprintf("Version %d of %s has been put into the workflow group %s by %s.", versionNo, n.Location(), group.Name(), actorName)
+	if comment = strings.TrimSpace(comment); comment != "" {
+		text += "\nComment: " + comment
+	}
+	if c.PublicURL != "" {
+		text += fmt.Sprintf("\n%s/backend/edit/%d%s", c.PublicURL, versionNo, n.Location())
+	}
+
+	for userID := range members {
+
+		if actor != nil && userID == actor.ID() {
+			continue
+		}
+
+		mode, err := c.NotificationDB.GetNotificationMode(userID)
+		if err != nil {
+			log.Printf("error getting notification mode of user %d: %v", userID, err)
+			continue
+		}
+
+		switch mode {
+		case NotifyNever:
+			continue
+		case NotifyDigest:
+			if err := c.NotificationDB.InsertDigestItem(userID, time.Now().Unix(), text); err != nil {
+				log.Printf("error queueing notification for user %d: %v", userID, err)
+			}
+		default:
+			user, err := c.UserDB.GetUser(userID)
+			if err != nil {
+				log.Printf("error getting user %d: %v", userID, err)
+				continue
+			}
+			go c.sendMail(user, fmt.Sprintf("%s is waiting for %s", n.Location(), group.Name()), text)
+		}
+	}
+}
+
+// SendDigests sends the queued notifications. It is called periodically.
+// Items are deleted after they have been sent, so they are retried if sending fails.
+func (c *CoreDB) SendDigests() error {
+
+	if c.Mailer == nil {
+		return nil
+	}
+
+	// items of the current second are left for the next run, so items which are inserted while the digests are sent are not deleted unsent
+	var until = time.Now().Unix() - 1
+
+	items, err := c.NotificationDB.GetDigestItems(until)
+	if err != nil {
+		return err
+	}
+
+	var userIDs = make([]int, 0, len(items))
+	for userID := range items {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	for _, userID := range userIDs {
+		user, err := c.UserDB.GetUser(userID)
+		if err != nil {
+			log.Printf("error getting user %d: %v", userID, err)
+			continue
+		}
+		if err := c.sendMail(user, fmt.Sprintf("Workflow notifications (%d)", len(items[userID])), strings.Join(items[userID], "\n\n")); err != nil {
+			continue
+		}
+		if err := c.NotificationDB.DeleteDigestItems(userID, until); err != nil {
+			log.Printf("error deleting digest items of user %d: %v", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendMail sends an email to a user whose name is an email address. Errors are logged and returned, so callers may ignore them.
+// If the name is not an email address, nothing is sent and nil is returned.
+func (c *CoreDB) sendMail(u DBUser, subject, body string) error {
+	if !strings.Contains(u.Name(), "@") {
+		return nil
+	}
+	if err := c.Mailer.Send(u.Name(), subject, body); err != nil {
+		log.Printf("error sending email to %s: %v", u.Name(), err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wansing/perspective/mail"
+)
+
+// testNotificationDB keeps the notification settings and digest items in memory.
+type testNotificationDB struct {
+	modes  map[int]string
+	digest map[int][]testDigestItem
+}
+
+type testDigestItem struct {
+	ts   int64
+	text string
+}
+
+func (db *testNotificationDB) DeleteDigestItems(userID int, until int64) error {
+	var kept []testDigestItem
+	for _, item := range db.digest[userID] {
+		if item.ts > until {
+			kept = append(kept, item)
+		}
+	}
+	db.digest[userID] = kept
+	return nil
+}
+
+func (db *testNotificationDB) GetDigestItems(until int64) (map[int][]string, error) {
+	var items = make(map[int][]string)
+	for userID, userItems := range db.digest {
+		for _, item := range userItems {
+			if item.ts <= until {
+				items[userID] = append(items[userID], item.text)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (db *testNotificationDB) GetNotificationMode(userID int) (string, error) {
+	if mode, ok := db.modes[userID]; ok {
+		return mode, nil
+	}
+	return NotifyImmediately, nil
+}
+
+func (db *testNotificationDB) InsertDigestItem(userID int, ts int64, text string) error {
+	db.digest[userID] = append(db.digest[userID], testDigestItem{ts, text})
+	return nil
+}
+
+func (db *testNotificationDB) SetNotificationMode(userID int, mode string) error {
+	db.modes[userID] = mode
+	return nil
+}
+
+// testGroupDB implements GetGroup of GroupDB. Other methods panic.
+type testGroupDB struct {
+	GroupDB
+	groups []testGroup
+}
+
+func (db *testGroupDB) GetGroup(id int) (DBGroup, error) {
+	for _, g := range db.groups {
+		if g.id == id {
+			return g, nil
+		}
+	}
+	return nil, errors.New("group not found")
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(to, subject, body string) error {
+	return errors.New("mail server unavailable")
+}
+
+const testReviewers = 30
+
+// newNotificationTestDB returns a CoreDB whose reviewers group contains an actor (1), a user who is notified immediately (2), a user who gets a digest (3) and a user who doesn't want notifications (4).
+func newNotificationTestDB(dir string) *CoreDB {
+	return &CoreDB{
+		GroupDB: &testGroupDB{groups: []testGroup{{
+			id:      testReviewers,
+			members: map[int]interface{}{1: struct{}{}, 2: struct{}{}, 3: struct{}{}, 4: struct{}{}},
+		}}},
+		Mailer: &mail.Maildir{Dir: dir, From: "noreply@example.org"},
+		NotificationDB: &testNotificationDB{
+			modes:  map[int]string{3: NotifyDigest, 4: NotifyNever},
+			digest: make(map[int][]testDigestItem),
+		},
+		PublicURL: "https://example.org",
+		UserDB: &testUserDB{users: []testUser{
+			{1, "actor@example.org"},
+			{2, "immediate@example.org"},
+			{3, "digest@example.org"},
+			{4, "never@example.org"},
+		}},
+	}
+}
+
+// readMaildir returns the messages in the "new" directory of a maildir.
+func readMaildir(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(filepath.Join(dir, "new"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "new", f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, string(data))
+	}
+	return msgs
+}
+
+func TestNotifications(t *testing.T) {
+
+	var dir = t.TempDir()
+	var c = newNotificationTestDB(dir)
+
+	var root = c.NewNode(nil, testNode{id: RootID})
+	var n = c.NewNode(root, testNode{id: 2, slug: "news"})
+
+	c.notifyWorkflowGroup(testUser{1, "actor@example.org"}, n, 5, testReviewers, "please review")
+
+	// immediate notifications are sent asynchronously
+	var msgs []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if msgs = readMaildir(t, dir); len(msgs) > 0 {
+			break
+		}
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d immediate notifications, want 1", len(msgs))
+	}
+	for _, want := range []string{
+		"To: immediate@example.org\r\n",
+		"Subject: /news is waiting for test group\r\n",
+		"Version 5 of /news has been put into the workflow group test group by actor@example.org.",
+		"Comment: please review",
+		"https://example.org/backend/edit/5/news",
+	} {
+		if !strings.Contains(msgs[0], want) {
+			t.Errorf("immediate notification does not contain %q:\n%s", want, msgs[0])
+		}
+	}
+
+	// the digest item is not older than one second, so it is left for the next run
+	if err := c.SendDigests(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readMaildir(t, dir)); got != 1 {
+		t.Fatalf("got %d messages, want 1", got)
+	}
+
+	var notificationDB = c.NotificationDB.(*testNotificationDB)
+	for i := range notificationDB.digest[3] {
+		notificationDB.digest[3][i].ts -= 10
+	}
+
+	// items are kept if sending fails
+	c.Mailer = failingMailer{}
+	if err := c.SendDigests(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(notificationDB.digest[3]); got != 1 {
+		t.Fatalf("got %d digest items after failed sending, want 1", got)
+	}
+
+	c.Mailer = &mail.Maildir{Dir: dir, From: "noreply@example.org"}
+	if err := c.SendDigests(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(notificationDB.digest[3]); got != 0 {
+		t.Fatalf("got %d digest items after sending, want 0", got)
+	}
+
+	msgs = readMaildir(t, dir)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	var digest string
+	for _, msg := range msgs {
+		if strings.Contains(msg, "To: digest@example.org\r\n") {
+			digest = msg
+		}
+	}
+	for _, want := range []string{
+		"Subject: Workflow notifications (1)\r\n",
+		"Version 5 of /news has been put into the workflow group test group by actor@example.org.",
+	} {
+		if !strings.Contains(digest, want) {
+			t.Errorf("digest does not contain %q:\n%s", want, digest)
+		}
+	}
+}
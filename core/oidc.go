@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wansing/perspective/oidc"
+	"github.com/wansing/perspective/util"
+)
+
+// OIDCLogin configures the login with an OpenID Connect provider.
+type OIDCLogin struct {
+	*oidc.Provider
+	GroupsClaim string            // claim which contains the groups of the user at the provider, like "groups"
+	GroupMap    map[string]string // group at the provider => name of the perspective group, empty if memberships are not synchronized
+	Provision   bool              // create unknown users on their first login
+
+	AllowUnverifiedEmail bool // accept ID tokens without the email_verified claim, for providers which don't send it
+}
+
+const oidcLoginTimeout = 10 * time.Minute
+
+var ErrOIDCDisabled = errors.New("single sign-on is disabled")
+
+// StartOIDCLogin stores the state, the nonce and the PKCE code verifier in the session and returns the URL of the provider.
+// If remember is true, a "remember me" cookie will be set.
+func (req *Request) StartOIDCLogin(remember bool) (string, error) {
+
+	if req.db.OIDC == nil {
+		return "", ErrOIDCDisabled
+	}
+
+	var random = make([]string, 4)
+	for i := range random {
+		var err error
+		if random[i], err = util.RandomString32(); err != nil {
+			return "", err
+		}
+	}
+	var state = random[0]
+	var nonce = random[1]
+	var verifier = random[2] + random[3] // PKCE requires at least 43 characters
+
+	authURL, err := req.db.OIDC.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	var ctx = req.request.Context()
+	req.db.SessionManager.Put(ctx, "oidc_state", state)
+	req.db.SessionManager.Put(ctx, "oidc_nonce", nonce)
+	req.db.SessionManager.Put(ctx, "oidc_verifier", verifier)
+	req.db.SessionManager.Put(ctx, "oidc_ts", time.Now())
+	req.db.SessionManager.Put(ctx, "oidc_remember", remember)
+	return authURL, nil
+}
+
+// LoginOIDC completes the login after the provider has redirected the user back. The user is identified by the email claim.
+// A second factor is not asked for, because the provider is responsible for authentication.
+func (req *Request) LoginOIDC(state, code string) error {
+
+	if req.db.OIDC == nil {
+		return ErrOIDCDisabled
+	}
+
+	var ctx = req.request.Context()
+	var sessMan = req.db.SessionManager
+
+	var wantState = sessMan.PopString(ctx, "oidc_state")
+	var nonce = sessMan.PopString(ctx, "oidc_nonce")
+	var verifier = sessMan.PopString(ctx, "oidc_verifier")
+	var started = sessMan.PopTime(ctx, "oidc_ts")
+	var remember = sessMan.PopBool(ctx, "oidc_remember")
+
+	if wantState == "" || state != wantState {
+		return errors.New("invalid login state, please try again")
+	}
+	if time.Since(started) > oidcLoginTimeout {
+		return errors.New("login has timed out, please try again")
+	}
+
+	claims, err := req.db.OIDC.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return err
+	}
+
+	u, err := req.db.oidcUser(claims)
+	if err != nil {
+		return err
+	}
+
+	if err := req.db.syncOIDCGroups(u, claims); err != nil {
+		return err
+	}
+
+	req.cancelPendingLogin()
+	return req.completeLogin(u, remember)
+}
+
+// oidcUser returns the user with the email address of the claims. If provisioning is enabled, unknown users are created.
+// The provider must confirm that the email address is verified, else anyone could log in as any user by entering their email address at the provider.
+func (c *CoreDB) oidcUser(claims *oidc.Claims) (DBUser, error) {
+
+	var email = strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, errors.New("the identity provider has not sent an email address")
+	}
+	switch {
+	case claims.EmailVerified == nil && !c.OIDC.AllowUnverifiedEmail:
+		return nil, errors.New("the identity provider has not confirmed that your email address is verified")
+	case claims.EmailVerified != nil && !*claims.EmailVerified:
+		return nil, errors.New("your email address is not verified at the identity provider")
+	}
+
+	if u, err := c.UserDB.GetUserByName(email); err == nil {
+		return u, nil
+	}
+
+	if !c.OIDC.Provision || !c.UserDB.Writeable() {
+		return nil, fmt.Errorf("there is no account for %s", email)
+	}
+
+	return c.InsertUser(nil, email)
+}
+
+// syncOIDCGroups synchronizes the memberships of the user in the mapped groups with the groups claim.
+// Memberships in groups which are not mapped are not touched.
+func (c *CoreDB) syncOIDCGroups(u DBUser, claims *oidc.Claims) error {
+
+	if len(c.OIDC.GroupMap) == 0 || !c.GroupDB.Writeable() {
+		return nil
+	}
+
+	var want = make(map[string]bool) // perspective group name => member
+	for _, name := range c.OIDC.GroupMap {
+		want[name] = false
+	}
+	for _, claimed := range claims.Strings(c.OIDC.GroupsClaim) {
+		if name, ok := c.OIDC.GroupMap[claimed]; ok {
+			want[name] = true
+		}
+	}
+
+	for name, member := range want {
+		g, err := c.GroupDB.GetGroupByName(name)
+		if err != nil {
+			continue // group does not exist in perspective
+		}
+		isMember, err := g.HasMember(u)
+		if err != nil {
+			return err
+		}
+		// HasMember considers subgroups, so the direct membership is checked as well
+		direct, err := g.DirectMembers()
+		if err != nil {
+			return err
+		}
+		_, isDirect := direct[u.ID()]
+		switch {
+		case member && !isMember:
+			err = c.Join(nil, g, u, Validity{})
+		case !member && isDirect:
+			err = c.Leave(nil, g, u)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
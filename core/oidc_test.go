@@ -0,0 +1,81 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wansing/perspective/oidc"
+)
+
+type testUser struct {
+	id   int
+	name string
+}
+
+func (u testUser) ID() int      { return u.id }
+func (u testUser) Name() string { return u.name }
+
+// testUserDB implements the lookup methods of UserDB. Other methods panic.
+type testUserDB struct {
+	UserDB
+	users     []testUser
+	writeable bool
+}
+
+func (db *testUserDB) GetUser(id int) (DBUser, error) {
+	for _, u := range db.users {
+		if u.id == id {
+			return u, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (db *testUserDB) GetUserByName(name string) (DBUser, error) {
+	for _, u := range db.users {
+		if u.name == name {
+			return u, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (db *testUserDB) Writeable() bool {
+	return db.writeable
+}
+
+func TestOIDCUserEmailVerified(t *testing.T) {
+
+	var yes, no = true, false
+
+	var tests = []struct {
+		verified *bool
+		allow    bool
+		wantOK   bool
+	}{
+		{&yes, false, true},
+		{&yes, true, true},
+		{&no, false, false},
+		{&no, true, false},
+		{nil, false, false},
+		{nil, true, true},
+	}
+
+	for _, test := range tests {
+		var c = &CoreDB{
+			UserDB: &testUserDB{users: []testUser{{1, "alice@example.org"}}},
+			OIDC:   &OIDCLogin{AllowUnverifiedEmail: test.allow},
+		}
+		u, err := c.oidcUser(&oidc.Claims{
+			Subject:       "1234",
+			Email:         "Alice@example.org",
+			EmailVerified: test.verified,
+		})
+		if test.wantOK && (err != nil || u.ID() != 1) {
+			t.Errorf("verified %v, allow %v: got %v, %v", test.verified, test.allow, u, err)
+		}
+		if !test.wantOK && err == nil {
+			t.Errorf("verified %v, allow %v: user has been accepted", test.verified, test.allow)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wansing/perspective/util"
+)
+
+// Password token purposes
+const (
+	TokenInvite   = "invite"
+	TokenRegister = "register" // confirms a registration, see Query.Register
+	TokenReset    = "reset"
+)
+
+const (
+	inviteTokenLifetime = 7 * 24 * time.Hour
+	resetTokenLifetime  = time.Hour
+)
+
+var (
+	ErrInvalidToken  = errors.New("the link is invalid or has expired")
+	ErrMailDisabled  = errors.New("emails are disabled")
+	ErrNoPublicURL   = errors.New("the public url is not configured")
+	ErrUsersReadOnly = errors.New("passwords can't be set because the user database is read-only")
+)
+
+// A PasswordToken allows to set the password of a user once. Only its SHA-256 hash is stored.
+type PasswordToken struct {
+	Hash    string
+	UserID  int
+	Purpose string // TokenInvite, TokenRegister or TokenReset
+	Expires int64
+}
+
+// A PasswordTokenDB stores password tokens.
+type PasswordTokenDB interface {
+	DeleteExpiredPasswordTokens(before int64) error
+	DeletePasswordToken(hash string) (bool, error) // returns false if the token does not exist
+	DeletePasswordTokens(userID int) error
+	GetPasswordToken(hash string) (PasswordToken, error) // returns a zero UserID if the token does not exist
+	InsertPasswordToken(t PasswordToken) error
+}
+
+func hashToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newPasswordToken stores a new token and returns the link which contains it.
+func (c *CoreDB) newPasswordToken(u DBUser, purpose string, lifetime time.Duration) (string, error) {
+	if c.PublicURL == "" {
+		return "", ErrNoPublicURL
+	}
+	token, err := util.RandomString32()
+	if err != nil {
+		return "", err
+	}
+	err = c.PasswordTokenDB.InsertPasswordToken(PasswordToken{
+		Hash:    hashToken(token),
+		UserID:  u.ID(),
+		Purpose: purpose,
+		Expires: time.Now().Add(lifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return c.PublicURL + "/backend/set-password/" + token, nil
+}
+
+// RequestPasswordReset sends a link for resetting the password to the user. It returns no error if the user does not exist, so the existence of accounts is not revealed.
+// Requests are throttled per account like failed logins.
+func (c *CoreDB) RequestPasswordReset(name string) error {
+
+	if c.Mailer == nil {
+		return ErrMailDisabled
+	}
+
+	if !c.UserDB.Writeable() {
+		return ErrUsersReadOnly // don't send a link which can't be used
+	}
+
+	var key = "reset:" + accountKey(name)
+	if err := c.checkLoginThrottle(key); err != nil {
+		return err
+	}
+	if err := c.LoginFailureDB.RecordLoginFailure(key, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	u, err := c.UserDB.GetUserByName(name)
+	if err != nil {
+		return nil // user not found, or a database error which we don't reveal
+	}
+
+	link, err := c.newPasswordToken(u, TokenReset, resetTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	c.sendMail(u, "Reset your password", fmt.Sprintf("Someone, probably you, has requested to reset your password. Please follow this link within %s:\n\n%s\n\nIf you don't want to reset your password, just ignore this email.", resetTokenLifetime, link))
+	return c.audit(nil, AuditRequestPasswordReset, 0, "%s", u.Name())
+}
+
+// InviteUser creates a user whose name is the given email address and sends a link for setting the password.
+func (c *CoreDB) InviteUser(actor DBUser, name string) (DBUser, error) {
+
+	if c.Mailer == nil {
+		return nil, ErrMailDisabled
+	}
+
+	if c.PublicURL == "" {
+		return nil, ErrNoPublicURL // check before creating the user
+	}
+
+	if !c.UserDB.Writeable() {
+		return nil, ErrUsersReadOnly
+	}
+
+	// managers of groups can invite users, so the name is restricted like on registration
+	name, err := parseEmail(name)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := c.InsertUser(actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := c.newPasswordToken(u, TokenInvite, inviteTokenLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendMail(u, "Invitation", fmt.Sprintf("%s has created an account for you. Please follow this link within %s to set your password:\n\n%s", actor.Name(), inviteTokenLifetime, link))
+	return u, c.audit(actor, AuditInviteUser, 0, "%s", u.Name())
+}
+
+// CheckPasswordToken returns the user and the purpose of a valid token.
+func (c *CoreDB) CheckPasswordToken(token string) (DBUser, string, error) {
+	t, err := c.PasswordTokenDB.GetPasswordToken(hashToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+	if t.UserID == 0 || t.Expires < time.Now().Unix() {
+		return nil, "", ErrInvalidToken
+	}
+	u, err := c.UserDB.GetUser(t.UserID)
+	if err != nil {
+		return nil, "", ErrInvalidToken // user has been deleted
+	}
+	return u, t.Purpose, nil
+}
+
+// SetPasswordByToken sets the password of the user to whom the token belongs. The token is invalidated, along with all other tokens of the user. Like SetPassword, it logs the user out everywhere.
+func (c *CoreDB) SetPasswordByToken(token, password string) (DBUser, error) {
+
+	if !c.UserDB.Writeable() {
+		return nil, ErrUsersReadOnly // check before the token is used up
+	}
+
+	u, _, err := c.CheckPasswordToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	// delete first, so the token can't be used twice concurrently
+	deleted, err := c.PasswordTokenDB.DeletePasswordToken(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, ErrInvalidToken
+	}
+
+	if err := c.SetPassword(u, password); err != nil {
+		return nil, err
+	}
+
+	if err := c.PasswordTokenDB.DeletePasswordTokens(u.ID()); err != nil {
+		return nil, err
+	}
+
+	if err := c.LoginFailureDB.DeleteLoginFailure(accountKey(u.Name())); err != nil {
+		return nil, err
+	}
+
+	// any token proves that the user controls the email address
+	if err := c.confirmRegistration(u); err != nil {
+		return nil, err
+	}
+
+	return u, c.audit(u, AuditSetPasswordByToken, 0, "%s", u.Name())
+}
+
+// DeleteExpiredPasswordTokens shadows PasswordTokenDB.DeleteExpiredPasswordTokens.
+func (c *CoreDB) DeleteExpiredPasswordTokens() error {
+	return c.PasswordTokenDB.DeleteExpiredPasswordTokens(time.Now().Unix())
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/wansing/perspective/mail"
+)
+
+func TestInviteUserRejectsMarkup(t *testing.T) {
+
+	// InsertUser of testUserDB panics, so the user must not be created
+	var c = &CoreDB{
+		Mailer:    &mail.Maildir{Dir: t.TempDir()},
+		PublicURL: "https://example.org",
+		UserDB:    &testUserDB{writeable: true},
+	}
+
+	for _, name := range []string{
+		`"<img src=x onerror=alert(1)>"@example.org`,
+		"<b>bold</b>@example.org",
+		"Alice <alice@example.org>",
+	} {
+		if _, err := c.InviteUser(testUser{1, "manager@example.org"}, name); err == nil {
+			t.Errorf("%q has been invited", name)
+		}
+	}
+}
+
+func TestPasswordTokensRequireWriteableUsers(t *testing.T) {
+
+	// PasswordTokenDB and LoginFailureDB are nil, so no token must be created or used up
+	var c = &CoreDB{
+		Mailer:    &mail.Maildir{Dir: t.TempDir()},
+		PublicURL: "https://example.org",
+		UserDB:    &testUserDB{users: []testUser{{1, "alice@example.org"}}},
+	}
+
+	if err := c.RequestPasswordReset("alice@example.org"); err != ErrUsersReadOnly {
+		t.Errorf("RequestPasswordReset: got %v, want %v", err, ErrUsersReadOnly)
+	}
+	if _, err := c.SetPasswordByToken("token", "secret"); err != ErrUsersReadOnly {
+		t.Errorf("SetPasswordByToken: got %v, want %v", err, ErrUsersReadOnly)
+	}
+	if _, err := c.InviteUser(testUser{2, "manager@example.org"}, "bob@example.org"); err != ErrUsersReadOnly {
+		t.Errorf("InviteUser: got %v, want %v", err, ErrUsersReadOnly)
+	}
+}
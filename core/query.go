@@ -166,7 +166,7 @@ func (q *Query) Recurse() error {
 
 	// get version
 
-	v, err := n.GetVersion(n.MaxWGZeroVersionNo()) // could use specific version for preview
+	v, err := n.GetVersion(q.Request.previewVersionNo(n))
 	if err != nil {
 		return err
 	}
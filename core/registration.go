@@ -0,0 +1,344 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const registerTokenLifetime = 24 * time.Hour // unconfirmed registrations are deleted afterwards
+
+var ErrRegistrationDisabled = errors.New("registration is disabled")
+
+// A RegistrationConfig enables registration on a node. It is set by root admins in the backend, not in the content of the node, so editors of the node can't choose the groups which new users join.
+type RegistrationConfig struct {
+	NodeID       int
+	PendingGroup int  // group which users join after confirming their email address, until they are approved, 0 if no approval is required
+	MemberGroup  int  // group which users join after approval
+	Approval     bool // whether an administrator must approve registrations, else users join the member group right after confirming their email address
+}
+
+// A Registration is a user who has signed up on a registration node and has not been approved yet.
+type Registration struct {
+	UserID       int
+	NodeID       int
+	NodePath     string // location of the registration node at the time of the registration
+	PendingGroup int    // 0 if no approval is required
+	MemberGroup  int
+	Approval     bool
+	Confirmed    bool // whether the email address has been confirmed
+	Created      int64
+}
+
+// A RegistrationDB stores registrations and the configuration of registration nodes.
+type RegistrationDB interface {
+	ConfirmRegistration(userID int) error
+	DeleteRegistration(userID int) error
+	DeleteRegistrationConfig(nodeID int) error
+	GetRegistration(userID int) (Registration, error)             // returns a zero UserID if there is no registration
+	GetRegistrationConfig(nodeID int) (RegistrationConfig, error) // returns a zero NodeID if registration is not enabled on the node
+	GetRegistrationConfigs() ([]RegistrationConfig, error)
+	GetRegistrations() ([]Registration, error) // ordered by Created, descending
+	InsertRegistration(r Registration) error
+	SetRegistrationConfig(config RegistrationConfig) error // replaces the configuration of the node
+}
+
+// registrationGroup returns the group with the given id. Groups which grant Admin permission are refused, so registration can't make anyone an administrator.
+func (c *CoreDB) registrationGroup(id int) (DBGroup, error) {
+	g, err := c.GroupDB.GetGroup(id)
+	if err != nil {
+		return nil, fmt.Errorf("registration: group %d not found", id)
+	}
+	grantsAdmin, err := c.GrantsAdmin(g)
+	if err != nil {
+		return nil, err
+	}
+	if grantsAdmin {
+		return nil, fmt.Errorf("registration: group %s grants admin permission", g.Name())
+	}
+	return g, nil
+}
+
+// registrationGroups returns the groups of the configuration. The pending group is nil if no approval is required.
+func (c *CoreDB) registrationGroups(config RegistrationConfig) (pending DBGroup, member DBGroup, err error) {
+	if member, err = c.registrationGroup(config.MemberGroup); err != nil {
+		return nil, nil, err
+	}
+	if config.Approval {
+		if pending, err = c.registrationGroup(config.PendingGroup); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pending, member, nil
+}
+
+// SetRegistrationConfig enables registration on the node, or changes its configuration.
+func (c *CoreDB) SetRegistrationConfig(actor DBUser, n *Node, config RegistrationConfig) error {
+	config.NodeID = n.ID()
+	if !config.Approval {
+		config.PendingGroup = 0
+	}
+	pending, member, err := c.registrationGroups(config)
+	if err != nil {
+		return err
+	}
+	if pending != nil && pending.ID() == member.ID() {
+		return errors.New("the pending group and the member group must differ")
+	}
+	if err := c.RegistrationDB.SetRegistrationConfig(config); err != nil {
+		return err
+	}
+	if pending != nil {
+		return c.audit(actor, AuditSetRegistrationConfig, n.ID(), "%s: pending group %s, member group %s", n.Location(), pending.Name(), member.Name())
+	}
+	return c.audit(actor, AuditSetRegistrationConfig, n.ID(), "%s: member group %s, no approval", n.Location(), member.Name())
+}
+
+// DeleteRegistrationConfig disables registration on the node. Pending registrations are not affected.
+func (c *CoreDB) DeleteRegistrationConfig(actor DBUser, nodeID int) error {
+	if err := c.RegistrationDB.DeleteRegistrationConfig(nodeID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditSetRegistrationConfig, nodeID, "node %d: disabled", nodeID)
+}
+
+// RegistrationConfig returns the registration configuration of the current node. It returns ErrRegistrationDisabled if registration is not enabled on the node.
+func (q *Query) RegistrationConfig() (RegistrationConfig, error) {
+	config, err := q.Request.db.RegistrationDB.GetRegistrationConfig(q.Node.ID())
+	if err != nil {
+		return RegistrationConfig{}, err
+	}
+	if config.NodeID == 0 {
+		return RegistrationConfig{}, ErrRegistrationDisabled
+	}
+	return config, nil
+}
+
+// emailRegex matches addresses with a dot-atom local part and a domain name. Quoted local parts and domain literals are not accepted.
+var emailRegex = regexp.MustCompile("^[a-z0-9!#$%&'*+/=?^_`{|}~-]+(\\.[a-z0-9!#$%&'*+/=?^_`{|}~-]+)*@[a-z0-9-]+(\\.[a-z0-9-]+)+$")
+
+// parseEmail returns the lowercase form of an email address which is entered by a user.
+// It accepts a bare address only, because the address becomes the user name, which is shown in many places.
+func parseEmail(input string) (string, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	addr, err := mail.ParseAddress(input)
+	if err != nil || addr.Name != "" || addr.Address != input || !emailRegex.MatchString(input) {
+		return "", errors.New("invalid email address")
+	}
+	return input, nil
+}
+
+// Register signs up a visitor on the current node. It creates a user and sends a link for confirming the email address and setting the password.
+// It returns no error if the user exists already, so the existence of accounts is not revealed.
+// Registrations are throttled per IP address and per email address like failed logins.
+func (q *Query) Register(email string) error {
+
+	var c = q.Request.db
+
+	config, err := q.RegistrationConfig()
+	if err != nil {
+		return err
+	}
+
+	if c.Mailer == nil {
+		return ErrMailDisabled
+	}
+	if c.PublicURL == "" {
+		return ErrNoPublicURL
+	}
+	if !c.UserDB.Writeable() || !c.GroupDB.Writeable() {
+		return ErrRegistrationDisabled
+	}
+
+	email, err = parseEmail(email)
+	if err != nil {
+		return err
+	}
+
+	var keys = []string{"register:" + ipKey(q.ClientIP()), "register:" + accountKey(email)}
+	if err := c.checkLoginThrottle(keys...); err != nil {
+		if _, ok := err.(ErrLoginThrottled); ok {
+			return errors.New("too many registrations, please try again later")
+		}
+		return err
+	}
+	for _, key := range keys {
+		if err := c.LoginFailureDB.RecordLoginFailure(key, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+
+	pending, member, err := c.registrationGroups(config)
+	if err != nil {
+		return err
+	}
+
+	u, err := c.UserDB.GetUserByName(email)
+	if err == nil {
+		reg, err := c.RegistrationDB.GetRegistration(u.ID())
+		if err != nil {
+			return err
+		}
+		if reg.UserID == 0 || reg.Confirmed {
+			return nil // existing account
+		}
+		// not confirmed yet, send a new link
+	} else {
+		if u, err = c.InsertUser(nil, email); err != nil {
+			return err
+		}
+		var reg = Registration{
+			UserID:      u.ID(),
+			NodeID:      q.Node.ID(),
+			NodePath:    q.Node.Location(),
+			MemberGroup: member.ID(),
+			Approval:    config.Approval,
+			Created:     time.Now().Unix(),
+		}
+		if pending != nil {
+			reg.PendingGroup = pending.ID()
+		}
+		if err := c.RegistrationDB.InsertRegistration(reg); err != nil {
+			return err
+		}
+	}
+
+	link, err := c.newPasswordToken(u, TokenRegister, registerTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	c.sendMail(u, "Confirm your registration", fmt.Sprintf("Someone, probably you, has signed up with this email address. Please follow this link within %s to confirm it and to set your password:\n\n%s\n\nIf you haven't signed up, just ignore this email.", registerTokenLifetime, link))
+	return c.audit(nil, AuditRegister, q.Node.ID(), "%s at %s", email, q.Node.Location())
+}
+
+// confirmRegistration is called when a user has set the password with a TokenRegister. It puts the user into the pending group, or into the member group if no approval is required.
+func (c *CoreDB) confirmRegistration(u DBUser) error {
+
+	reg, err := c.RegistrationDB.GetRegistration(u.ID())
+	if err != nil {
+		return err
+	}
+	if reg.UserID == 0 || reg.Confirmed {
+		return nil
+	}
+
+	if !reg.Approval {
+		member, err := c.registrationGroup(reg.MemberGroup)
+		if err != nil {
+			return err
+		}
+		if err := c.Join(nil, member, u, Validity{}); err != nil {
+			return err
+		}
+		return c.RegistrationDB.DeleteRegistration(u.ID())
+	}
+
+	pending, err := c.registrationGroup(reg.PendingGroup)
+	if err != nil {
+		return err
+	}
+	if err := c.Join(nil, pending, u, Validity{}); err != nil {
+		return err
+	}
+	return c.RegistrationDB.ConfirmRegistration(u.ID())
+}
+
+// ApproveRegistration moves the user from the pending group into the member group.
+func (c *CoreDB) ApproveRegistration(actor DBUser, u DBUser) error {
+
+	reg, err := c.RegistrationDB.GetRegistration(u.ID())
+	if err != nil {
+		return err
+	}
+	if reg.UserID == 0 || !reg.Confirmed {
+		return errors.New("there is no confirmed registration")
+	}
+
+	member, err := c.registrationGroup(reg.MemberGroup)
+	if err != nil {
+		return err
+	}
+	if err := c.Join(actor, member, u, Validity{}); err != nil {
+		return err
+	}
+	if pending, err := c.GroupDB.GetGroup(reg.PendingGroup); err == nil {
+		if err := c.Leave(actor, pending, u); err != nil {
+			return err
+		}
+	}
+	if err := c.RegistrationDB.DeleteRegistration(u.ID()); err != nil {
+		return err
+	}
+
+	if c.Mailer != nil {
+		c.sendMail(u, "Registration approved", fmt.Sprintf("Your registration has been approved. You can log in now:\n\n%s/backend/login", c.PublicURL))
+	}
+	return c.audit(actor, AuditApproveRegistration, reg.NodeID, "%s at %s", u.Name(), reg.NodePath)
+}
+
+// RejectRegistration deletes the user who has signed up.
+func (c *CoreDB) RejectRegistration(actor DBUser, u DBUser) error {
+
+	reg, err := c.RegistrationDB.GetRegistration(u.ID())
+	if err != nil {
+		return err
+	}
+	if reg.UserID == 0 {
+		return errors.New("there is no registration")
+	}
+
+	if err := c.deleteRegistration(reg, u); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRejectRegistration, reg.NodeID, "%s at %s", u.Name(), reg.NodePath)
+}
+
+// deleteRegistration deletes the registration and the user.
+func (c *CoreDB) deleteRegistration(reg Registration, u DBUser) error {
+	if pending, err := c.GroupDB.GetGroup(reg.PendingGroup); err == nil && reg.Confirmed {
+		if err := c.GroupDB.Leave(pending, u); err != nil {
+			return err
+		}
+	}
+	if err := c.PasswordTokenDB.DeletePasswordTokens(u.ID()); err != nil {
+		return err
+	}
+	if err := c.UserDB.Delete(u); err != nil {
+		return err
+	}
+	return c.RegistrationDB.DeleteRegistration(reg.UserID)
+}
+
+// DeleteUnconfirmedRegistrations deletes registrations, and their users, whose email address has not been confirmed in time.
+func (c *CoreDB) DeleteUnconfirmedRegistrations() error {
+
+	registrations, err := c.RegistrationDB.GetRegistrations()
+	if err != nil {
+		return err
+	}
+
+	var before = time.Now().Add(-registerTokenLifetime).Unix()
+	for _, reg := range registrations {
+		if reg.Confirmed || reg.Created >= before {
+			continue
+		}
+		u, err := c.UserDB.GetUser(reg.UserID)
+		if err != nil {
+			if err := c.RegistrationDB.DeleteRegistration(reg.UserID); err != nil { // user has been deleted
+				return err
+			}
+			continue
+		}
+		if err := c.deleteRegistration(reg, u); err != nil {
+			return err
+		}
+		if err := c.audit(nil, AuditRejectRegistration, reg.NodeID, "%s at %s (not confirmed)", u.Name(), reg.NodePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
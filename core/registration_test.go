@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+func TestParseEmail(t *testing.T) {
+
+	var valid = map[string]string{
+		"alice@example.org":            "alice@example.org",
+		" Alice@Example.org ":          "alice@example.org",
+		"alice.o'hara+cms@example.org": "alice.o'hara+cms@example.org",
+	}
+	for input, want := range valid {
+		if got, err := parseEmail(input); err != nil || got != want {
+			t.Errorf("parseEmail(%q): got %q, %v, want %q", input, got, err, want)
+		}
+	}
+
+	var invalid = []string{
+		"",
+		"alice",
+		"alice@localhost",
+		`"<img src=x onerror=alert(1)>"@example.org`,
+		`"alice"@example.org`,
+		"<img src=x onerror=alert(1)>@example.org",
+		"Alice <alice@example.org>",
+		"<alice@example.org>",
+		"alice@[127.0.0.1]",
+		"alice@example.org (comment)",
+		"alice..bob@example.org",
+	}
+	for _, input := range invalid {
+		if got, err := parseEmail(input); err == nil {
+			t.Errorf("parseEmail(%q): got %q, want error", input, got)
+		}
+	}
+}
+
+func TestNotificationsAreEscaped(t *testing.T) {
+
+	var sessionManager = scs.New()
+	ctx, err := sessionManager.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req = &Request{
+		db:      &CoreDB{SessionManager: sessionManager},
+		request: httptest.NewRequest("GET", "/", nil).WithContext(ctx),
+	}
+	req.Success("registration of %s has been approved", `"<img src=x onerror=alert(1)>"@example.org`)
+
+	var html = string(req.RenderNotifications())
+	if strings.Contains(html, "<img") {
+		t.Errorf("notification has not been escaped: %s", html)
+	}
+	if !strings.Contains(html, "&lt;img src=x onerror=alert(1)&gt;") {
+		t.Errorf("notification is missing: %s", html)
+	}
+}
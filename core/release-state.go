@@ -1,16 +1,71 @@
 package core
 
+import (
+	"fmt"
+	"time"
+)
+
+// Workflow models, see the package comment
+const (
+	SubsetModel   = "subset"
+	WorkStepModel = "work-step"
+	ApprovalModel = "approval"
+)
+
+// WorkflowModels contains the codes of all workflow models. The first one is the default.
+var WorkflowModels = []string{SubsetModel, WorkStepModel, ApprovalModel}
+
+// WorkflowModelName returns a human-readable name of a workflow model.
+func WorkflowModelName(model string) string {
+	switch model {
+	case SubsetModel:
+		return "Subset: members of a group can release versions of the previous groups"
+	case WorkStepModel:
+		return "Work steps: each group passes versions to the next or previous group"
+	case ApprovalModel:
+		return "Approvals: a number of members of each group must approve a version"
+	default:
+		return "unknown"
+	}
+}
+
 // A ReleaseState contains the state of a specific node and version in their workflow, when edited by a specific user.
-//
-// Currently it follows the subset model (see the package comment). Its functions might become an interface for different workflow models.
-type ReleaseState struct {
+// Its implementations represent different workflow models.
+type ReleaseState interface {
+	CanEditNode() bool
+	IsSaveGroup(groupID int) bool
+	ReleaseToGroup() *DBGroup // group to which the user can release the version directly, or nil
+	RevokeToGroup() *DBGroup  // group to which the user can revoke the version directly, or nil
+	SaveGroups() []DBGroup    // groups which the user can assign to a new version
+	SuggestedSaveGroup() *DBGroup
+	Workflow() *Workflow
+	WorkflowGroup() DBGroup
+}
+
+// An Approver is a ReleaseState which requires several approvals before a version is released to the next group.
+type Approver interface {
+	Approvals() int // number of approvals so far
+	HasApproved() bool
+	RequiredApprovals() int
+}
+
+// An ApprovalDB stores which users have approved a version in a workflow group.
+type ApprovalDB interface {
+	ClearApprovals(nodeID, versionNo int) error
+	DeleteApprovals(nodeID int) error
+	GetApprovals(nodeID, versionNo, groupID int) ([]int, error) // user ids
+	InsertApproval(nodeID, versionNo, groupID, userID int, ts int64) error
+}
+
+// workflowPosition contains what the workflow models have in common.
+type workflowPosition struct {
 	workflow *Workflow
 	index    int       // index of current workflow group in groups
 	groups   []DBGroup // cached, last element is Readers{}
 	isMember []bool    // cached, refers to groups
 }
 
-func GetReleaseState(workflow *Workflow, workflowGroupID int, user DBUser) (*ReleaseState, error) {
+func newWorkflowPosition(workflow *Workflow, workflowGroupID int, user DBUser) (*workflowPosition, error) {
 
 	wfGroups, err := workflow.Groups()
 	if err != nil {
@@ -29,13 +84,13 @@ func GetReleaseState(workflow *Workflow, workflowGroupID int, user DBUser) (*Rel
 
 	var isMember = make([]bool, len(groups)) // Readers won't matter here because they are an empty group
 	for i := range groups {
-		isMember[i], err = groups[i].HasMember(user)
+		isMember[i], err = groupHasMember(groups[i], user)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return &ReleaseState{
+	return &workflowPosition{
 		workflow: workflow,
 		groups:   groups,
 		index:    index,
@@ -43,8 +98,8 @@ func GetReleaseState(workflow *Workflow, workflowGroupID int, user DBUser) (*Rel
 	}, nil
 }
 
-func (rs *ReleaseState) CanEditNode() bool {
-	for _, is := range rs.isMember {
+func (wp *workflowPosition) CanEditNode() bool {
+	for _, is := range wp.isMember {
 		if is {
 			return true
 		}
@@ -52,9 +107,90 @@ func (rs *ReleaseState) CanEditNode() bool {
 	return false
 }
 
-// RevokeToGroup returns the group to which the user can revoke the node directly, or nil.
-// In the subset model, this is latest "save group" before the current workflow group.
-func (rs *ReleaseState) RevokeToGroup() *DBGroup {
+// responsible returns the index of the group whose members are in charge of the current version.
+// If the version has been released, this is the last group of the workflow.
+func (wp *workflowPosition) responsible() int {
+	if wp.index == len(wp.groups)-1 && wp.index > 0 {
+		return wp.index - 1
+	}
+	return wp.index
+}
+
+// memberGroups returns every group which the user is a member of.
+func (wp *workflowPosition) memberGroups() []DBGroup {
+	var result = []DBGroup{}
+	for i, g := range wp.groups {
+		if g.ID() != 0 && wp.isMember[i] {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// memberAndSubsequentGroups returns every group which the user is a member of, and each subsequent group.
+func (wp *workflowPosition) memberAndSubsequentGroups() []DBGroup {
+	var result = []DBGroup{}
+	for i, g := range wp.groups {
+		if g.ID() != 0 && wp.isMember[i] {
+			result = append(result, g)
+			continue
+		}
+		if i > 0 && wp.isMember[i-1] {
+			result = append(result, g)
+			continue
+		}
+	}
+	return result
+}
+
+func (wp *workflowPosition) Workflow() *Workflow {
+	return wp.workflow
+}
+
+func (wp *workflowPosition) WorkflowGroup() DBGroup {
+	return wp.groups[wp.index]
+}
+
+// isSaveGroup returns whether a given group id is contained in saveGroups.
+func isSaveGroup(saveGroups []DBGroup, groupID int) bool {
+	for _, sg := range saveGroups {
+		if sg.ID() == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestedSaveGroup prefers the current workflow group, else it returns the first save group. It never suggests Readers.
+func suggestedSaveGroup(saveGroups []DBGroup, current DBGroup) *DBGroup {
+
+	var candidates = []DBGroup{}
+	for _, g := range saveGroups {
+		if g.ID() != 0 {
+			candidates = append(candidates, g)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	for _, g := range candidates {
+		if g.ID() == current.ID() {
+			return &g
+		}
+	}
+
+	return &candidates[0]
+}
+
+// SubsetState implements the subset model. Workflow groups are in a subset relation, so any member of the last workflow group can publish on their own.
+type SubsetState struct {
+	*workflowPosition
+}
+
+// RevokeToGroup returns the latest "save group" before the current workflow group.
+func (rs *SubsetState) RevokeToGroup() *DBGroup {
 	var revokeGroup *DBGroup
 	for i := 0; i < rs.index; i++ { // groups before the current workflow group
 		if rs.isMember[i] { // user must be a member of the group
@@ -64,9 +200,8 @@ func (rs *ReleaseState) RevokeToGroup() *DBGroup {
 	return revokeGroup
 }
 
-// RevokeToGroup returns the group to which the user can release the node directly, or nil.
-// In the subset model, this is first "save group" after the current workflow group.
-func (rs *ReleaseState) ReleaseToGroup() *DBGroup {
+// ReleaseToGroup returns the first "save group" after the current workflow group.
+func (rs *SubsetState) ReleaseToGroup() *DBGroup {
 	for i := rs.index + 1; i < len(rs.groups); i++ { // groups after the current workflow group
 		if i > 0 && rs.isMember[i-1] { // user must be a member of the previous group
 			return &rs.groups[i] // return it, so we get the earliest possible group
@@ -77,59 +212,175 @@ func (rs *ReleaseState) ReleaseToGroup() *DBGroup {
 
 // SaveGroups determines the "save groups" of current user, which are the values that she can assign to workflowGroup.
 // This is every group which she is a member of, and each subsequent group.
-func (rs *ReleaseState) SaveGroups() []DBGroup {
-	var saveGroups = []DBGroup{}
-	for i, g := range rs.groups {
-		if g.ID() != 0 && rs.isMember[i] {
-			saveGroups = append(saveGroups, g)
-			continue
-		}
-		if i > 0 && rs.isMember[i-1] {
-			saveGroups = append(saveGroups, g)
-			continue
-		}
+func (rs *SubsetState) SaveGroups() []DBGroup {
+	return rs.memberAndSubsequentGroups()
+}
+
+func (rs *SubsetState) IsSaveGroup(groupID int) bool {
+	return isSaveGroup(rs.SaveGroups(), groupID)
+}
+
+func (rs *SubsetState) SuggestedSaveGroup() *DBGroup {
+	return suggestedSaveGroup(rs.SaveGroups(), rs.WorkflowGroup())
+}
+
+// WorkStepState implements the work step model. Each group does its work step and passes the version to the next group, or back to the previous group.
+type WorkStepState struct {
+	*workflowPosition
+}
+
+// RevokeToGroup returns the group before the current workflow group, if the user is in charge of the version.
+func (rs *WorkStepState) RevokeToGroup() *DBGroup {
+	var r = rs.responsible()
+	if r == rs.index && r == 0 {
+		return nil // version is in the first group already
 	}
-	return saveGroups
+	if !rs.isMember[r] {
+		return nil
+	}
+	if r == rs.index {
+		return &rs.groups[r-1]
+	}
+	return &rs.groups[r] // revoke released version to the last group
 }
 
-// IsSaveGroup returns whether a given group id is a "save group".
-func (rs *ReleaseState) IsSaveGroup(groupID int) bool {
-	for _, sg := range rs.SaveGroups() {
-		if sg.ID() == groupID {
+// ReleaseToGroup returns the group after the current workflow group, if the user is a member of the current workflow group.
+func (rs *WorkStepState) ReleaseToGroup() *DBGroup {
+	if rs.index < len(rs.groups)-1 && rs.isMember[rs.index] {
+		return &rs.groups[rs.index+1]
+	}
+	return nil
+}
+
+// SaveGroups returns every group which the user is a member of, and each subsequent group.
+// Saving a version to the subsequent group is like finishing the work step.
+func (rs *WorkStepState) SaveGroups() []DBGroup {
+	return rs.memberAndSubsequentGroups()
+}
+
+func (rs *WorkStepState) IsSaveGroup(groupID int) bool {
+	return isSaveGroup(rs.SaveGroups(), groupID)
+}
+
+func (rs *WorkStepState) SuggestedSaveGroup() *DBGroup {
+	return suggestedSaveGroup(rs.SaveGroups(), rs.WorkflowGroup())
+}
+
+// ApprovalState implements the democratic model. A number of members of the current workflow group must approve a version before it is passed to the next group.
+// The number is capped at the number of members of the group.
+type ApprovalState struct {
+	WorkStepState
+	approvals []int // user ids
+	required  int
+	user      DBUser
+}
+
+func (rs *ApprovalState) Approvals() int {
+	return len(rs.approvals)
+}
+
+func (rs *ApprovalState) HasApproved() bool {
+	for _, userID := range rs.approvals {
+		if userID == rs.user.ID() {
 			return true
 		}
 	}
 	return false
 }
 
-// SuggestedSaveGroup determines the suggested "save group" for new versions.
-func (rs *ReleaseState) SuggestedSaveGroup() *DBGroup {
-
-	// one of saveGroups
-	var saveGroups = rs.SaveGroups()
+func (rs *ApprovalState) RequiredApprovals() int {
+	return rs.required
+}
 
-	if len(saveGroups) == 0 {
+// ReleaseToGroup returns the group after the current workflow group, if the user is a member of the current workflow group and has not approved the version yet.
+func (rs *ApprovalState) ReleaseToGroup() *DBGroup {
+	if rs.HasApproved() {
 		return nil
 	}
+	return rs.WorkStepState.ReleaseToGroup()
+}
 
-	// except Readers{}, which is the last slice element
-	saveGroups = saveGroups[:len(saveGroups)-1]
+// SaveGroups returns every group which the user is a member of. Subsequent groups are omitted because that would bypass the approvals.
+func (rs *ApprovalState) SaveGroups() []DBGroup {
+	return rs.memberGroups()
+}
 
-	// prefer current workflow group
-	for _, g := range saveGroups {
-		if g.ID() == rs.WorkflowGroup().ID() {
-			return &g
+func (rs *ApprovalState) IsSaveGroup(groupID int) bool {
+	return isSaveGroup(rs.SaveGroups(), groupID)
+}
+
+func (rs *ApprovalState) SuggestedSaveGroup() *DBGroup {
+	return suggestedSaveGroup(rs.SaveGroups(), rs.WorkflowGroup())
+}
+
+// ReleaseState returns the ReleaseState which describes the relation between a node, a version and a user.
+func (n *Node) ReleaseState(v DBVersionStub, u DBUser) (ReleaseState, error) {
+
+	var workflow, err = n.GetWorkflow()
+	if err != nil {
+		return nil, err
+	}
+
+	wp, err := newWorkflowPosition(workflow, v.WorkflowGroupID(), u)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tokenAllowsEdit(u, n) {
+		for i := range wp.isMember {
+			wp.isMember[i] = false
 		}
 	}
 
-	// else suggest the first save group
-	return &saveGroups[0]
+	switch workflow.Model() {
+	case SubsetModel, "":
+		return &SubsetState{wp}, nil
+	case WorkStepModel:
+		return &WorkStepState{wp}, nil
+	case ApprovalModel:
+		approvals, err := n.db.ApprovalDB.GetApprovals(n.ID(), v.VersionNo(), wp.WorkflowGroup().ID())
+		if err != nil {
+			return nil, err
+		}
+		var required = workflow.RequiredApprovals()
+		if required < 1 {
+			required = 1
+		}
+		// a group can't give more approvals than it has members, else versions would be stuck in it
+		if group := wp.WorkflowGroup(); group.ID() != 0 {
+			members, err := group.Members()
+			if err != nil {
+				return nil, err
+			}
+			if len(members) > 0 && required > len(members) {
+				required = len(members)
+			}
+		}
+		return &ApprovalState{
+			WorkStepState: WorkStepState{wp},
+			approvals:     approvals,
+			required:      required,
+			user:          u,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown workflow model: %s", workflow.Model())
+	}
 }
 
-func (rs *ReleaseState) Workflow() *Workflow {
-	return rs.workflow
-}
+// Release releases a version to state.ReleaseToGroup(). If the state is an Approver and more approvals are required, the approval is just recorded.
+func (c *CoreDB) Release(actor DBUser, n *Node, v *Version, state ReleaseState, comment string) error {
+
+	var releaseToGroup = state.ReleaseToGroup()
+	if releaseToGroup == nil {
+		return fmt.Errorf("no release group")
+	}
+
+	if approver, ok := state.(Approver); ok && approver.Approvals()+1 < approver.RequiredApprovals() {
+		if err := c.ApprovalDB.InsertApproval(n.ID(), v.VersionNo(), v.WorkflowGroupID(), actor.ID(), time.Now().Unix()); err != nil {
+			return err
+		}
+		return c.audit(actor, AuditApprove, n.ID(), "version %d (%d of %d)", v.VersionNo(), approver.Approvals()+1, approver.RequiredApprovals())
+	}
 
-func (rs *ReleaseState) WorkflowGroup() DBGroup {
-	return rs.groups[rs.index]
+	return c.SetWorkflowGroup(actor, n, v, (*releaseToGroup).ID(), comment)
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -19,6 +20,7 @@ type Notification struct {
 
 func init() {
 	gob.Register([]Notification{}) // required for storing Notifications in a session
+	gob.Register(time.Time{})      // required for storing the time of a pending login
 }
 
 var langMatcher = language.NewMatcher([]language.Tag{
@@ -59,6 +61,16 @@ type Request struct {
 
 	// caching
 	language language.Tag
+
+	// preview
+	previewChangeSet DBChangeSet
+	previewItems     map[int]int // node id -> version no
+
+	// view as
+	viewingAs bool
+
+	// api token
+	authErr error
 }
 
 // NewRequest creates a Request with the given http.ResponseWriter and http.Request.
@@ -77,14 +89,33 @@ func (c *CoreDB) NewRequest(w http.ResponseWriter, httpreq *http.Request) *Reque
 
 	req.language, _ = language.MatchStrings(langMatcher, httpreq.Header.Get("Accept-Language"))
 
-	if uid := c.SessionManager.GetInt(httpreq.Context(), "uid"); uid != 0 {
-		u, err := c.UserDB.GetUser(uid)
-		if u != nil && err == nil {
+	if token := bearerToken(httpreq.Header.Get("Authorization")); token != "" {
+		if tu, err := c.authenticateToken(token); err == nil {
+			req.User = tu
+		} else {
+			req.authErr = err
+		}
+	} else if uid := c.SessionManager.GetInt(httpreq.Context(), "uid"); uid != 0 {
+		if valid, err := c.checkSession(httpreq.Context(), uid); valid && err == nil {
+			u, err := c.UserDB.GetUser(uid)
+			if u != nil && err == nil {
+				req.User = u
+			}
+		}
+		// ignore errors
+	}
+
+	if !req.LoggedIn() && req.authErr == nil {
+		if u, err := req.restoreSession(); u != nil && err == nil {
 			req.User = u
 		}
 		// ignore errors
 	}
 
+	if changeSetID := c.SessionManager.GetInt(httpreq.Context(), "preview_changeset"); changeSetID != 0 && req.LoggedIn() {
+		req.loadPreview(changeSetID)
+	}
+
 	req.Path = "/" + strings.Trim(httpreq.URL.Path, "/")
 
 	return req
@@ -110,9 +141,10 @@ func (req *Request) Success(format string, args ...interface{}) {
 }
 
 // style should be a bootstrap alert style without the leading "alert-"
+// The message is HTML-escaped, because it often contains user input like user or group names.
 func (req *Request) addNotification(message, style string) {
 	notifications, _ := req.db.SessionManager.Get(req.request.Context(), "notifications").([]Notification)
-	notifications = append(notifications, Notification{message, style})
+	notifications = append(notifications, Notification{template.HTMLEscapeString(message), style})
 	req.db.SessionManager.Put(req.request.Context(), "notifications", notifications)
 }
 
@@ -148,18 +180,115 @@ func (req *Request) SeeOther(format string, args ...interface{}) {
 	req.statusWritten = true
 }
 
-// Login tries to log in a user. On success, the user id is stored in the session.
-func (req *Request) Login(mail string, enteredPass string) error {
+// ErrSecondFactor is returned by Login if the password is correct, but the user has enabled TOTP. LoginSecondFactor must be called then.
+var ErrSecondFactor = errors.New("second factor required")
+
+// A pending login waits for the second factor. It is stored in the session.
+const (
+	pendingLoginAttempts = 5
+	pendingLoginTimeout  = 5 * time.Minute
+)
+
+// Login tries to log in a user. On success, the user id is stored in the session. If remember is true, a "remember me" cookie is set, see startSession.
+// If the user has enabled TOTP, the user id is stored as pending login and ErrSecondFactor is returned.
+// After failed logins of the account or from the IP address, an ErrLoginThrottled is returned for some time.
+func (req *Request) Login(mail string, enteredPass string, remember bool) error {
 	if req.LoggedIn() {
 		return nil
 	}
-	if u, err := req.db.LoginUser(mail, enteredPass); err == nil {
-		req.User = u
-	} else {
+	var keys = []string{accountKey(mail), ipKey(req.ClientIP())}
+	if err := req.db.checkLoginThrottle(keys...); err != nil {
+		return err
+	}
+	u, err := req.db.LoginUser(mail, enteredPass)
+	if err != nil {
+		if recErr := req.db.recordLoginFailure(keys...); recErr != nil {
+			return recErr
+		}
 		return err // is ErrAuth if mail or enteredPass is wrong
 	}
+	if err := req.db.LoginFailureDB.DeleteLoginFailure(keys[0]); err != nil {
+		return err
+	}
+	hasTOTP, err := req.db.HasTOTP(u)
+	if err != nil {
+		return err
+	}
+	if hasTOTP {
+		var ctx = req.request.Context()
+		req.db.SessionManager.Put(ctx, "pending_uid", u.ID())
+		req.db.SessionManager.Put(ctx, "pending_ts", time.Now())
+		req.db.SessionManager.Put(ctx, "pending_attempts", 0)
+		req.db.SessionManager.Put(ctx, "pending_remember", remember)
+		return ErrSecondFactor
+	}
+	return req.completeLogin(u, remember)
+}
+
+// PendingLogin returns whether the session contains a login which waits for the second factor.
+func (req *Request) PendingLogin() bool {
+	return req.db.SessionManager.GetInt(req.request.Context(), "pending_uid") != 0
+}
+
+// LoginSecondFactor completes a pending login if the TOTP code or recovery code is correct.
+func (req *Request) LoginSecondFactor(code string) error {
+
+	var ctx = req.request.Context()
+	var sessMan = req.db.SessionManager
+
+	var uid = sessMan.GetInt(ctx, "pending_uid")
+	if uid == 0 {
+		return errors.New("no pending login")
+	}
+
+	if time.Since(sessMan.GetTime(ctx, "pending_ts")) > pendingLoginTimeout {
+		req.cancelPendingLogin()
+		return errors.New("login has timed out, please try again")
+	}
+
+	u, err := req.db.GetUser(uid)
+	if err != nil {
+		req.cancelPendingLogin()
+		return err
+	}
+
+	var keys = []string{accountKey(u.Name()), ipKey(req.ClientIP())}
+	if err := req.db.checkLoginThrottle(keys...); err != nil {
+		return err
+	}
+
+	if err := req.db.VerifySecondFactor(u, code); err != nil {
+		if recErr := req.db.recordLoginFailure(keys...); recErr != nil {
+			return recErr
+		}
+		var attempts = sessMan.GetInt(ctx, "pending_attempts") + 1
+		if attempts >= pendingLoginAttempts {
+			req.cancelPendingLogin()
+			return errors.New("too many wrong codes, please log in again")
+		}
+		sessMan.Put(ctx, "pending_attempts", attempts)
+		return err
+	}
+
+	var remember = sessMan.GetBool(ctx, "pending_remember")
+	req.cancelPendingLogin()
+	return req.completeLogin(u, remember)
+}
+
+func (req *Request) cancelPendingLogin() {
+	var ctx = req.request.Context()
+	req.db.SessionManager.Remove(ctx, "pending_uid")
+	req.db.SessionManager.Remove(ctx, "pending_ts")
+	req.db.SessionManager.Remove(ctx, "pending_attempts")
+	req.db.SessionManager.Remove(ctx, "pending_remember")
+}
+
+func (req *Request) completeLogin(u DBUser, remember bool) error {
+	if err := req.startSession(u, remember); err != nil {
+		return err
+	}
+	req.User = u
 	req.Success("Welcome %s!", req.User.Name())
-	req.db.SessionManager.Put(req.request.Context(), "uid", req.User.ID())
 	return nil
 }
 
@@ -167,10 +296,16 @@ func (req *Request) LoggedIn() bool {
 	return req.User.ID() != 0
 }
 
-// Logout removes the user id from the session and calls req.Cleanup().
+// Logout removes the user id from the session, deletes the session from the session index and the "remember me" cookie, and calls req.Cleanup().
 func (req *Request) Logout() {
 	if req.LoggedIn() {
-		req.db.SessionManager.Remove(req.request.Context(), "uid")
+		var ctx = req.request.Context()
+		_ = req.db.SessionIndexDB.DeleteSession(req.User.ID(), req.SessionID()) // ignore errors, the user id is removed from the session anyway
+		req.db.SessionManager.Remove(ctx, "uid")
+		req.db.SessionManager.Remove(ctx, sessionIDKey)
+	}
+	if _, err := req.request.Cookie(rememberCookie); err == nil {
+		req.setRememberCookie("", 0)
 	}
 	req.Cleanup()
 }
@@ -208,8 +343,33 @@ func (req *Request) IsHTML() bool {
 	}
 }
 
+// PostFormValue returns the value of a form field of a POST request, or an empty string. Classes can use it to handle forms.
+func (req *Request) PostFormValue(key string) string {
+	if req.request == nil || req.request.Method != http.MethodPost {
+		return ""
+	}
+	return req.request.PostFormValue(key)
+}
+
+// AuthError returns the error which occurred when authenticating with an API token.
+func (req *Request) AuthError() error {
+	return req.authErr
+}
+
+// APIToken returns the API token which the user has authenticated with, or nil.
+func (req *Request) APIToken() *APIToken {
+	if tu, ok := req.User.(TokenUser); ok {
+		return &tu.Token
+	}
+	return nil
+}
+
 // IsRootAdmin returns true if the user has admin permission for the root node.
+// API tokens which are limited to a subtree don't grant root admin permissions.
 func (req *Request) IsRootAdmin() bool {
+	if t := req.APIToken(); t != nil && !t.WholeSite() {
+		return false
+	}
 	// node id 1 is more robust than Node.Parent.Parent..., which relies on the consistency of the Parent field
 	if err := req.db.requireRule(Admin, RootID, req.User, nil); err == nil {
 		return true
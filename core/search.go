@@ -0,0 +1,120 @@
+package core
+
+import (
+	"errors"
+	"strings"
+)
+
+// A SearchResult is a node which matches a search term.
+type SearchResult struct {
+	*Node
+	InContent bool // the term has been found in the content, not in the path
+}
+
+// SearchNodes finds nodes whose path contains the term, or whose content contains the term. It returns only nodes which the user can read.
+// The content of unreleased versions is only searched if the user can edit the node.
+func (c *CoreDB) SearchNodes(u DBUser, term string, limit int) ([]SearchResult, error) {
+
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return []SearchResult{}, nil
+	}
+
+	// the last segment of a path fragment is used to find slugs
+	var slugTerm = term
+	if segments := strings.Split(strings.Trim(term, "/"), "/"); len(segments) > 0 {
+		slugTerm = segments[len(segments)-1]
+	}
+
+	var lowerTerm = strings.ToLower(term)
+	var results = []SearchResult{}
+	var batch = 4 * limit // some candidates will be filtered out
+
+	// fetch candidates in batches until enough of them are readable or there are no more candidates
+	for offset := 0; len(results) < limit; offset += batch {
+
+		candidates, err := c.NodeDB.SearchNodes(slugTerm, term, batch, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range candidates {
+
+			if len(results) >= limit {
+				break
+			}
+
+			result, ok, err := c.searchCandidate(u, candidate, lowerTerm)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				results = append(results, result)
+			}
+		}
+
+		if len(candidates) < batch {
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// searchCandidate returns whether the user can read the node and the node matches the lowercase term.
+func (c *CoreDB) searchCandidate(u DBUser, candidate DBNode, lowerTerm string) (SearchResult, bool, error) {
+
+	path, err := c.InternalPathByNodeID(candidate.ID())
+	if err != nil {
+		return SearchResult{}, false, err
+	}
+
+	n, err := c.Open(u, nil, NewQueue("/"+RootSlug+path))
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return SearchResult{}, false, nil
+		}
+		return SearchResult{}, false, err
+	}
+
+	if strings.Contains(strings.ToLower(n.Location()), lowerTerm) {
+		return SearchResult{Node: n}, true, nil
+	}
+
+	inContent, err := c.searchContent(u, n, lowerTerm)
+	if err != nil {
+		return SearchResult{}, false, err
+	}
+	return SearchResult{Node: n, InContent: true}, inContent, nil
+}
+
+// searchContent returns whether the latest version of the node contains the lowercase term, if the user can edit the node, or else the latest released version.
+func (c *CoreDB) searchContent(u DBUser, n *Node, lowerTerm string) (bool, error) {
+
+	var versionNo = n.MaxWGZeroVersionNo()
+
+	if n.MaxVersionNo() != versionNo {
+		latest, err := n.GetVersion(n.MaxVersionNo())
+		if err != nil {
+			return false, err
+		}
+		state, err := n.ReleaseState(latest, u)
+		if err != nil {
+			return false, err
+		}
+		if state.CanEditNode() {
+			versionNo = n.MaxVersionNo()
+		}
+	}
+
+	if versionNo == 0 {
+		return false, nil
+	}
+
+	v, err := n.GetVersion(versionNo)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Contains(strings.ToLower(v.Content()), lowerTerm), nil
+}
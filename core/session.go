@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wansing/perspective/util"
+)
+
+const sessionIDKey = "sid" // session key of a logged-in session
+
+// rememberCookie contains the "remember me" token. It is separate from the session cookie, so only sessions of users who have chosen "remember me" outlive the idle timeout and the browser session.
+const rememberCookie = "remember"
+
+const (
+	sessionIdleTimeout = 12 * time.Hour // for sessions without "remember me", equals the idle timeout of the session store
+	sessionTouch       = time.Minute    // LastSeen is updated at most once in this duration
+	maxUserAgentLength = 255
+)
+
+// A Session is an entry in the session index. It is created when a user logs in. Deleting it logs the user out of that session.
+// The session index is separate from the session store, because scs can't enumerate the sessions of a user.
+type Session struct {
+	ID           string // random, stored in the session data, not the session token
+	UserID       int
+	Created      int64
+	LastSeen     int64
+	UserAgent    string
+	IP           string
+	RememberHash string // SHA-256 hash of the token in the "remember me" cookie, empty if the user has not chosen "remember me"
+}
+
+// A SessionIndexDB stores the session index.
+type SessionIndexDB interface {
+	DeleteSession(userID int, id string) error
+	DeleteSessions(userID int, except string) error // except can be empty
+	DeleteStaleSessions(createdBefore, idleBefore int64) error
+	GetRememberedSession(rememberHash string) (Session, error) // returns an empty ID if the session does not exist
+	GetSession(id string) (Session, error)                     // returns an empty ID if the session does not exist
+	GetSessions(userID int) ([]Session, error)
+	InsertSession(s Session) error
+	TouchSession(id string, ts int64) error
+}
+
+// Remember returns whether the user has chosen "remember me". Then the idle timeout does not apply.
+func (s Session) Remember() bool {
+	return s.RememberHash != ""
+}
+
+// idle returns whether the session has exceeded the idle timeout.
+func (s Session) idle(now time.Time) bool {
+	return !s.Remember() && now.Sub(time.Unix(s.LastSeen, 0)) > sessionIdleTimeout
+}
+
+// RevokeSession deletes a session of the user from the session index. The user is logged out of that session on the next request.
+func (c *CoreDB) RevokeSession(actor DBUser, u DBUser, s Session) error {
+	if err := c.SessionIndexDB.DeleteSession(u.ID(), s.ID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditRevokeSession, 0, "%s: session from %s", u.Name(), s.IP)
+}
+
+// LogoutEverywhere deletes all sessions of the user, except the given one, from the session index.
+func (c *CoreDB) LogoutEverywhere(actor DBUser, u DBUser, except string) error {
+	if err := c.SessionIndexDB.DeleteSessions(u.ID(), except); err != nil {
+		return err
+	}
+	if except != "" {
+		return c.audit(actor, AuditLogoutEverywhere, 0, "%s (except the current session)", u.Name())
+	}
+	return c.audit(actor, AuditLogoutEverywhere, 0, "%s", u.Name())
+}
+
+// DeleteStaleSessions removes sessions which have exceeded the lifetime or the idle timeout.
+func (c *CoreDB) DeleteStaleSessions() error {
+	var now = time.Now()
+	return c.SessionIndexDB.DeleteStaleSessions(now.Add(-c.SessionManager.Lifetime).Unix(), now.Add(-sessionIdleTimeout).Unix())
+}
+
+// checkSession returns whether the session of a logged-in user is still in the session index. If not, the user id is removed from the session.
+func (c *CoreDB) checkSession(ctx context.Context, uid int) (bool, error) {
+
+	var now = time.Now()
+
+	s, err := c.SessionIndexDB.GetSession(c.SessionManager.GetString(ctx, sessionIDKey))
+	if err != nil {
+		return false, err
+	}
+
+	if s.ID != "" && s.UserID == uid && s.idle(now) {
+		if err := c.SessionIndexDB.DeleteSession(uid, s.ID); err != nil {
+			return false, err
+		}
+		s = Session{}
+	}
+
+	if s.ID == "" || s.UserID != uid { // revoked, or created before the session index existed
+		c.SessionManager.Remove(ctx, "uid")
+		c.SessionManager.Remove(ctx, sessionIDKey)
+		return false, nil
+	}
+
+	if now.Sub(time.Unix(s.LastSeen, 0)) > sessionTouch {
+		if err := c.SessionIndexDB.TouchSession(s.ID, now.Unix()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// startSession renews the session token, which prevents session fixation, and adds the session to the session index.
+// If remember is true, it sets a "remember me" cookie, so restoreSession can log the user in again after the session has ended.
+func (req *Request) startSession(u DBUser, remember bool) error {
+
+	var ctx = req.request.Context()
+
+	if err := req.db.SessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+
+	id, err := util.RandomString32()
+	if err != nil {
+		return err
+	}
+
+	var rememberToken string
+	if remember {
+		if rememberToken, err = util.RandomString32(); err != nil {
+			return err
+		}
+	}
+
+	var userAgent = req.request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	var now = time.Now().Unix()
+	var s = Session{
+		ID:        id,
+		UserID:    u.ID(),
+		Created:   now,
+		LastSeen:  now,
+		UserAgent: userAgent,
+		IP:        req.ClientIP(),
+	}
+	if remember {
+		s.RememberHash = hashToken(rememberToken)
+	}
+	if err := req.db.SessionIndexDB.InsertSession(s); err != nil {
+		return err
+	}
+
+	req.db.SessionManager.Put(ctx, "uid", u.ID())
+	req.db.SessionManager.Put(ctx, sessionIDKey, id)
+	if remember {
+		req.setRememberCookie(rememberToken, req.db.SessionManager.Lifetime)
+	}
+	return nil
+}
+
+// restoreSession logs the user in again if the session has ended, but the browser sends the "remember me" cookie of a session which is still in the session index.
+func (req *Request) restoreSession() (DBUser, error) {
+
+	cookie, err := req.request.Cookie(rememberCookie)
+	if err != nil {
+		return nil, nil // no cookie
+	}
+
+	s, err := req.db.SessionIndexDB.GetRememberedSession(hashToken(cookie.Value))
+	if err != nil {
+		return nil, err
+	}
+
+	var now = time.Now()
+	if s.ID == "" || now.Sub(time.Unix(s.Created, 0)) > req.db.SessionManager.Lifetime {
+		req.setRememberCookie("", 0) // revoked or expired
+		return nil, nil
+	}
+
+	u, err := req.db.UserDB.GetUser(s.UserID)
+	if err != nil {
+		req.setRememberCookie("", 0) // user has been deleted
+		return nil, nil
+	}
+
+	var ctx = req.request.Context()
+	if err := req.db.SessionManager.RenewToken(ctx); err != nil {
+		return nil, err
+	}
+	if err := req.db.SessionIndexDB.TouchSession(s.ID, now.Unix()); err != nil {
+		return nil, err
+	}
+	req.db.SessionManager.Put(ctx, "uid", u.ID())
+	req.db.SessionManager.Put(ctx, sessionIDKey, s.ID)
+	return u, nil
+}
+
+// setRememberCookie sets the "remember me" cookie. If token is empty, the cookie is deleted.
+func (req *Request) setRememberCookie(token string, lifetime time.Duration) {
+
+	var config = req.db.SessionManager.Cookie
+	var cookie = &http.Cookie{
+		Name:     rememberCookie,
+		Value:    token,
+		Path:     config.Path,
+		Domain:   config.Domain,
+		Secure:   config.Secure,
+		HttpOnly: true,
+		SameSite: config.SameSite,
+	}
+
+	if token == "" {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = time.Now().Add(lifetime)
+		cookie.MaxAge = int(lifetime.Seconds())
+	}
+
+	http.SetCookie(req.writer, cookie)
+}
+
+// SessionID returns the id of the current session in the session index, or an empty string if the user is not logged in.
+func (req *Request) SessionID() string {
+	return req.db.SessionManager.GetString(req.request.Context(), sessionIDKey)
+}
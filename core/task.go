@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+)
+
+// A Task is a node whose latest version waits for the user.
+type Task struct {
+	*Node
+	Version *Version
+	State   ReleaseState
+}
+
+// GetTasks returns the nodes whose latest version is in a workflow group which the user is a member of, or from which the user can release it. Oldest versions come first.
+func (c *CoreDB) GetTasks(u DBUser) ([]*Task, error) {
+
+	groupIDs, err := c.taskGroupIDs(u)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeVersions, err := c.NodeDB.GetLatestVersionsInWorkflowGroups(groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks = []*Task{}
+
+	for _, nv := range nodeVersions {
+
+		path, err := c.InternalPathByNodeID(nv.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := c.Open(u, nil, NewQueue("/"+RootSlug+path)) // sets n.Parent, which is required for determining the workflow
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				continue
+			}
+			return nil, err
+		}
+
+		var v = NewVersion(nv)
+
+		state, err := n.ReleaseState(v, u)
+		if err != nil {
+			return nil, err
+		}
+
+		isMember, err := state.WorkflowGroup().HasMember(u)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isMember && state.ReleaseToGroup() == nil {
+			continue // the workflow of the node does not refer to the user
+		}
+
+		tasks = append(tasks, &Task{
+			Node:    n,
+			Version: v,
+			State:   state,
+		})
+	}
+
+	return tasks, nil
+}
+
+// taskGroupIDs returns the ids of the workflow groups which the user is a member of, and of the workflow groups before them.
+// This is a superset, so the query is efficient and the exact check can be done by the ReleaseState.
+func (c *CoreDB) taskGroupIDs(u DBUser) ([]int, error) {
+
+	workflows, err := c.GetAllWorkflows(10000, 0) // assuming there are not more than 10k workflows
+	if err != nil {
+		return nil, err
+	}
+
+	var ids = []int{}
+	var seen = make(map[int]interface{})
+
+	for _, workflow := range workflows {
+
+		groups, err := workflow.Groups()
+		if err != nil {
+			return nil, err
+		}
+
+		var last = -1 // index of the last group which the user is a member of
+		for i, group := range groups {
+			isMember, err := group.HasMember(u)
+			if err != nil {
+				return nil, err
+			}
+			if isMember {
+				last = i
+			}
+		}
+
+		for i := 0; i <= last; i++ {
+			if _, ok := seen[groups[i].ID()]; !ok {
+				seen[groups[i].ID()] = struct{}{}
+				ids = append(ids, groups[i].ID())
+			}
+		}
+	}
+
+	return ids, nil
+}
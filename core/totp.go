@@ -0,0 +1,225 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters, see RFC 6238. They are the defaults of common authenticator apps.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 // seconds
+	TOTPSkew   = 1  // accepted periods before and after the current one
+)
+
+// RecoveryCodeCount is the number of recovery codes which are generated when TOTP is enabled.
+const RecoveryCodeCount = 10
+
+var ErrInvalidCode = errors.New("invalid code")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// A TOTPDB stores TOTP secrets and recovery codes of users, and the groups whose members must use TOTP.
+//
+// Recovery codes are stored as SHA-256 hashes.
+type TOTPDB interface {
+	DeleteTOTP(userID int) error                                      // removes the secret and the recovery codes
+	GetTOTPRequiredGroups() (map[int]bool, error)                     // group ids
+	GetTOTPSecret(userID int) (string, error)                         // returns an empty string if TOTP is not enabled
+	SetTOTP(userID int, secret string, recoveryHashes []string) error // replaces the secret and the recovery codes
+	SetTOTPRequired(groupID int, required bool) error
+	UseRecoveryCode(userID int, hash string) (bool, error) // removes the code, returns false if it does not exist
+	UseTOTPStep(userID int, step int64) (bool, error)      // stores the step, returns false if it is not later than the last used step
+}
+
+// NewTOTPSecret returns a random base32-encoded secret.
+func NewTOTPSecret() (string, error) {
+	var secret = make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI of a secret, which is usually presented as QR code.
+func TOTPURI(issuer, account, secret string) string {
+	var params = url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", TOTPPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + params.Encode()
+}
+
+// totpCode computes the HOTP value (RFC 4226) of the given step.
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg = make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	var mac = hmac.New(sha1.New, key)
+	mac.Write(msg)
+	var sum = mac.Sum(nil)
+	var offset = sum[len(sum)-1] & 0x0f
+	var value = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000), nil
+}
+
+// validateTOTP returns the step which matches the code, considering TOTPSkew.
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	var current = now.Unix() / TOTPPeriod
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hashRecoveryCode normalizes and hashes a recovery code.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	var sum = sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes returns RecoveryCodeCount random codes, formatted like "abcde-fghij".
+func newRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789" // without 0, 1, l, o
+	var codes = make([]string, RecoveryCodeCount)
+	for i := range codes {
+		var raw = make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j := range raw {
+			raw[j] = alphabet[int(raw[j])%len(alphabet)]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+	}
+	return codes, nil
+}
+
+// HasTOTP returns whether the user has enabled TOTP.
+func (c *CoreDB) HasTOTP(u DBUser) (bool, error) {
+	secret, err := c.TOTPDB.GetTOTPSecret(u.ID())
+	return secret != "", err
+}
+
+// EnableTOTP stores the secret if the code matches it. It returns new recovery codes, which must be shown to the user.
+func (c *CoreDB) EnableTOTP(actor DBUser, u DBUser, secret, code string) ([]string, error) {
+
+	step, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	recoveryCodes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes = make([]string, len(recoveryCodes))
+	for i, rc := range recoveryCodes {
+		hashes[i] = hashRecoveryCode(rc)
+	}
+
+	if err := c.TOTPDB.SetTOTP(u.ID(), secret, hashes); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.TOTPDB.UseTOTPStep(u.ID(), step); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, c.audit(actor, AuditEnableTOTP, 0, "%s", u.Name())
+}
+
+// DisableTOTP removes the TOTP secret and the recovery codes of the user. Root admins use it to reset the second factor of users who have lost it.
+func (c *CoreDB) DisableTOTP(actor DBUser, u DBUser) error {
+	if err := c.TOTPDB.DeleteTOTP(u.ID()); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditDisableTOTP, 0, "%s", u.Name())
+}
+
+// VerifySecondFactor checks a TOTP code or a recovery code of the user. Each TOTP code and each recovery code can be used only once.
+func (c *CoreDB) VerifySecondFactor(u DBUser, code string) error {
+
+	secret, err := c.TOTPDB.GetTOTPSecret(u.ID())
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return errors.New("TOTP is not enabled")
+	}
+
+	if step, ok := validateTOTP(secret, code, time.Now()); ok {
+		fresh, err := c.TOTPDB.UseTOTPStep(u.ID(), step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidCode // replay
+		}
+		return nil
+	}
+
+	used, err := c.TOTPDB.UseRecoveryCode(u.ID(), hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return c.audit(u, AuditUseRecoveryCode, 0, "%s", u.Name())
+}
+
+// TOTPRequired returns whether the user is a member of a group which requires TOTP.
+func (c *CoreDB) TOTPRequired(u DBUser) (bool, error) {
+
+	required, err := c.TOTPDB.GetTOTPRequiredGroups()
+	if err != nil || len(required) == 0 {
+		return false, err
+	}
+
+	groups, err := c.GroupDB.GetGroupsOf(u)
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range groups {
+		if required[g.ID()] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetTOTPRequired shadows TOTPDB.SetTOTPRequired.
+func (c *CoreDB) SetTOTPRequired(actor DBUser, g DBGroup, required bool) error {
+	if err := c.TOTPDB.SetTOTPRequired(g.ID(), required); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditSetTOTPRequired, 0, "%s: %t", g.Name(), required)
+}
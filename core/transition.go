@@ -0,0 +1,31 @@
+package core
+
+// A DBTransition records that a version has been moved from one workflow group to another.
+type DBTransition interface {
+	VersionNo() int
+	FromGroupID() int
+	ToGroupID() int
+	UserID() int
+	Username() string // stored redundantly, so the transition remains meaningful if the user is deleted
+	Ts() int64
+	Comment() string
+}
+
+type TransitionDB interface {
+	DeleteTransitions(nodeID int) error
+	GetTransitions(nodeID int) ([]DBTransition, error) // chronologically ascending
+	InsertTransition(nodeID, versionNo, fromGroupID, toGroupID, userID int, username string, ts int64, comment string) error
+}
+
+// GetTransitions returns the workflow transitions of all versions of the node: version number -> transitions
+func (n *Node) GetTransitions() (map[int][]DBTransition, error) {
+	var transitions, err = n.db.TransitionDB.GetTransitions(n.ID())
+	if err != nil {
+		return nil, err
+	}
+	var result = make(map[int][]DBTransition)
+	for _, t := range transitions {
+		result[t.VersionNo()] = append(result[t.VersionNo()], t)
+	}
+	return result, nil
+}
@@ -23,12 +23,35 @@ type UserDB interface {
 
 var ErrEmptyPassword = errors.New("refusing to set empty password")
 
-// shadows UserDB.SetPassword
+// ChangePassword shadows UserDB.ChangePassword. All sessions of the user except keepSessionID are deleted, so sessions which might have been taken over are logged out.
+func (c *CoreDB) ChangePassword(actor DBUser, u DBUser, old, new, keepSessionID string) error {
+	if err := c.UserDB.ChangePassword(u, old, new); err != nil {
+		return err
+	}
+	if err := c.SessionIndexDB.DeleteSessions(u.ID(), keepSessionID); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditChangePassword, 0, "%s", u.Name())
+}
+
+// InsertUser shadows UserDB.InsertUser.
+func (c *CoreDB) InsertUser(actor DBUser, name string) (DBUser, error) {
+	u, err := c.UserDB.InsertUser(name)
+	if err != nil {
+		return nil, err
+	}
+	return u, c.audit(actor, AuditInsertUser, 0, "%s", u.Name())
+}
+
+// shadows UserDB.SetPassword, logs the user out everywhere
 func (c *CoreDB) SetPassword(u DBUser, password string) error {
 	if password == "" {
 		return ErrEmptyPassword
 	}
-	return c.UserDB.SetPassword(u, password)
+	if err := c.UserDB.SetPassword(u, password); err != nil {
+		return err
+	}
+	return c.SessionIndexDB.DeleteSessions(u.ID(), "")
 }
 
 // RequirePermission returns an error if the given user does not have the given permission on the node.
@@ -52,13 +75,17 @@ func (n *Node) RequirePermissionRules(perm Permission, u DBUser) (map[int]map[in
 // requirePermission calls requirePermissionRecursive. On failure, it makes use of the convention that "edit" implies "read".
 func (n *Node) requirePermission(perm Permission, u DBUser, permittingRules *map[int]map[int]interface{}) error {
 
+	if !tokenAllows(u, perm, n) {
+		return ErrUnauthorized
+	}
+
 	if err := n.requirePermissionRecursive(perm, u, permittingRules); err == nil {
 		return nil
 	}
 
 	// every member of any workflow group can read
 
-	if perm == Read {
+	if perm == Read && u != nil {
 
 		workflow, err := n.GetWorkflow()
 		if err != nil {
@@ -71,7 +98,7 @@ func (n *Node) requirePermission(perm Permission, u DBUser, permittingRules *map
 		}
 
 		for _, group := range groups {
-			hasMember, err := group.HasMember(u)
+			hasMember, err := groupHasMember(group, u)
 			if err != nil {
 				return err
 			}
@@ -84,31 +111,36 @@ func (n *Node) requirePermission(perm Permission, u DBUser, permittingRules *map
 	return ErrUnauthorized
 }
 
+// requirePermissionRecursive checks the access rules of the node and its ancestors, see the package documentation for the precedence.
 func (n *Node) requirePermissionRecursive(perm Permission, u DBUser, permittingRules *map[int]map[int]interface{}) error {
 
 	if n == nil {
 		return ErrUnauthorized
 	}
 
-	if err := n.db.requireRule(perm, n.ID(), u, permittingRules); err == nil {
-		return nil
-	}
+	for p := n; p != nil; p = p.Parent {
 
-	// recursion
-	if n.Parent != nil {
-		if err := n.Parent.requirePermissionRecursive(perm, u, permittingRules); err == nil {
+		err := n.db.requireRule(perm, p.ID(), u, permittingRules)
+		if err == nil {
 			return nil
 		}
-	}
+		if errors.Is(err, errDenied) {
+			break
+		}
 
-	return ErrUnauthorized
-}
+		blocked, err := n.db.IsInheritanceBlocked(p.ID())
+		if err != nil {
+			return err
+		}
+		if blocked {
+			break
+		}
+	}
 
-// ReleaseState returns the ReleaseState which describes the relation between a node, a version and a user.
-func (n *Node) ReleaseState(v DBVersion, u DBUser) (*ReleaseState, error) {
-	var workflow, err = n.GetWorkflow()
-	if err != nil {
-		return nil, err
+	// admin rules of the root node apply everywhere, so root admins can't lock themselves out
+	if err := n.db.requireRule(Admin, RootID, u, permittingRules); err == nil {
+		return nil
 	}
-	return GetReleaseState(workflow, v.WorkflowGroupID(), u)
+
+	return ErrUnauthorized
 }
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ValidityLayout is the format of validity bounds in forms, as submitted by datetime-local input elements.
+const ValidityLayout = "2006-01-02T15:04"
+
+// A Validity is the time window in which an access rule or a group membership applies. Bounds are unix timestamps, zero means unbounded.
+type Validity struct {
+	From  int64 // inclusive
+	Until int64 // exclusive
+}
+
+// ParseValidity parses the bounds of a validity in ValidityLayout (or as a date only), using the local time zone. Empty strings are unbounded.
+func ParseValidity(from, until string) (Validity, error) {
+	var v Validity
+	var err error
+	if v.From, err = parseValidityBound(from); err != nil {
+		return v, err
+	}
+	if v.Until, err = parseValidityBound(until); err != nil {
+		return v, err
+	}
+	if v.From != 0 && v.Until != 0 && v.From >= v.Until {
+		return v, errors.New("validity must start before it ends")
+	}
+	return v, nil
+}
+
+func parseValidityBound(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	for _, layout := range []string{ValidityLayout, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid date: %s", s)
+}
+
+// Limited returns whether the validity has any bound.
+func (v Validity) Limited() bool {
+	return v.From != 0 || v.Until != 0
+}
+
+// Active returns whether the validity includes the given timestamp.
+func (v Validity) Active(ts int64) bool {
+	return (v.From == 0 || v.From <= ts) && (v.Until == 0 || ts < v.Until)
+}
+
+// Expired returns whether the validity has ended before the given timestamp.
+func (v Validity) Expired(ts int64) bool {
+	return v.Until != 0 && v.Until <= ts
+}
+
+// ActiveNow returns whether the validity includes the current time.
+func (v Validity) ActiveNow() bool {
+	return v.Active(time.Now().Unix())
+}
+
+// String returns a human-readable description of the validity, or an empty string if it is unbounded.
+func (v Validity) String() string {
+	const layout = "2.1.2006 15:04"
+	switch {
+	case v.From != 0 && v.Until != 0:
+		return fmt.Sprintf("from %s until %s", time.Unix(v.From, 0).Format(layout), time.Unix(v.Until, 0).Format(layout))
+	case v.From != 0:
+		return fmt.Sprintf("from %s", time.Unix(v.From, 0).Format(layout))
+	case v.Until != 0:
+		return fmt.Sprintf("until %s", time.Unix(v.Until, 0).Format(layout))
+	default:
+		return ""
+	}
+}
+
+// suffix returns the string representation with a leading space, or an empty string if the validity is unbounded.
+func (v Validity) suffix() string {
+	if !v.Limited() {
+		return ""
+	}
+	return " " + v.String()
+}
+
+// A TimedAccessRule is an access rule with a limited validity.
+type TimedAccessRule struct {
+	NodeID     int
+	GroupID    int
+	Permission int
+	Validity
+}
+
+// DeleteExpired removes access rules and group memberships which have expired before the given time.
+func (c *CoreDB) DeleteExpired(before time.Time) error {
+	rules, err := c.AccessDB.DeleteExpiredAccessRules(before.Unix())
+	if err != nil {
+		return err
+	}
+	memberships, err := c.GroupDB.DeleteExpiredMemberships(before.Unix())
+	if err != nil {
+		return err
+	}
+	if rules == 0 && memberships == 0 {
+		return nil
+	}
+	return c.audit(nil, AuditDeleteExpired, 0, "%d access rules, %d group memberships", rules, memberships)
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ViewAsKey is the session key which stores whom a root admin views the site as.
+// Its values are "guest", "user:<id>" and "group:<id>".
+const ViewAsKey = "view_as"
+
+// A GroupViewer is an artificial user who is a member of exactly one group (and its supergroups). It is used for viewing the site as a member of that group.
+type GroupViewer struct {
+	Group  DBGroup
+	Groups []DBGroup // Group and its supergroups
+}
+
+func (gv GroupViewer) ID() int {
+	return -1 // not zero, else it would be a guest
+}
+
+func (gv GroupViewer) Name() string {
+	return "a member of " + gv.Group.Name()
+}
+
+// groupsOf returns the groups of a user. A GroupViewer is a member of its group and its supergroups only, OtherUsers is a member of no group.
+func (c *CoreDB) groupsOf(u DBUser) ([]DBGroup, error) {
+	if gv, ok := u.(GroupViewer); ok {
+		return gv.Groups, nil
+	}
+	if _, ok := u.(OtherUsers); ok {
+		return nil, nil
+	}
+	return c.GroupDB.GetGroupsOf(u)
+}
+
+// groupHasMember calls group.HasMember, unless u is a GroupViewer.
+func groupHasMember(group DBGroup, u DBUser) (bool, error) {
+	if gv, ok := u.(GroupViewer); ok && group.ID() != 0 { // id 0 is AllUsers or Readers, which don't care about the user
+		for _, g := range gv.Groups {
+			if g.ID() == group.ID() {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return group.HasMember(u)
+}
+
+// ViewAsIdentity returns the user which a ViewAsKey session value refers to.
+func (c *CoreDB) ViewAsIdentity(value string) (DBUser, error) {
+
+	if value == "guest" {
+		return Guest{}, nil
+	}
+
+	var kind, idStr = value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		kind, idStr = value[:i], value[i+1:]
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid view as value: %s", value)
+	}
+
+	switch kind {
+	case "user":
+		return c.UserDB.GetUser(id)
+	case "group":
+		if id == 0 {
+			return nil, errors.New("use guest instead of all users")
+		}
+		group, err := c.GroupDB.GetGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		supergroups, err := c.GroupDB.GetSupergroups(group)
+		if err != nil {
+			return nil, err
+		}
+		return GroupViewer{group, append([]DBGroup{group}, supergroups...)}, nil
+	default:
+		return nil, fmt.Errorf("invalid view as value: %s", value)
+	}
+}
+
+// ApplyViewAs replaces Request.User by the identity which a root admin has chosen to view the site as.
+// It is called by the frontend only, so the backend still works with the actual user.
+func (req *Request) ApplyViewAs() {
+
+	var value = req.db.SessionManager.GetString(req.request.Context(), ViewAsKey)
+	if value == "" || !req.IsRootAdmin() {
+		return
+	}
+
+	identity, err := req.db.ViewAsIdentity(value)
+	if err != nil {
+		return
+	}
+
+	req.User = identity
+	req.viewingAs = true
+}
+
+// ViewingAs returns the identity which the site is viewed as, or nil.
+func (req *Request) ViewingAs() DBUser {
+	if req.viewingAs {
+		return req.User
+	}
+	return nil
+}
+
+// ViewAsName returns the name of the identity which the user has chosen to view the site as, or an empty string.
+// Unlike ViewingAs, it works in the backend, where the identity is not applied.
+func (req *Request) ViewAsName() string {
+	var value = req.db.SessionManager.GetString(req.request.Context(), ViewAsKey)
+	if value == "" {
+		return ""
+	}
+	identity, err := req.db.ViewAsIdentity(value)
+	if err != nil {
+		return ""
+	}
+	return identity.Name()
+}
@@ -3,12 +3,15 @@ package core
 import (
 	"bytes"
 	"errors"
+	"fmt"
 )
 
 type DBWorkflow interface {
 	ID() int
 	Name() string
 	Groups() ([]int, error) // can be empty
+	Model() string          // see WorkflowModels
+	RequiredApprovals() int // used by ApprovalModel only
 }
 
 type WorkflowDB interface {
@@ -16,6 +19,7 @@ type WorkflowDB interface {
 	GetAllWorkflows(limit, offset int) ([]DBWorkflow, error)
 	GetWorkflow(id int) (DBWorkflow, error)
 	InsertWorkflow(name string) error
+	SetModel(w DBWorkflow, model string, requiredApprovals int) error
 	UpdateWorkflow(w DBWorkflow, groups []int) error
 	Writeable() bool
 }
@@ -89,12 +93,43 @@ func (c *CoreDB) GetWorkflow(id int) (*Workflow, error) {
 	}, err
 }
 
+// InsertWorkflow shadows WorkflowDB.InsertWorkflow.
+func (c *CoreDB) InsertWorkflow(actor DBUser, name string) error {
+	if err := c.WorkflowDB.InsertWorkflow(name); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditInsertWorkflow, 0, "%s", name)
+}
+
+// SetModel shadows WorkflowDB.SetModel.
+func (c *CoreDB) SetModel(actor DBUser, w DBWorkflow, model string, requiredApprovals int) error {
+	var known = false
+	for _, m := range WorkflowModels {
+		if m == model {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown workflow model: %s", model)
+	}
+	if requiredApprovals < 1 {
+		return errors.New("at least one approval is required")
+	}
+	if err := c.WorkflowDB.SetModel(w, model, requiredApprovals); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditSetWorkflowModel, 0, "%s: %s, %d approvals", w.Name(), model, requiredApprovals)
+}
+
 // UpdateWorkflow shadows WorkflowDB.UpdateWorkflow.
-func (c *CoreDB) UpdateWorkflow(w DBWorkflow, groupIDs []int) error {
+func (c *CoreDB) UpdateWorkflow(actor DBUser, w DBWorkflow, groupIDs []int) error {
 	for _, groupID := range groupIDs {
 		if groupID == 0 {
 			return errors.New("all users is not allowed in workflow")
 		}
 	}
-	return c.WorkflowDB.UpdateWorkflow(w, groupIDs)
+	if err := c.WorkflowDB.UpdateWorkflow(w, groupIDs); err != nil {
+		return err
+	}
+	return c.audit(actor, AuditUpdateWorkflow, 0, "%s: groups %v", w.Name(), groupIDs)
 }
@@ -6,11 +6,15 @@ require (
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20200729112010-8c9ddd400378
 	github.com/alexedwards/scs/sqlite3store v0.0.0-20200729112010-8c9ddd400378
 	github.com/alexedwards/scs/v2 v2.4.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.3.0
 	github.com/icza/gox v0.0.0-20200702115100-7dc3510ae515
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/shurcooL/httpfs v0.0.0-20190707220628-8d4bc4ba7749 // indirect
 	github.com/shurcooL/vfsgen v0.0.0-20200824052919-0d455de96546 // indirect
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/xo/dburl v0.0.0-20200727080105-4a02649c2fea
 	gitlab.com/golang-commonmark/markdown v0.0.0-20191127184510-91b5b3c99c19
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
@@ -0,0 +1,216 @@
+// Package ldapdb implements read-only core.UserDB and core.GroupDB backed by an LDAP directory.
+//
+// Users and groups are loaded from the directory at once and cached. Users log in by binding with their DN and password.
+// Because the rest of perspective refers to users and groups by integer ids, ids are assigned in an SQL table, keyed by the (lowercase) name.
+package ldapdb
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrReadOnly = errors.New("the LDAP directory is read-only")
+
+// Config configures the connection and the schema of the directory.
+type Config struct {
+	URL          string // like ldap://localhost:389 or ldaps://ldap.example.com
+	BindDN       string // used for searching, empty for anonymous search
+	BindPassword string
+	UserBase     string
+	UserFilter   string // like (objectClass=inetOrgPerson)
+	UserAttr     string // attribute which is used as user name and login, like mail or uid
+	GroupBase    string
+	GroupFilter  string // like (objectClass=groupOfNames)
+	GroupAttr    string // attribute which is used as group name, like cn
+	MemberAttr   string // attribute of group entries which contains the DNs of members and subgroups, like member
+	MemberOfAttr string // attribute of user entries which contains the DNs of their groups, like memberOf, can be empty
+	CacheTTL     time.Duration
+}
+
+// A Directory caches the users and groups of an LDAP directory.
+type Directory struct {
+	Config
+	Dial func() (*ldap.Conn, error) // can be replaced, for example to connect to a test server
+
+	ids *ids
+
+	mutex    sync.Mutex
+	snap     *snapshot
+	loadedAt time.Time
+}
+
+func NewDirectory(db *sql.DB, config Config) *Directory {
+	var dir = &Directory{
+		Config: config,
+		ids:    newIDs(db),
+	}
+	dir.Dial = func() (*ldap.Conn, error) {
+		return ldap.DialURL(dir.URL)
+	}
+	return dir
+}
+
+// snapshot returns the cached content of the directory, reloading it if the cache has expired.
+func (dir *Directory) snapshot() (*snapshot, error) {
+	dir.mutex.Lock()
+	defer dir.mutex.Unlock()
+	if dir.snap == nil || time.Since(dir.loadedAt) > dir.CacheTTL {
+		snap, err := dir.load()
+		if err != nil {
+			if dir.snap != nil {
+				return dir.snap, nil // keep serving the stale snapshot if the directory is unavailable
+			}
+			return nil, err
+		}
+		dir.snap = snap
+		dir.loadedAt = time.Now()
+	}
+	return dir.snap, nil
+}
+
+// Invalidate clears the cache.
+func (dir *Directory) Invalidate() {
+	dir.mutex.Lock()
+	dir.snap = nil
+	dir.mutex.Unlock()
+}
+
+func (dir *Directory) search(conn *ldap.Conn, base, filter string, attrs ...string) ([]*ldap.Entry, error) {
+	res, err := conn.SearchWithPaging(
+		ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, attrs, nil),
+		500,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+// load reads all users and groups from the directory.
+func (dir *Directory) load() (*snapshot, error) {
+
+	conn, err := dir.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if dir.BindDN != "" {
+		if err := conn.Bind(dir.BindDN, dir.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	var userAttrs = []string{dir.UserAttr}
+	if dir.MemberOfAttr != "" {
+		userAttrs = append(userAttrs, dir.MemberOfAttr)
+	}
+
+	userEntries, err := dir.search(conn, dir.UserBase, dir.UserFilter, userAttrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	groupEntries, err := dir.search(conn, dir.GroupBase, dir.GroupFilter, dir.GroupAttr, dir.MemberAttr)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap = newSnapshot()
+
+	for _, entry := range groupEntries {
+		var name = entry.GetAttributeValue(dir.GroupAttr)
+		if name == "" {
+			continue
+		}
+		id, err := dir.ids.groupID(name)
+		if err != nil {
+			return nil, err
+		}
+		snap.addGroup(&group{
+			id:            id,
+			name:          name,
+			dn:            normalizeDN(entry.DN),
+			directMembers: make(map[int]interface{}),
+			subgroups:     make(map[int]interface{}),
+		})
+	}
+
+	for _, entry := range userEntries {
+		var name = entry.GetAttributeValue(dir.UserAttr)
+		if name == "" {
+			continue
+		}
+		id, err := dir.ids.userID(name)
+		if err != nil {
+			return nil, err
+		}
+		var u = &user{
+			id:   id,
+			name: name,
+			dn:   entry.DN,
+		}
+		snap.addUser(u)
+		if dir.MemberOfAttr != "" {
+			for _, groupDN := range entry.GetAttributeValues(dir.MemberOfAttr) {
+				if g, ok := snap.groupByDN[normalizeDN(groupDN)]; ok {
+					g.directMembers[u.id] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for _, entry := range groupEntries {
+		g, ok := snap.groupByDN[normalizeDN(entry.DN)]
+		if !ok {
+			continue
+		}
+		for _, memberDN := range entry.GetAttributeValues(dir.MemberAttr) {
+			memberDN = normalizeDN(memberDN)
+			if u, ok := snap.userByDN[memberDN]; ok {
+				g.directMembers[u.id] = struct{}{}
+			} else if sub, ok := snap.groupByDN[memberDN]; ok && sub.id != g.id {
+				g.subgroups[sub.id] = struct{}{}
+			}
+		}
+	}
+
+	snap.resolve()
+	return snap, nil
+}
+
+// login binds with the DN of the user and the password.
+func (dir *Directory) login(dn, password string) error {
+
+	if password == "" {
+		return errors.New("empty password") // an empty password would result in an unauthenticated bind, which succeeds
+	}
+
+	conn, err := dir.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Bind(dn, password)
+}
+
+func normalizeDN(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		var rdns = make([]string, len(parsed.RDNs))
+		for i, rdn := range parsed.RDNs {
+			var attrs = make([]string, len(rdn.Attributes))
+			for j, attr := range rdn.Attributes {
+				attrs[j] = strings.ToLower(attr.Type) + "=" + strings.ToLower(attr.Value)
+			}
+			rdns[i] = strings.Join(attrs, "+")
+		}
+		return strings.Join(rdns, ",")
+	}
+	return strings.ToLower(dn)
+}
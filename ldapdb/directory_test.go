@@ -0,0 +1,436 @@
+package ldapdb
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/wansing/perspective/core"
+)
+
+// testServer is a minimal in-process LDAP server. It supports simple binds and searches with equality, presence and "and" filters. Paging controls are ignored.
+type testServer struct {
+	mutex     sync.Mutex
+	entries   []*ldap.Entry
+	passwords map[string]string // dn => password
+	bindDN    string            // if not empty, searches require a bind with this dn
+	down      bool              // refuse connections
+	binds     []string          // dns of successful binds
+	searches  int
+}
+
+func (srv *testServer) add(dn string, attrs map[string][]string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.entries = append(srv.entries, ldap.NewEntry(dn, attrs))
+}
+
+// dial connects a client to the server through a pipe.
+func (srv *testServer) dial() (*ldap.Conn, error) {
+	srv.mutex.Lock()
+	var down = srv.down
+	srv.mutex.Unlock()
+	if down {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	go srv.serve(server)
+	var conn = ldap.NewConn(client, false)
+	conn.Start()
+	return conn, nil
+}
+
+func (srv *testServer) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	var bound string
+
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil {
+			return // connection closed
+		}
+		if len(request.Children) < 2 {
+			return
+		}
+		var messageID = request.Children[0].Value.(int64)
+		var op = request.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			var dn = op.Children[1].Value.(string)
+			var password = op.Children[2].Data.String()
+			srv.mutex.Lock()
+			var ok = password != "" && srv.passwords[dn] == password
+			if ok {
+				bound = dn
+				srv.binds = append(srv.binds, dn)
+			}
+			srv.mutex.Unlock()
+			var code = ldap.LDAPResultSuccess
+			if !ok {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(response(messageID, ldap.ApplicationBindResponse, code).Bytes())
+
+		case ldap.ApplicationSearchRequest:
+			var base = normalizeDN(op.Children[0].Value.(string))
+			var filter = op.Children[6]
+			srv.mutex.Lock()
+			srv.searches++
+			if srv.bindDN != "" && bound != srv.bindDN {
+				srv.mutex.Unlock()
+				conn.Write(response(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			var found []*ldap.Entry
+			for _, entry := range srv.entries {
+				if strings.HasSuffix(normalizeDN(entry.DN), base) && matches(entry, filter) {
+					found = append(found, entry)
+				}
+			}
+			srv.mutex.Unlock()
+			for _, entry := range found {
+				conn.Write(entryPacket(messageID, entry).Bytes())
+			}
+			conn.Write(response(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func envelope(messageID int64, op *ber.Packet) *ber.Packet {
+	var p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func response(messageID int64, tag ber.Tag, code int) *ber.Packet {
+	var op = ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return envelope(messageID, op)
+}
+
+func entryPacket(messageID int64, entry *ldap.Entry) *ber.Packet {
+	var op = ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+	var attrs = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, attr := range entry.Attributes {
+		var a = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr.Name, "type"))
+		var values = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range attr.Values {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		a.AppendChild(values)
+		attrs.AppendChild(a)
+	}
+	op.AppendChild(attrs)
+	return envelope(messageID, op)
+}
+
+func matches(entry *ldap.Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		var attr = filter.Children[0].Value.(string)
+		var want = filter.Children[1].Value.(string)
+		for _, value := range entry.GetEqualFoldAttributeValues(attr) {
+			if strings.EqualFold(value, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entry.GetEqualFoldAttributeValues(filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+const (
+	testServiceDN = "cn=perspective,dc=example,dc=org"
+	testAliceDN   = "uid=alice,ou=people,dc=example,dc=org"
+	testBobDN     = "uid=bob,ou=people,dc=example,dc=org"
+	testEditorsDN = "cn=editors,ou=groups,dc=example,dc=org"
+	testAdminsDN  = "cn=admins,ou=groups,dc=example,dc=org"
+	testStaffDN   = "cn=staff,ou=groups,dc=example,dc=org"
+)
+
+// newTestDirectory returns a directory which is connected to a test server with these entries:
+//
+//   - alice is a member of editors through her memberOf attribute
+//   - bob is a member of admins through its member attribute
+//   - admins is a subgroup of staff
+func newTestDirectory(t *testing.T) (*Directory, *testServer) {
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+
+	var srv = &testServer{
+		bindDN: testServiceDN,
+		passwords: map[string]string{
+			testServiceDN: "service-secret",
+			testAliceDN:   "alice-secret",
+			testBobDN:     "bob-secret",
+		},
+	}
+	srv.add(testServiceDN, map[string][]string{"objectClass": {"organizationalRole"}, "cn": {"perspective"}})
+	srv.add(testAliceDN, map[string][]string{"objectClass": {"inetOrgPerson"}, "mail": {"Alice@example.org"}, "memberOf": {"CN=Editors,OU=Groups,DC=example,DC=org"}})
+	srv.add(testBobDN, map[string][]string{"objectClass": {"inetOrgPerson"}, "mail": {"bob@example.org"}})
+	srv.add("uid=nomail,ou=people,dc=example,dc=org", map[string][]string{"objectClass": {"inetOrgPerson"}})
+	srv.add(testEditorsDN, map[string][]string{"objectClass": {"groupOfNames"}, "cn": {"editors"}})
+	srv.add(testAdminsDN, map[string][]string{"objectClass": {"groupOfNames"}, "cn": {"admins"}, "member": {testBobDN}})
+	srv.add(testStaffDN, map[string][]string{"objectClass": {"groupOfNames"}, "cn": {"staff"}, "member": {testAdminsDN, testStaffDN}}) // a group which contains itself must be tolerated
+
+	var dir = NewDirectory(db, Config{
+		BindDN:       testServiceDN,
+		BindPassword: "service-secret",
+		UserBase:     "ou=people,dc=example,dc=org",
+		UserFilter:   "(objectClass=inetOrgPerson)",
+		UserAttr:     "mail",
+		GroupBase:    "ou=groups,dc=example,dc=org",
+		GroupFilter:  "(objectClass=groupOfNames)",
+		GroupAttr:    "cn",
+		MemberAttr:   "member",
+		MemberOfAttr: "memberOf",
+		CacheTTL:     time.Hour,
+	})
+	dir.Dial = srv.dial
+	return dir, srv
+}
+
+func TestLoginUser(t *testing.T) {
+
+	var dir, srv = newTestDirectory(t)
+	var userDB = NewUserDB(dir)
+
+	u, err := userDB.LoginUser(" alice@EXAMPLE.org", "alice-secret")
+	if err != nil {
+		t.Fatalf("valid login: %v", err)
+	}
+	if u.Name() != "Alice@example.org" {
+		t.Errorf("got name %s", u.Name())
+	}
+	if srv.binds[0] != testServiceDN || srv.binds[len(srv.binds)-1] != testAliceDN {
+		t.Errorf("got binds %v, want the service dn first and the user dn last", srv.binds)
+	}
+
+	var tests = []struct {
+		name     string
+		password string
+	}{
+		{"alice@example.org", "wrong"},
+		{"alice@example.org", ""}, // an unauthenticated bind must not succeed
+		{"bob@example.org", "alice-secret"},
+		{"nobody@example.org", "alice-secret"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if _, err := userDB.LoginUser(test.name, test.password); err != ErrAuth {
+			t.Errorf("login %q with %q: got error %v, want ErrAuth", test.name, test.password, err)
+		}
+	}
+}
+
+func TestLoadRequiresBind(t *testing.T) {
+	var dir, _ = newTestDirectory(t)
+	dir.BindPassword = "wrong"
+	if _, err := NewUserDB(dir).GetUserByName("alice@example.org"); err == nil {
+		t.Fatal("directory has been loaded with a wrong bind password")
+	}
+}
+
+func groupNames(groups []core.DBGroup) string {
+	var names = make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func TestMemberships(t *testing.T) {
+
+	var dir, _ = newTestDirectory(t)
+	var userDB = NewUserDB(dir)
+	var groupDB = NewGroupDB(dir)
+
+	alice, err := userDB.GetUserByName("alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := userDB.GetUserByName("bob@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// memberOf of the user entry
+	groups, err := groupDB.GetGroupsOf(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := groupNames(groups); got != "editors" {
+		t.Errorf("groups of alice: got %s, want editors", got)
+	}
+
+	// member of the group entry, and subgroups
+	groups, err = groupDB.GetGroupsOf(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := groupNames(groups); got != "admins,staff" {
+		t.Errorf("groups of bob: got %s, want admins,staff", got)
+	}
+
+	staff, err := groupDB.GetGroupByName("Staff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isMember, _ := staff.HasMember(bob); !isMember {
+		t.Error("bob is not a member of staff")
+	}
+	if isMember, _ := staff.HasMember(alice); isMember {
+		t.Error("alice is a member of staff")
+	}
+	if direct, _ := staff.DirectMembers(); len(direct) != 0 {
+		t.Errorf("staff has direct members %v", direct)
+	}
+
+	subgroups, err := groupDB.GetSubgroups(staff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := groupNames(subgroups); got != "admins" {
+		t.Errorf("subgroups of staff: got %s, want admins", got)
+	}
+
+	admins, err := groupDB.GetGroupByName("admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	supergroups, err := groupDB.GetSupergroups(admins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := groupNames(supergroups); got != "staff" {
+		t.Errorf("supergroups of admins: got %s, want staff", got)
+	}
+
+	if _, err := userDB.GetUserByName(""); err != ErrUserNotFound {
+		t.Errorf("user without mail attribute: got error %v", err)
+	}
+}
+
+func TestMembershipsWithoutMemberOf(t *testing.T) {
+
+	var dir, _ = newTestDirectory(t)
+	dir.MemberOfAttr = ""
+
+	alice, err := NewUserDB(dir).GetUserByName("alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := NewGroupDB(dir).GetGroupsOf(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("got groups %s, want none", groupNames(groups))
+	}
+}
+
+func TestStableIDs(t *testing.T) {
+
+	var dir, srv = newTestDirectory(t)
+	var userDB = NewUserDB(dir)
+
+	alice, err := userDB.GetUserByName("alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.add("uid=carol,ou=people,dc=example,dc=org", map[string][]string{"objectClass": {"inetOrgPerson"}, "mail": {"carol@example.org"}})
+	dir.Invalidate()
+
+	again, err := userDB.GetUserByName("alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID() != alice.ID() {
+		t.Errorf("id of alice has changed from %d to %d", alice.ID(), again.ID())
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+
+	var dir, srv = newTestDirectory(t)
+	var userDB = NewUserDB(dir)
+
+	if _, err := userDB.GetUserByName("alice@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	var searches = srv.searches
+
+	srv.add("uid=carol,ou=people,dc=example,dc=org", map[string][]string{"objectClass": {"inetOrgPerson"}, "mail": {"carol@example.org"}})
+
+	// cached
+	if _, err := userDB.GetUserByName("carol@example.org"); err != ErrUserNotFound {
+		t.Errorf("new user before expiry: got error %v, want ErrUserNotFound", err)
+	}
+	if srv.searches != searches {
+		t.Errorf("directory has been searched again before expiry")
+	}
+
+	// expired
+	dir.loadedAt = time.Now().Add(-dir.CacheTTL - time.Second)
+	if _, err := userDB.GetUserByName("carol@example.org"); err != nil {
+		t.Errorf("new user after expiry: %v", err)
+	}
+	if srv.searches == searches {
+		t.Errorf("directory has not been searched again after expiry")
+	}
+
+	// expired, but the directory is unavailable
+	srv.add("uid=dave,ou=people,dc=example,dc=org", map[string][]string{"objectClass": {"inetOrgPerson"}, "mail": {"dave@example.org"}})
+	srv.down = true
+	dir.loadedAt = time.Now().Add(-dir.CacheTTL - time.Second)
+	if _, err := userDB.GetUserByName("carol@example.org"); err != nil {
+		t.Errorf("stale snapshot has not been served: %v", err)
+	}
+
+	// available again
+	srv.down = false
+	if _, err := userDB.GetUserByName("dave@example.org"); err != nil {
+		t.Errorf("directory has not been loaded again after it has been unavailable: %v", err)
+	}
+
+	// invalidated and unavailable
+	srv.down = true
+	dir.Invalidate()
+	if _, err := userDB.GetUserByName("alice@example.org"); err == nil {
+		t.Error("got no error after invalidation while the directory is unavailable")
+	}
+}
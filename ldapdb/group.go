@@ -0,0 +1,146 @@
+package ldapdb
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/wansing/perspective/core"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// GroupDB implements core.GroupDB. Groups and memberships are managed in the directory, so memberships have no limited validity.
+type GroupDB struct {
+	*Directory
+}
+
+func NewGroupDB(dir *Directory) *GroupDB {
+	return &GroupDB{dir}
+}
+
+func (db *GroupDB) Writeable() bool {
+	return false
+}
+
+func (db *GroupDB) AddSubgroup(g, sub core.DBGroup) error {
+	return ErrReadOnly
+}
+
+func (db *GroupDB) Delete(g core.DBGroup) error {
+	return ErrReadOnly
+}
+
+func (db *GroupDB) DeleteExpiredMemberships(before int64) (int64, error) {
+	return 0, nil
+}
+
+func (db *GroupDB) GetAllGroups(limit, offset int) ([]core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var all = make([]core.DBGroup, 0, len(snap.groups))
+	for _, g := range snap.groups {
+		all = append(all, g)
+	}
+	sortGroups(all)
+	if offset >= len(all) {
+		return []core.DBGroup{}, nil
+	}
+	all = all[offset:]
+	if limit >= 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (db *GroupDB) GetGroup(id int) (core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := snap.groups[id]; ok {
+		return g, nil
+	}
+	return nil, ErrGroupNotFound
+}
+
+func (db *GroupDB) GetGroupByName(name string) (core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := snap.groupByName[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return g, nil
+	}
+	return nil, ErrGroupNotFound
+}
+
+func (db *GroupDB) GetGroupsOf(u core.DBUser) ([]core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return append([]core.DBGroup{}, snap.groupsOf[u.ID()]...), nil
+}
+
+func (db *GroupDB) GetSubgroups(g core.DBGroup) ([]core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var result = []core.DBGroup{}
+	if sg, ok := snap.groups[g.ID()]; ok {
+		for id := range sg.subgroups {
+			result = append(result, snap.groups[id])
+		}
+	}
+	sortGroups(result)
+	return result, nil
+}
+
+func (db *GroupDB) GetSupergroups(g core.DBGroup) ([]core.DBGroup, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var result = []core.DBGroup{}
+	if _, ok := snap.groups[g.ID()]; ok {
+		var contains = func(h *group) map[int]interface{} {
+			var supergroups = make(map[int]interface{})
+			for _, candidate := range snap.groups {
+				if _, ok := candidate.subgroups[h.id]; ok {
+					supergroups[candidate.id] = struct{}{}
+				}
+			}
+			return supergroups
+		}
+		for id := range snap.closure(g.ID(), contains) {
+			if id != g.ID() {
+				result = append(result, snap.groups[id])
+			}
+		}
+	}
+	sortGroups(result)
+	return result, nil
+}
+
+func (db *GroupDB) GetTimedMemberships(g core.DBGroup) (map[int]core.Validity, error) {
+	return map[int]core.Validity{}, nil
+}
+
+func (db *GroupDB) InsertGroup(name string) error {
+	return ErrReadOnly
+}
+
+func (db *GroupDB) Join(g core.DBGroup, u core.DBUser, validity core.Validity) error {
+	return ErrReadOnly
+}
+
+func (db *GroupDB) Leave(g core.DBGroup, u core.DBUser) error {
+	return ErrReadOnly
+}
+
+func (db *GroupDB) RemoveSubgroup(g, sub core.DBGroup) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,195 @@
+package ldapdb
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/wansing/perspective/core"
+)
+
+// ids assigns persistent integer ids to names.
+type ids struct {
+	getGroup    *sql.Stmt
+	getUser     *sql.Stmt
+	insertGroup *sql.Stmt
+	insertUser  *sql.Stmt
+}
+
+func newIDs(db *sql.DB) *ids {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS ldap_user (
+			id INTEGER PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			UNIQUE(name)
+		);
+		CREATE TABLE IF NOT EXISTS ldap_group (
+			id INTEGER PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			UNIQUE(name)
+		);`)
+
+	return &ids{
+		getGroup:    mustPrepare(db, "SELECT id FROM ldap_group WHERE name = ?"),
+		getUser:     mustPrepare(db, "SELECT id FROM ldap_user WHERE name = ?"),
+		insertGroup: mustPrepare(db, "INSERT OR IGNORE INTO ldap_group (name) VALUES (?)"),
+		insertUser:  mustPrepare(db, "INSERT OR IGNORE INTO ldap_user (name) VALUES (?)"),
+	}
+}
+
+func (ids *ids) get(insert, get *sql.Stmt, name string) (int, error) {
+	name = strings.ToLower(name)
+	if _, err := insert.Exec(name); err != nil {
+		return 0, err
+	}
+	var id int
+	return id, get.QueryRow(name).Scan(&id)
+}
+
+func (ids *ids) groupID(name string) (int, error) {
+	return ids.get(ids.insertGroup, ids.getGroup, name)
+}
+
+func (ids *ids) userID(name string) (int, error) {
+	return ids.get(ids.insertUser, ids.getUser, name)
+}
+
+func mustPrepare(db *sql.DB, query string) *sql.Stmt {
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		panic(err)
+	}
+	return stmt
+}
+
+type user struct {
+	id   int
+	name string
+	dn   string
+}
+
+func (u *user) ID() int {
+	return u.id
+}
+
+func (u *user) Name() string {
+	return u.name
+}
+
+type group struct {
+	id            int
+	name          string
+	dn            string
+	directMembers map[int]interface{} // user id => struct{}
+	subgroups     map[int]interface{} // group id => struct{}
+	members       map[int]interface{} // including members of subgroups, see snapshot.resolve
+}
+
+func (g *group) ID() int {
+	return g.id
+}
+
+func (g *group) Name() string {
+	return g.name
+}
+
+func (g *group) DirectMembers() (map[int]interface{}, error) {
+	return copyIDs(g.directMembers), nil
+}
+
+func (g *group) HasMember(u core.DBUser) (bool, error) {
+	_, ok := g.members[u.ID()]
+	return ok, nil
+}
+
+func (g *group) Members() (map[int]interface{}, error) {
+	return copyIDs(g.members), nil
+}
+
+// copyIDs returns a copy, so callers can't modify the cache.
+func copyIDs(ids map[int]interface{}) map[int]interface{} {
+	var result = make(map[int]interface{}, len(ids))
+	for id := range ids {
+		result[id] = struct{}{}
+	}
+	return result
+}
+
+// A snapshot is the content of the directory at some time. It is not modified after snapshot.resolve has been called.
+type snapshot struct {
+	users       map[int]*user
+	userByDN    map[string]*user
+	userByName  map[string]*user
+	groups      map[int]*group
+	groupByDN   map[string]*group
+	groupByName map[string]*group
+	groupsOf    map[int][]core.DBGroup // user id => groups, considering subgroups
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		users:       make(map[int]*user),
+		userByDN:    make(map[string]*user),
+		userByName:  make(map[string]*user),
+		groups:      make(map[int]*group),
+		groupByDN:   make(map[string]*group),
+		groupByName: make(map[string]*group),
+		groupsOf:    make(map[int][]core.DBGroup),
+	}
+}
+
+func (snap *snapshot) addUser(u *user) {
+	snap.users[u.id] = u
+	snap.userByDN[normalizeDN(u.dn)] = u
+	snap.userByName[strings.ToLower(u.name)] = u
+}
+
+func (snap *snapshot) addGroup(g *group) {
+	snap.groups[g.id] = g
+	snap.groupByDN[g.dn] = g
+	snap.groupByName[strings.ToLower(g.name)] = g
+}
+
+// resolve computes the transitive members of each group, and the groups of each user.
+func (snap *snapshot) resolve() {
+
+	for _, g := range snap.groups {
+		g.members = make(map[int]interface{})
+		for groupID := range snap.closure(g.id, func(h *group) map[int]interface{} { return h.subgroups }) {
+			for userID := range snap.groups[groupID].directMembers {
+				g.members[userID] = struct{}{}
+			}
+		}
+		for userID := range g.members {
+			snap.groupsOf[userID] = append(snap.groupsOf[userID], g)
+		}
+	}
+
+	for _, groups := range snap.groupsOf {
+		sortGroups(groups)
+	}
+}
+
+// closure follows the edges which next returns, starting at the given group id. The result includes the start id. Cycles are tolerated.
+func (snap *snapshot) closure(start int, next func(*group) map[int]interface{}) map[int]interface{} {
+	var result = map[int]interface{}{start: struct{}{}}
+	var queue = []int{start}
+	for len(queue) > 0 {
+		var id = queue[0]
+		queue = queue[1:]
+		for n := range next(snap.groups[id]) {
+			if _, ok := result[n]; !ok {
+				result[n] = struct{}{}
+				queue = append(queue, n)
+			}
+		}
+	}
+	return result
+}
+
+func sortGroups(groups []core.DBGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name() < groups[j].Name()
+	})
+}
@@ -0,0 +1,107 @@
+package ldapdb
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/wansing/perspective/core"
+)
+
+var (
+	ErrAuth         = errors.New("authentication failed")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// UserDB implements core.UserDB. Passwords are managed in the directory.
+type UserDB struct {
+	*Directory
+}
+
+func NewUserDB(dir *Directory) *UserDB {
+	return &UserDB{dir}
+}
+
+func (db *UserDB) Writeable() bool {
+	return false
+}
+
+func (db *UserDB) ChangePassword(u core.DBUser, old, new string) error {
+	return ErrReadOnly
+}
+
+func (db *UserDB) Delete(u core.DBUser) error {
+	return ErrReadOnly
+}
+
+func (db *UserDB) GetUser(id int) (core.DBUser, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := snap.users[id]; ok {
+		return u, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *UserDB) GetUserByName(name string) (core.DBUser, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := snap.userByName[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return u, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *UserDB) GetAllUsers(limit, offset int) ([]core.DBUser, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var all = make([]core.DBUser, 0, len(snap.users))
+	for _, u := range snap.users {
+		all = append(all, u)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name() < all[j].Name()
+	})
+	return paginate(all, limit, offset), nil
+}
+
+func (db *UserDB) InsertUser(name string) (core.DBUser, error) {
+	return nil, ErrReadOnly
+}
+
+// LoginUser looks up the user in the cache and then binds with its DN. Users which have been added to the directory recently are found after the cache has expired.
+func (db *UserDB) LoginUser(name, password string) (core.DBUser, error) {
+	snap, err := db.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	u, ok := snap.userByName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, ErrAuth
+	}
+	if err := db.login(u.dn, password); err != nil {
+		return nil, ErrAuth
+	}
+	return u, nil
+}
+
+func (db *UserDB) SetPassword(u core.DBUser, password string) error {
+	return ErrReadOnly
+}
+
+func paginate(all []core.DBUser, limit, offset int) []core.DBUser {
+	if offset >= len(all) {
+		return []core.DBUser{}
+	}
+	all = all[offset:]
+	if limit >= 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all
+}
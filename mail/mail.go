@@ -0,0 +1,38 @@
+// Package mail sends plain text emails.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"time"
+
+	"github.com/wansing/perspective/util"
+)
+
+// A Mailer sends a plain text email to a single recipient.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// compose creates an RFC 5322 message.
+func compose(from, to, subject, body string) ([]byte, error) {
+
+	id, err := util.RandomString32()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf = &bytes.Buffer{}
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", to)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buf, "Message-ID: <%s@perspective>\r\n", id)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wansing/perspective/util"
+)
+
+// Maildir writes emails into a maildir instead of sending them. It is useful for testing.
+type Maildir struct {
+	Dir  string
+	From string
+}
+
+func (m *Maildir) Send(to, subject, body string) error {
+
+	msg, err := compose(m.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	unique, err := util.RandomString32()
+	if err != nil {
+		return err
+	}
+
+	var filename = fmt.Sprintf("%d.%s.perspective", time.Now().UnixNano(), unique)
+	var tmpPath = filepath.Join(m.Dir, "tmp", filename)
+
+	if err := ioutil.WriteFile(tmpPath, msg, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(m.Dir, "new", filename))
+}
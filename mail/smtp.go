@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+)
+
+// SMTP sends emails to an SMTP server. If Username is empty, no authentication is done.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(to, subject, body string) error {
+
+	msg, err := compose(s.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, msg)
+}
@@ -0,0 +1,194 @@
+// Package oidc implements the client side of the OpenID Connect authorization code flow with PKCE.
+//
+// Only what perspective needs is implemented: discovery, the token exchange and the verification of RSA and ECDSA signed ID tokens.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config configures the client.
+type Config struct {
+	Issuer       string // like https://idp.example.com/realms/example, without trailing slash
+	ClientID     string
+	ClientSecret string   // can be empty for public clients
+	RedirectURL  string   // must be registered at the provider
+	Scopes       []string // in addition to "openid"
+}
+
+// A Provider is an OpenID Connect provider. Its metadata is discovered on first use.
+type Provider struct {
+	Config
+	Client *http.Client
+
+	mutex         sync.Mutex
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	keys          *keySet
+}
+
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discover fetches the provider metadata if it has not been fetched successfully yet.
+func (p *Provider) discover() error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.authEndpoint != "" {
+		return nil
+	}
+
+	var md metadata
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", &md); err != nil {
+		return fmt.Errorf("oidc discovery: %v", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != p.Issuer {
+		return fmt.Errorf("oidc discovery: issuer %s does not match %s", md.Issuer, p.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return errors.New("oidc discovery: incomplete provider metadata")
+	}
+
+	p.authEndpoint = md.AuthorizationEndpoint
+	p.tokenEndpoint = md.TokenEndpoint
+	p.jwksURI = md.JWKSURI
+	p.keys = &keySet{provider: p}
+	return nil
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// Challenge returns the PKCE code challenge (method S256) for a code verifier.
+func Challenge(verifier string) string {
+	var sum = sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider where the user logs in.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+
+	if err := p.discover(); err != nil {
+		return "", err
+	}
+
+	var values = url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.ClientID)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("scope", strings.Join(append([]string{"openid"}, p.Scopes...), " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", Challenge(verifier))
+	values.Set("code_challenge_method", "S256")
+
+	var sep = "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + values.Encode(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the authorization code and returns the verified claims of the ID token. The nonce of the ID token must match.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+
+	var values = url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("code_verifier", verifier)
+	if p.ClientSecret == "" {
+		values.Set("client_id", p.ClientID)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, p.tokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		httpReq.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret)) // client_secret_basic, see RFC 6749 section 2.3.1
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token endpoint: no id_token in response")
+	}
+
+	claims, err := p.verify(token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token: nonce mismatch")
+	}
+	return claims, nil
+}
@@ -0,0 +1,307 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is tolerated when checking the expiry of ID tokens.
+const clockSkew = time.Minute
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified *bool // nil if the provider does not send the claim
+	Nonce         string
+	raw           map[string]interface{}
+}
+
+// Strings returns the values of a claim which is a string or an array of strings, like a groups claim.
+func (c *Claims) Strings(name string) []string {
+	switch v := c.raw[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var result = make([]string, 0, len(v))
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature, the issuer, the audience and the expiry of an ID token.
+func (p *Provider) verify(idToken string) (*Claims, error) {
+
+	var parts = strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id token: malformed")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("id token: malformed header")
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, errors.New("id token: malformed header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("id token: malformed signature")
+	}
+
+	key, err := p.keys.get(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("id token: malformed payload")
+	}
+	var raw = make(map[string]interface{})
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.New("id token: malformed payload")
+	}
+
+	if iss, _ := raw["iss"].(string); strings.TrimSuffix(iss, "/") != p.Issuer {
+		return nil, fmt.Errorf("id token: wrong issuer %s", iss)
+	}
+
+	var audOK bool
+	switch aud := raw["aud"].(type) {
+	case string:
+		audOK = aud == p.ClientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == p.ClientID {
+				audOK = true
+			}
+		}
+	}
+	if !audOK {
+		return nil, errors.New("id token: wrong audience")
+	}
+
+	exp, ok := raw["exp"].(float64)
+	if !ok || time.Unix(int64(exp), 0).Add(clockSkew).Before(time.Now()) {
+		return nil, errors.New("id token: expired")
+	}
+
+	var claims = &Claims{raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Email, _ = raw["email"].(string)
+	claims.Nonce, _ = raw["nonce"].(string)
+	if verified, ok := raw["email_verified"].(bool); ok {
+		claims.EmailVerified = &verified
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token: no subject")
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("id token: unsupported algorithm %s", alg) // in particular "none"
+	}
+
+	var h = hash.New()
+	h.Write([]byte(signed))
+	var digest = h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("id token: algorithm does not match key")
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.New("id token: invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return errors.New("id token: algorithm does not match key")
+		}
+		var size = (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("id token: invalid signature")
+		}
+		var r = new(big.Int).SetBytes(signature[:size])
+		var s = new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("id token: invalid signature")
+		}
+	default:
+		return errors.New("id token: unsupported key type")
+	}
+	return nil
+}
+
+// keySetRefresh limits how often the keys are fetched again because of an unknown key id.
+const keySetRefresh = time.Minute
+
+// A keySet caches the signing keys of the provider.
+type keySet struct {
+	provider  *Provider
+	mutex     sync.Mutex
+	keys      map[string]crypto.PublicKey // key id => key
+	fetchedAt time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// get returns the key with the given id. If it is unknown, the keys are fetched again, because the provider might have rotated them.
+func (ks *keySet) get(kid string) (crypto.PublicKey, error) {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(ks.fetchedAt) < keySetRefresh {
+		return nil, fmt.Errorf("id token: unknown key %s", kid)
+	}
+
+	if err := ks.fetch(); err != nil {
+		return nil, err
+	}
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("id token: unknown key %s", kid)
+}
+
+// lookup returns the key with the given id. If the token has no key id, the provider must have exactly one key.
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *keySet) fetch() error {
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := ks.provider.getJSON(ks.provider.jwksURI, &set); err != nil {
+		return fmt.Errorf("oidc keys: %v", err)
+	}
+
+	var keys = make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		var exponent = new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		var key = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://idp.example.org"
+	testClientID = "perspective"
+)
+
+var (
+	testRSAKey *rsa.PrivateKey
+	testECKey  *ecdsa.PrivateKey
+)
+
+func init() {
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if testECKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+func encodeSegment(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign returns a token with the given header and claims. The key determines the signature, independently of the alg header, so mismatches can be tested.
+func sign(alg, kid string, key interface{}, claims map[string]interface{}) string {
+
+	var signed = encodeSegment(header{Alg: alg, Kid: kid}) + "." + encodeSegment(claims)
+	var digest = sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			panic(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			panic(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case []byte: // HMAC secret
+		var mac = hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case nil:
+		// unsigned
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            testIssuer,
+		"aud":            testClientID,
+		"sub":            "1234",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"email":          "alice@example.org",
+		"email_verified": true,
+		"nonce":          "nonce",
+	}
+}
+
+func testProvider() *Provider {
+	var p = NewProvider(Config{
+		Issuer:   testIssuer,
+		ClientID: testClientID,
+	})
+	p.keys = &keySet{
+		provider: p,
+		keys: map[string]crypto.PublicKey{
+			"rsa": &testRSAKey.PublicKey,
+			"ec":  &testECKey.PublicKey,
+		},
+		fetchedAt: time.Now(), // don't fetch
+	}
+	return p
+}
+
+func TestVerify(t *testing.T) {
+
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		token   string
+		wantErr string // empty if the token is valid
+	}{
+		{"RS256", sign("RS256", "rsa", testRSAKey, validClaims()), ""},
+		{"ES256", sign("ES256", "ec", testECKey, validClaims()), ""},
+		{"audience array", sign("RS256", "rsa", testRSAKey, with(validClaims(), "aud", []string{"other", testClientID})), ""},
+		{"issuer with trailing slash", sign("RS256", "rsa", testRSAKey, with(validClaims(), "iss", testIssuer+"/")), ""},
+		{"expired within clock skew", sign("RS256", "rsa", testRSAKey, with(validClaims(), "exp", time.Now().Add(-clockSkew/2).Unix())), ""},
+		{"alg none", sign("none", "rsa", nil, validClaims()), "unsupported algorithm none"},
+		{"alg none without kid", sign("none", "", nil, validClaims()), "unknown key"},
+		{"HS256 with public key as secret", sign("HS256", "rsa", rsaPublicDER, validClaims()), "unsupported algorithm HS256"},
+		{"ES256 header with RSA key", sign("ES256", "rsa", testRSAKey, validClaims()), "algorithm does not match key"},
+		{"RS256 header with EC key", sign("RS256", "ec", testECKey, validClaims()), "algorithm does not match key"},
+		{"signed by other key", sign("RS256", "rsa", otherKey, validClaims()), "invalid signature"},
+		{"unknown key id", sign("RS256", "unknown", testRSAKey, validClaims()), "unknown key"},
+		{"wrong issuer", sign("RS256", "rsa", testRSAKey, with(validClaims(), "iss", "https://evil.example.org")), "wrong issuer"},
+		{"no issuer", sign("RS256", "rsa", testRSAKey, with(validClaims(), "iss", nil)), "wrong issuer"},
+		{"wrong audience", sign("RS256", "rsa", testRSAKey, with(validClaims(), "aud", "other")), "wrong audience"},
+		{"wrong audience array", sign("RS256", "rsa", testRSAKey, with(validClaims(), "aud", []string{"other"})), "wrong audience"},
+		{"expired", sign("RS256", "rsa", testRSAKey, with(validClaims(), "exp", time.Now().Add(-2*clockSkew).Unix())), "expired"},
+		{"no expiry", sign("RS256", "rsa", testRSAKey, with(validClaims(), "exp", nil)), "expired"},
+		{"no subject", sign("RS256", "rsa", testRSAKey, with(validClaims(), "sub", nil)), "no subject"},
+		{"malformed", "abc.def", "malformed"},
+	}
+
+	var p = testProvider()
+	for _, test := range tests {
+		claims, err := p.verify(test.token)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: got error %v", test.name, err)
+		case test.wantErr == "" && claims.Subject != "1234":
+			t.Errorf("%s: got subject %q", test.name, claims.Subject)
+		case test.wantErr != "" && err == nil:
+			t.Errorf("%s: token has been accepted", test.name)
+		case test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	var parts = strings.Split(sign("RS256", "rsa", testRSAKey, validClaims()), ".")
+	parts[1] = encodeSegment(with(validClaims(), "sub", "admin"))
+	if _, err := testProvider().verify(strings.Join(parts, ".")); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Fatalf("got error %v, want invalid signature", err)
+	}
+}
+
+func TestVerifyEmailVerified(t *testing.T) {
+
+	var p = testProvider()
+
+	claims, err := p.verify(sign("RS256", "rsa", testRSAKey, validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		t.Errorf("email_verified true: got %v", claims.EmailVerified)
+	}
+
+	claims, err = p.verify(sign("RS256", "rsa", testRSAKey, with(validClaims(), "email_verified", false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified == nil || *claims.EmailVerified {
+		t.Errorf("email_verified false: got %v", claims.EmailVerified)
+	}
+
+	claims, err = p.verify(sign("RS256", "rsa", testRSAKey, with(validClaims(), "email_verified", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified != nil {
+		t.Errorf("email_verified missing: got %v", *claims.EmailVerified)
+	}
+}
+
+// with sets a claim, or deletes it if value is nil.
+func with(claims map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+// TestExchangeNonce runs the token exchange against a fake provider, which also tests discovery and fetching the keys.
+func TestExchangeNonce(t *testing.T) {
+
+	var idToken string
+
+	var mux = http.NewServeMux()
+	var srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{
+			Issuer:                srv.URL,
+			AuthorizationEndpoint: srv.URL + "/auth",
+			TokenEndpoint:         srv.URL + "/token",
+			JWKSURI:               srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{
+				Kty: "RSA",
+				Kid: "rsa",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(testRSAKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testRSAKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{IDToken: idToken})
+	})
+
+	var p = NewProvider(Config{
+		Issuer:   srv.URL,
+		ClientID: testClientID,
+	})
+
+	var claims = validClaims()
+	claims["iss"] = srv.URL
+	idToken = sign("RS256", "rsa", testRSAKey, claims)
+
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "nonce"); err != nil {
+		t.Fatalf("valid nonce: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "other"); err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+		t.Fatalf("wrong nonce: got error %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), "code", "wrong", "nonce"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("wrong verifier: got error %v", err)
+	}
+
+	delete(claims, "nonce")
+	idToken = sign("RS256", "rsa", testRSAKey, claims)
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "nonce"); err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+		t.Fatalf("missing nonce: got error %v", err)
+	}
+}
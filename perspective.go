@@ -25,6 +25,9 @@ import (
 	//"github.com/wansing/perspective/cache/maps"
 	"github.com/wansing/perspective/classes"
 	"github.com/wansing/perspective/core"
+	"github.com/wansing/perspective/ldapdb"
+	"github.com/wansing/perspective/mail"
+	"github.com/wansing/perspective/oidc"
 	"github.com/wansing/perspective/sqldb"
 	"github.com/wansing/perspective/sqldb/mysql"
 	"github.com/wansing/perspective/sqldb/sqlite3"
@@ -50,8 +53,37 @@ func main() {
 	var base = flag.String("base", "", "strip off this `prefix` from every HTTP request and prepended it to every link")
 	// MySQL: collation should be utf8mb4_unicode_ci
 	flag.StringVar(&dbArg, "db", "sqlite3:perspective.sqlite3?_busy_timeout=10000&_journal=WAL&_sync=NORMAL&cache=shared", "sql database url, see github.com/xo/dburl")
+	var digestInterval = flag.Duration("digest-interval", 24*time.Hour, "send digest emails at this `interval`")
+	var expiredRetention = flag.Duration("expired-retention", 30*24*time.Hour, "keep expired access rules and group memberships for this `duration` before deleting them")
 	var hmacKey = flag.String("hmac", "", "use this secret HMAC `key` for serving resized images")
+	var ldapURL = flag.String("ldap", "", "read users and groups from the LDAP directory at this `url`, like ldaps://ldap.example.com")
+	var ldapBindDN = flag.String("ldap-bind-dn", "", "LDAP `dn` for searching users and groups, leave empty for anonymous search")
+	var ldapBindPass = flag.String("ldap-bind-pass", "", "LDAP bind `password`")
+	var ldapCache = flag.Duration("ldap-cache", 5*time.Minute, "cache LDAP users and groups for this `duration`")
+	var ldapGroupAttr = flag.String("ldap-group-attr", "cn", "LDAP `attribute` which contains the group name")
+	var ldapGroupBase = flag.String("ldap-group-base", "", "LDAP base `dn` of groups")
+	var ldapGroupFilter = flag.String("ldap-group-filter", "(objectClass=groupOfNames)", "LDAP `filter` for groups")
+	var ldapMemberAttr = flag.String("ldap-member-attr", "member", "LDAP `attribute` of groups which contains the DNs of members and subgroups")
+	var ldapMemberOfAttr = flag.String("ldap-member-of-attr", "memberOf", "LDAP `attribute` of users which contains the DNs of their groups, can be empty")
+	var ldapUserAttr = flag.String("ldap-user-attr", "mail", "LDAP `attribute` which contains the user name")
+	var ldapUserBase = flag.String("ldap-user-base", "", "LDAP base `dn` of users")
+	var ldapUserFilter = flag.String("ldap-user-filter", "(objectClass=inetOrgPerson)", "LDAP `filter` for users")
 	var listenAddr = flag.String("listen", "127.0.0.1:8080", "serve HTTP content at this `ip:port`")
+	var mailFrom = flag.String("mail-from", "", "sender `address` of emails")
+	var maildir = flag.String("maildir", "", "write emails into this maildir `directory` instead of sending them, for testing")
+	var oidcIssuer = flag.String("oidc", "", "allow backend logins with the OpenID Connect provider at this issuer `url`")
+	var oidcAllowUnverifiedEmail = flag.Bool("oidc-allow-unverified-email", false, "accept OpenID Connect logins without the email_verified claim, only use it if the provider verifies all email addresses")
+	var oidcClientID = flag.String("oidc-client-id", "", "OpenID Connect client `id`")
+	var oidcClientSecret = flag.String("oidc-client-secret", "", "OpenID Connect client `secret`, leave empty for a public client")
+	var oidcGroupMap = flag.String("oidc-group-map", "", "synchronize memberships in perspective groups with the groups claim, like `provider-group=PerspectiveGroup,other=Other`")
+	var oidcGroupsClaim = flag.String("oidc-groups-claim", "groups", "OpenID Connect `claim` which contains the groups of the user")
+	var oidcProvision = flag.Bool("oidc-provision", false, "create users on their first OpenID Connect login")
+	var oidcScopes = flag.String("oidc-scopes", "email", "space-separated OpenID Connect `scopes` in addition to openid")
+	var publicURL = flag.String("url", "", "public `url` of this instance, used for links in emails")
+	var smtpAddr = flag.String("smtp", "", "send emails using this SMTP server `host:port`")
+	var smtpPass = flag.String("smtp-pass", "", "SMTP `password`")
+	var smtpUser = flag.String("smtp-user", "", "SMTP `username`, leave empty for no authentication")
+	var trustedProxies = flag.String("trusted-proxies", "", "comma-separated IP addresses or networks of reverse `proxies`, like 127.0.0.1,10.0.0.0/8, whose X-Forwarded-For header identifies the client")
 
 	// init FlagSet
 
@@ -119,20 +151,121 @@ func main() {
 	}
 
 	db.AccessDB = sqldb.NewAccessDB(sqlDB)
+	db.APITokenDB = sqldb.NewAPITokenDB(sqlDB)
+	db.ApprovalDB = sqldb.NewApprovalDB(sqlDB)
+	db.AuditDB = sqldb.NewAuditDB(sqlDB)
+	db.ChangeSetDB = sqldb.NewChangeSetDB(sqlDB)
 	db.ClassRegistry = classes.DefaultRegistry
+	db.CommentDB = sqldb.NewCommentDB(sqlDB)
 	db.EditorsDB = sqldb.NewEditorsDB(sqlDB)
 	/*db.NodeDB = maps.NewNodeCache(
 		sqldb.NewNodeDB(sqlDB),
 	)*/
 	db.GroupDB = sqldb.NewGroupDB(sqlDB)
+	db.GroupManagerDB = sqldb.NewGroupManagerDB(sqlDB)
 	db.IndexDB = sqldb.NewIndexDB(sqlDB)
+	db.LockDB = sqldb.NewLockDB(sqlDB)
+	db.LoginFailureDB = sqldb.NewLoginFailureDB(sqlDB)
 	db.NodeDB = sqldb.NewNodeDB(sqlDB)
+	db.NotificationDB = sqldb.NewNotificationDB(sqlDB)
+	db.PasswordTokenDB = sqldb.NewPasswordTokenDB(sqlDB)
+	db.RegistrationDB = sqldb.NewRegistrationDB(sqlDB)
+	db.SessionIndexDB = sqldb.NewSessionIndexDB(sqlDB)
+	db.TOTPDB = sqldb.NewTOTPDB(sqlDB)
+	db.TransitionDB = sqldb.NewTransitionDB(sqlDB)
 	db.UserDB = sqldb.NewUserDB(sqlDB)
 	db.WorkflowDB = sqldb.NewWorkflowDB(sqlDB)
 
+	if *ldapURL != "" {
+		var dir = ldapdb.NewDirectory(sqlDB, ldapdb.Config{
+			URL:          *ldapURL,
+			BindDN:       *ldapBindDN,
+			BindPassword: *ldapBindPass,
+			UserBase:     *ldapUserBase,
+			UserFilter:   *ldapUserFilter,
+			UserAttr:     *ldapUserAttr,
+			GroupBase:    *ldapGroupBase,
+			GroupFilter:  *ldapGroupFilter,
+			GroupAttr:    *ldapGroupAttr,
+			MemberAttr:   *ldapMemberAttr,
+			MemberOfAttr: *ldapMemberOfAttr,
+			CacheTTL:     *ldapCache,
+		})
+		db.GroupDB = ldapdb.NewGroupDB(dir)
+		db.UserDB = ldapdb.NewUserDB(dir)
+		log.Printf("using LDAP directory %s", *ldapURL)
+	}
+
 	db.HMACSecret = *hmacKey
+	db.PublicURL = strings.TrimSuffix(*publicURL, "/")
 	db.SqlDB = sqlDB
 
+	for _, proxy := range strings.Split(*trustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Printf("invalid trusted proxy: %v", err)
+			return
+		}
+		db.TrustedProxies = append(db.TrustedProxies, network)
+	}
+
+	if *oidcIssuer != "" {
+		if db.PublicURL == "" {
+			log.Println("OpenID Connect requires the public url")
+			return
+		}
+		var groupMap = make(map[string]string)
+		for _, pair := range strings.Split(*oidcGroupMap, ",") {
+			if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 {
+				groupMap[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		db.OIDC = &core.OIDCLogin{
+			Provider: oidc.NewProvider(oidc.Config{
+				Issuer:       *oidcIssuer,
+				ClientID:     *oidcClientID,
+				ClientSecret: *oidcClientSecret,
+				RedirectURL:  db.PublicURL + "/backend/login-oidc/callback",
+				Scopes:       strings.Fields(*oidcScopes),
+			}),
+			GroupsClaim: *oidcGroupsClaim,
+			GroupMap:    groupMap,
+			Provision:   *oidcProvision,
+
+			AllowUnverifiedEmail: *oidcAllowUnverifiedEmail,
+		}
+		log.Printf("using OpenID Connect provider %s", *oidcIssuer)
+	}
+
+	// mail
+
+	switch {
+	case *maildir != "":
+		db.Mailer = &mail.Maildir{
+			Dir:  *maildir,
+			From: *mailFrom,
+		}
+		log.Printf("writing emails to %s", *maildir)
+	case *smtpAddr != "":
+		db.Mailer = &mail.SMTP{
+			Addr:     *smtpAddr,
+			Username: *smtpUser,
+			Password: *smtpPass,
+			From:     *mailFrom,
+		}
+		log.Printf("sending emails via %s", *smtpAddr)
+	}
+
 	defer func() {
 		log.Println("closing database")
 		sqlDB.Close()
@@ -161,11 +294,41 @@ func main() {
 		return
 	}
 
+	if db.Mailer != nil && *digestInterval > 0 {
+		go func() {
+			for range time.Tick(*digestInterval) {
+				if err := db.SendDigests(); err != nil {
+					log.Printf("error sending digests: %v", err)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := db.DeleteExpired(time.Now().Add(-*expiredRetention)); err != nil {
+				log.Printf("error deleting expired access rules and memberships: %v", err)
+			}
+			if err := db.DeleteOldLoginFailures(); err != nil {
+				log.Printf("error deleting old login failures: %v", err)
+			}
+			if err := db.DeleteExpiredPasswordTokens(); err != nil {
+				log.Printf("error deleting expired password tokens: %v", err)
+			}
+			if err := db.DeleteStaleSessions(); err != nil {
+				log.Printf("error deleting stale sessions: %v", err)
+			}
+			if err := db.DeleteUnconfirmedRegistrations(); err != nil {
+				log.Printf("error deleting unconfirmed registrations: %v", err)
+			}
+		}
+	}()
+
 	listen(db, *listenAddr, *base)
 }
 
 func insertGroup(db *core.CoreDB, name string) {
-	if err := db.InsertGroup(name); err != nil {
+	if err := db.InsertGroup(nil, name); err != nil {
 		log.Printf(`error creating group "%s": %v`, name, err)
 	}
 }
@@ -193,7 +356,7 @@ func insertUser(db *core.CoreDB, name string) {
 		return
 	}
 
-	user, err := db.InsertUser(name)
+	user, err := db.InsertUser(nil, name)
 	if err != nil {
 		log.Printf("error creating user %s: %v", name, err)
 		return
@@ -219,7 +382,7 @@ func join(db *core.CoreDB, groupname string, username string) {
 		return
 	}
 
-	if err := db.Join(group, user); err != nil {
+	if err := db.Join(nil, group, user, core.Validity{}); err != nil {
 		log.Printf("error joining: %v", err)
 		return
 	}
@@ -233,7 +396,7 @@ func makeAdmin(db *core.CoreDB, groupname string) {
 		return
 	}
 
-	if err := db.AccessDB.InsertAccessRule(1, group.ID(), int(core.Admin)); err != nil {
+	if err := db.AccessDB.InsertAccessRule(1, group.ID(), int(core.Admin), core.Validity{}); err != nil {
 		log.Printf(`error giving root admin permission to group: %v`, err)
 		return
 	}
@@ -281,6 +444,16 @@ func listen(db *core.CoreDB, addr string, base string) {
 		{{ end -}}
 	</head>
 	<body>
+		{{ with .ViewingAs }}
+			<div style="background: #ffc107; color: black; padding: 0.5rem; text-align: center;">
+				You are viewing the site as {{ .Name }}. Changes are not possible. <a style="color: black; font-weight: bold;" href="` + base + `/backend/view-as">Stop</a>
+			</div>
+		{{ end }}
+		{{ with .PreviewChangeSet }}
+			<div style="background: #17a2b8; color: white; padding: 0.5rem; text-align: center;">
+				Preview of change set <a style="color: white; font-weight: bold;" href="` + base + `/backend/changeset/{{ .ID }}">{{ .Name }}</a>
+			</div>
+		{{ end }}
 		{{ .RenderNotifications }}
 		{{ .Get "body" }}
 	</body>
@@ -305,6 +478,17 @@ func listen(db *core.CoreDB, addr string, base string) {
 
 					var request = db.NewRequest(w, req)
 
+					if err := request.AuthError(); err != nil {
+						http.Error(w, err.Error(), http.StatusUnauthorized)
+						return
+					}
+
+					request.ApplyViewAs()
+					if request.ViewingAs() != nil && req.Method != http.MethodGet && req.Method != http.MethodHead {
+						http.Error(w, "you can't change anything while viewing the site as someone else", http.StatusForbidden)
+						return
+					}
+
 					var mainQuery = &core.Query{
 						Request: request,
 						Queue:   core.NewQueue("/" + core.RootSlug + req.URL.Path),
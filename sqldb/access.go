@@ -2,14 +2,26 @@ package sqldb
 
 import (
 	"database/sql"
+	"time"
+
+	"github.com/wansing/perspective/core"
 )
 
+// validNow is an SQL condition which requires valid_from and valid_until to include the timestamp parameter.
+const validNow = "(valid_from = 0 OR valid_from <= ?1) AND (valid_until = 0 OR ?1 < valid_until)"
+
 type AccessDB struct {
-	db     *sql.DB
-	get    *sql.Stmt
-	getAll *sql.Stmt
-	insert *sql.Stmt
-	remove *sql.Stmt
+	db            *sql.DB
+	block         *sql.Stmt
+	deleteExpired *sql.Stmt
+	get           *sql.Stmt
+	getAll        *sql.Stmt
+	getAllBlocks  *sql.Stmt
+	getTimed      *sql.Stmt
+	insert        *sql.Stmt
+	isBlocked     *sql.Stmt
+	remove        *sql.Stmt
+	unblock       *sql.Stmt
 }
 
 func NewAccessDB(db *sql.DB) *AccessDB {
@@ -19,20 +31,44 @@ func NewAccessDB(db *sql.DB) *AccessDB {
 			elementId int(11) NOT NULL,
 			groupId int(11) NOT NULL,
 			permission int(11) NOT NULL,
+			valid_from int(11) NOT NULL DEFAULT 0,
+			valid_until int(11) NOT NULL DEFAULT 0,
 			PRIMARY KEY (elementId, groupId)
+		);
+		CREATE TABLE IF NOT EXISTS access_block (
+			elementId int(11) NOT NULL,
+			PRIMARY KEY (elementId)
 		);`)
 
+	// migration
+	db.Exec("ALTER TABLE access ADD COLUMN valid_from int(11) NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE access ADD COLUMN valid_until int(11) NOT NULL DEFAULT 0")
+
 	var accessDB = &AccessDB{}
 	accessDB.db = db
-	accessDB.get = mustPrepare(db, "SELECT groupId, permission FROM access WHERE elementId = ?")
-	accessDB.getAll = mustPrepare(db, "SELECT elementId, groupId, permission FROM access")
-	accessDB.insert = mustPrepare(db, "INSERT OR IGNORE INTO access (elementId, groupId, permission) VALUES (?, ?, ?)")
+	accessDB.block = mustPrepare(db, "INSERT OR IGNORE INTO access_block (elementId) VALUES (?)")
+	accessDB.deleteExpired = mustPrepare(db, "DELETE FROM access WHERE valid_until != 0 AND valid_until <= ?")
+	accessDB.get = mustPrepare(db, "SELECT groupId, permission FROM access WHERE elementId = ?2 AND "+validNow)
+	accessDB.getAll = mustPrepare(db, "SELECT elementId, groupId, permission FROM access WHERE "+validNow)
+	accessDB.getAllBlocks = mustPrepare(db, "SELECT elementId FROM access_block")
+	accessDB.getTimed = mustPrepare(db, "SELECT elementId, groupId, permission, valid_from, valid_until FROM access WHERE valid_from != 0 OR valid_until != 0")
+	accessDB.insert = mustPrepare(db, "REPLACE INTO access (elementId, groupId, permission, valid_from, valid_until) VALUES (?, ?, ?, ?, ?)")
+	accessDB.isBlocked = mustPrepare(db, "SELECT COUNT(1) FROM access_block WHERE elementId = ?")
 	accessDB.remove = mustPrepare(db, "DELETE FROM access WHERE elementId = ? AND groupId = ?")
+	accessDB.unblock = mustPrepare(db, "DELETE FROM access_block WHERE elementId = ?")
 	return accessDB
 }
 
+func (e *AccessDB) DeleteExpiredAccessRules(before int64) (int64, error) {
+	res, err := e.deleteExpired.Exec(before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (e *AccessDB) GetAccessRules(nodeID int) (map[int]int, error) {
-	res, err := e.get.Query(nodeID)
+	res, err := e.get.Query(time.Now().Unix(), nodeID)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +84,7 @@ func (e *AccessDB) GetAccessRules(nodeID int) (map[int]int, error) {
 }
 
 func (e *AccessDB) GetAllAccessRules() (map[int]map[int]int, error) {
-	res, err := e.getAll.Query()
+	res, err := e.getAll.Query(time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
@@ -66,12 +102,62 @@ func (e *AccessDB) GetAllAccessRules() (map[int]map[int]int, error) {
 	return all, nil
 }
 
-func (e *AccessDB) InsertAccessRule(nodeID int, groupID int, perm int) error {
-	_, err := e.insert.Exec(nodeID, groupID, perm)
+func (e *AccessDB) GetInheritanceBlocks() (map[int]bool, error) {
+	res, err := e.getAllBlocks.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var blocks = make(map[int]bool)
+	for res.Next() {
+		var nodeID int
+		if err = res.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		blocks[nodeID] = true
+	}
+	return blocks, nil
+}
+
+func (e *AccessDB) GetTimedAccessRules() ([]core.TimedAccessRule, error) {
+	res, err := e.getTimed.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var rules = []core.TimedAccessRule{}
+	for res.Next() {
+		var r core.TimedAccessRule
+		if err = res.Scan(&r.NodeID, &r.GroupID, &r.Permission, &r.From, &r.Until); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (e *AccessDB) InsertAccessRule(nodeID int, groupID int, perm int, validity core.Validity) error {
+	_, err := e.insert.Exec(nodeID, groupID, perm, validity.From, validity.Until)
 	return err
 }
 
+func (e *AccessDB) IsInheritanceBlocked(nodeID int) (bool, error) {
+	var count int
+	err := e.isBlocked.QueryRow(nodeID).Scan(&count)
+	return count > 0, err
+}
+
 func (e *AccessDB) RemoveAccessRule(nodeID int, groupID int) error {
 	_, err := e.remove.Exec(nodeID, groupID)
 	return err
 }
+
+func (e *AccessDB) SetInheritanceBlocked(nodeID int, blocked bool) error {
+	var err error
+	if blocked {
+		_, err = e.block.Exec(nodeID)
+	} else {
+		_, err = e.unblock.Exec(nodeID)
+	}
+	return err
+}
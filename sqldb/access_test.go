@@ -0,0 +1,129 @@
+package sqldb
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/wansing/perspective/core"
+)
+
+// openTestDB opens an in-memory sqlite database. It is closed when the test ends.
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestAccessRuleValidity(t *testing.T) {
+
+	var accessDB = NewAccessDB(openTestDB(t))
+	var now = time.Now().Unix()
+
+	const (
+		unlimited = 1
+		current   = 2
+		expired   = 3
+		future    = 4
+		endsNow   = 5
+		startsNow = 6
+	)
+
+	var validities = map[int]core.Validity{
+		unlimited: {},
+		current:   {From: now - 3600, Until: now + 3600},
+		expired:   {From: now - 7200, Until: now - 3600},
+		future:    {From: now + 3600},
+		endsNow:   {Until: now - 1}, // until is exclusive
+		startsNow: {From: now - 1},  // from is inclusive
+	}
+	for groupID, validity := range validities {
+		if err := accessDB.InsertAccessRule(core.RootID, groupID, int(core.Read), validity); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want = map[int]int{
+		unlimited: int(core.Read),
+		current:   int(core.Read),
+		startsNow: int(core.Read),
+	}
+
+	rules, err := accessDB.GetAccessRules(core.RootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalRules(rules, want) {
+		t.Errorf("GetAccessRules: got %v, want %v", rules, want)
+	}
+
+	all, err := accessDB.GetAllAccessRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || !equalRules(all[core.RootID], want) {
+		t.Errorf("GetAllAccessRules: got %v, want %v", all, want)
+	}
+
+	timed, err := accessDB.GetTimedAccessRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timed) != len(validities)-1 { // all except unlimited
+		t.Errorf("GetTimedAccessRules: got %d rules, want %d", len(timed), len(validities)-1)
+	}
+
+	deleted, err := accessDB.DeleteExpiredAccessRules(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 { // expired and endsNow
+		t.Errorf("DeleteExpiredAccessRules: got %d, want 2", deleted)
+	}
+}
+
+func TestInsertAccessRuleReplaces(t *testing.T) {
+
+	var accessDB = NewAccessDB(openTestDB(t))
+	var now = time.Now().Unix()
+
+	if err := accessDB.InsertAccessRule(core.RootID, 1, int(core.Admin), core.Validity{Until: now + 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := accessDB.InsertAccessRule(core.RootID, 1, int(core.None), core.Validity{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := accessDB.GetAccessRules(core.RootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[1] != int(core.None) {
+		t.Errorf("got permission %d, want %d", rules[1], core.None)
+	}
+
+	timed, err := accessDB.GetTimedAccessRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timed) != 0 {
+		t.Errorf("the validity of the replaced rule has been kept: %v", timed)
+	}
+}
+
+func equalRules(got, want map[int]int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for groupID, perm := range want {
+		if got[groupID] != perm {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type APITokenDB struct {
+	*sql.DB
+	delete *sql.Stmt
+	get    *sql.Stmt
+	getAll *sql.Stmt
+	insert *sql.Stmt
+	touch  *sql.Stmt
+}
+
+func NewAPITokenDB(db *sql.DB) *APITokenDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_token (
+			id INTEGER PRIMARY KEY,
+			usr int(11) NOT NULL,
+			name varchar(128) NOT NULL,
+			hash varchar(64) NOT NULL,
+			scope varchar(16) NOT NULL,
+			node int(11) NOT NULL DEFAULT 0,
+			node_path varchar(255) NOT NULL DEFAULT '',
+			created INTEGER NOT NULL,
+			expires INTEGER NOT NULL DEFAULT 0,
+			last_used INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(hash)
+		);`)
+
+	var apiTokenDB = &APITokenDB{}
+	apiTokenDB.DB = db
+	apiTokenDB.delete = mustPrepare(db, "DELETE FROM api_token WHERE usr = ? AND id = ?")
+	apiTokenDB.get = mustPrepare(db, "SELECT id, usr, name, scope, node, node_path, created, expires, last_used FROM api_token WHERE hash = ?")
+	apiTokenDB.getAll = mustPrepare(db, "SELECT id, name, scope, node, node_path, created, expires, last_used FROM api_token WHERE usr = ? ORDER BY created DESC")
+	apiTokenDB.insert = mustPrepare(db, "INSERT INTO api_token (usr, name, hash, scope, node, node_path, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	apiTokenDB.touch = mustPrepare(db, "UPDATE api_token SET last_used = ? WHERE id = ?")
+	return apiTokenDB
+}
+
+func (db *APITokenDB) DeleteAPIToken(userID, id int) error {
+	_, err := db.delete.Exec(userID, id)
+	return err
+}
+
+func (db *APITokenDB) GetAPIToken(hash string) (core.APIToken, error) {
+	var t = core.APIToken{Hash: hash}
+	switch err := db.get.QueryRow(hash).Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.NodeID, &t.NodePath, &t.Created, &t.Expires, &t.LastUsed); err {
+	case nil:
+		return t, nil
+	case sql.ErrNoRows:
+		return core.APIToken{}, nil
+	default:
+		return core.APIToken{}, err
+	}
+}
+
+func (db *APITokenDB) GetAPITokens(userID int) ([]core.APIToken, error) {
+
+	rows, err := db.getAll.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens = []core.APIToken{}
+	for rows.Next() {
+		var t = core.APIToken{UserID: userID}
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.NodeID, &t.NodePath, &t.Created, &t.Expires, &t.LastUsed); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (db *APITokenDB) InsertAPIToken(t core.APIToken) error {
+	_, err := db.insert.Exec(t.UserID, t.Name, t.Hash, t.Scope, t.NodeID, t.NodePath, t.Created, t.Expires)
+	return err
+}
+
+func (db *APITokenDB) TouchAPIToken(id int, ts int64) error {
+	_, err := db.touch.Exec(ts, id)
+	return err
+}
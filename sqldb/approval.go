@@ -0,0 +1,70 @@
+package sqldb
+
+import (
+	"database/sql"
+)
+
+type ApprovalDB struct {
+	db     *sql.DB
+	clear  *sql.Stmt
+	delete *sql.Stmt
+	get    *sql.Stmt
+	insert *sql.Stmt
+}
+
+func NewApprovalDB(db *sql.DB) *ApprovalDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS version_approval (
+			elementId int(11) NOT NULL,
+			versionNr int(11) NOT NULL,
+			grp int(11) NOT NULL,
+			usr int(11) NOT NULL,
+			ts INTEGER NOT NULL,
+			PRIMARY KEY (elementId, versionNr, grp, usr)
+		);`)
+
+	var approvalDB = &ApprovalDB{}
+	approvalDB.db = db
+	approvalDB.clear = mustPrepare(db, "DELETE FROM version_approval WHERE elementId = ? AND versionNr = ?")
+	approvalDB.delete = mustPrepare(db, "DELETE FROM version_approval WHERE elementId = ?")
+	approvalDB.get = mustPrepare(db, "SELECT usr FROM version_approval WHERE elementId = ? AND versionNr = ? AND grp = ? ORDER BY ts")
+	approvalDB.insert = mustPrepare(db, "REPLACE INTO version_approval (elementId, versionNr, grp, usr, ts) VALUES (?, ?, ?, ?, ?)")
+	return approvalDB
+}
+
+func (db *ApprovalDB) ClearApprovals(nodeID, versionNo int) error {
+	_, err := db.clear.Exec(nodeID, versionNo)
+	return err
+}
+
+func (db *ApprovalDB) DeleteApprovals(nodeID int) error {
+	_, err := db.delete.Exec(nodeID)
+	return err
+}
+
+func (db *ApprovalDB) GetApprovals(nodeID, versionNo, groupID int) ([]int, error) {
+
+	rows, err := db.get.Query(nodeID, versionNo, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs = []int{}
+
+	for rows.Next() {
+		var userID int
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
+func (db *ApprovalDB) InsertApproval(nodeID, versionNo, groupID, userID int, ts int64) error {
+	_, err := db.insert.Exec(nodeID, versionNo, groupID, userID, ts)
+	return err
+}
@@ -0,0 +1,135 @@
+package sqldb
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/wansing/perspective/core"
+)
+
+type auditEntry struct {
+	ts       int64
+	userID   int
+	username string
+	action   string
+	nodeID   int
+	details  string
+}
+
+func (e *auditEntry) Ts() int64 {
+	return e.ts
+}
+
+func (e *auditEntry) UserID() int {
+	return e.userID
+}
+
+func (e *auditEntry) Username() string {
+	return e.username
+}
+
+func (e *auditEntry) Action() string {
+	return e.action
+}
+
+func (e *auditEntry) NodeID() int {
+	return e.nodeID
+}
+
+func (e *auditEntry) Details() string {
+	return e.details
+}
+
+// AuditDB is append-only. Filtered queries are assembled at runtime, so only the insert statement is prepared.
+type AuditDB struct {
+	*sql.DB
+	insert *sql.Stmt
+}
+
+func NewAuditDB(db *sql.DB) *AuditDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit (
+			id INTEGER PRIMARY KEY,
+			ts INTEGER NOT NULL,
+			usr int(11) NOT NULL,
+			username varchar(128) NOT NULL,
+			action varchar(32) NOT NULL,
+			elementId int(11) NOT NULL,
+			details text NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS audit_ts ON audit (ts);`)
+
+	var auditDB = &AuditDB{}
+	auditDB.DB = db
+	auditDB.insert = mustPrepare(db, "INSERT INTO audit (ts, usr, username, action, elementId, details) VALUES (?, ?, ?, ?, ?, ?)")
+	return auditDB
+}
+
+// auditWhere returns an SQL WHERE clause and its arguments.
+func auditWhere(filter core.AuditFilter) (string, []interface{}) {
+
+	var conditions = []string{}
+	var args = []interface{}{}
+
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.NodeID != 0 {
+		conditions = append(conditions, "elementId = ?")
+		args = append(args, filter.NodeID)
+	}
+	if filter.Username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.From != 0 {
+		conditions = append(conditions, "ts >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.Until != 0 {
+		conditions = append(conditions, "ts < ?")
+		args = append(args, filter.Until)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (db *AuditDB) CountAuditEntries(filter core.AuditFilter) (int, error) {
+	var clause, args = auditWhere(filter)
+	var count int
+	return count, db.QueryRow("SELECT COUNT(1) FROM audit"+clause, args...).Scan(&count)
+}
+
+func (db *AuditDB) GetAuditEntries(filter core.AuditFilter, limit, offset int) ([]core.DBAuditEntry, error) {
+
+	var clause, args = auditWhere(filter)
+	args = append(args, limit, offset)
+
+	rows, err := db.Query("SELECT ts, usr, username, action, elementId, details FROM audit"+clause+" ORDER BY id DESC LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries = []core.DBAuditEntry{}
+
+	for rows.Next() {
+		var e = &auditEntry{}
+		if err = rows.Scan(&e.ts, &e.userID, &e.username, &e.action, &e.nodeID, &e.details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func (db *AuditDB) InsertAuditEntry(ts int64, userID int, username string, action string, nodeID int, details string) error {
+	_, err := db.insert.Exec(ts, userID, username, action, nodeID, details)
+	return err
+}
@@ -0,0 +1,222 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type changeSet struct {
+	id         int
+	name       string
+	userID     int
+	tsCreated  int64
+	tsReleased int64
+}
+
+func (cs *changeSet) ID() int {
+	return cs.id
+}
+
+func (cs *changeSet) Name() string {
+	return cs.name
+}
+
+func (cs *changeSet) UserID() int {
+	return cs.userID
+}
+
+func (cs *changeSet) TsCreated() int64 {
+	return cs.tsCreated
+}
+
+func (cs *changeSet) TsReleased() int64 {
+	return cs.tsReleased
+}
+
+type changeSetItem struct {
+	nodeID      int
+	versionNo   int
+	prevGroupID int
+}
+
+func (item *changeSetItem) NodeID() int {
+	return item.nodeID
+}
+
+func (item *changeSetItem) VersionNo() int {
+	return item.versionNo
+}
+
+func (item *changeSetItem) PrevGroupID() int {
+	return item.prevGroupID
+}
+
+type ChangeSetDB struct {
+	*sql.DB
+	clearItems    *sql.Stmt
+	delete        *sql.Stmt
+	get           *sql.Stmt
+	getAll        *sql.Stmt
+	getItems      *sql.Stmt
+	insert        *sql.Stmt
+	putItem       *sql.Stmt
+	removeItem    *sql.Stmt
+	setPrev       *sql.Stmt
+	setReleased   *sql.Stmt
+	setUnreleased *sql.Stmt
+}
+
+func NewChangeSetDB(db *sql.DB) *ChangeSetDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS changeset (
+			id INTEGER PRIMARY KEY,
+			name varchar(128) NOT NULL,
+			usr int(11) NOT NULL,
+			ts_created INTEGER NOT NULL,
+			ts_released INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS changeset_item (
+			changeset int(11) NOT NULL,
+			elementId int(11) NOT NULL,
+			versionNr int(11) NOT NULL,
+			prev_group int(11) NOT NULL DEFAULT 0,
+			PRIMARY KEY (changeset, elementId)
+		);`)
+
+	var changeSetDB = &ChangeSetDB{}
+	changeSetDB.DB = db
+	changeSetDB.clearItems = mustPrepare(db, "DELETE FROM changeset_item WHERE changeset = ?")
+	changeSetDB.delete = mustPrepare(db, "DELETE FROM changeset WHERE id = ?")
+	changeSetDB.get = mustPrepare(db, "SELECT id, name, usr, ts_created, ts_released FROM changeset WHERE id = ?")
+	changeSetDB.getAll = mustPrepare(db, "SELECT id, name, usr, ts_created, ts_released FROM changeset ORDER BY ts_created DESC, id DESC")
+	changeSetDB.getItems = mustPrepare(db, "SELECT elementId, versionNr, prev_group FROM changeset_item WHERE changeset = ? ORDER BY elementId")
+	changeSetDB.insert = mustPrepare(db, "INSERT INTO changeset (name, usr, ts_created) VALUES (?, ?, ?)")
+	changeSetDB.putItem = mustPrepare(db, "REPLACE INTO changeset_item (changeset, elementId, versionNr) VALUES (?, ?, ?)")
+	changeSetDB.removeItem = mustPrepare(db, "DELETE FROM changeset_item WHERE changeset = ? AND elementId = ?")
+	changeSetDB.setPrev = mustPrepare(db, "UPDATE changeset_item SET prev_group = ? WHERE changeset = ? AND elementId = ?")
+	changeSetDB.setReleased = mustPrepare(db, "UPDATE changeset SET ts_released = ? WHERE id = ? AND ts_released = 0")
+	changeSetDB.setUnreleased = mustPrepare(db, "UPDATE changeset SET ts_released = 0 WHERE id = ? AND ts_released != 0")
+	return changeSetDB
+}
+
+func (db *ChangeSetDB) DeleteChangeSet(id int) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Stmt(db.clearItems).Exec(id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Stmt(db.delete).Exec(id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *ChangeSetDB) GetAllChangeSets() ([]core.DBChangeSet, error) {
+
+	rows, err := db.getAll.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all = []core.DBChangeSet{}
+
+	for rows.Next() {
+		var cs = &changeSet{}
+		if err = rows.Scan(&cs.id, &cs.name, &cs.userID, &cs.tsCreated, &cs.tsReleased); err != nil {
+			return nil, err
+		}
+		all = append(all, cs)
+	}
+
+	return all, nil
+}
+
+func (db *ChangeSetDB) GetChangeSet(id int) (core.DBChangeSet, error) {
+	var cs = &changeSet{}
+	return cs, db.get.QueryRow(id).Scan(&cs.id, &cs.name, &cs.userID, &cs.tsCreated, &cs.tsReleased)
+}
+
+func (db *ChangeSetDB) GetChangeSetItems(changeSetID int) ([]core.DBChangeSetItem, error) {
+
+	rows, err := db.getItems.Query(changeSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items = []core.DBChangeSetItem{}
+
+	for rows.Next() {
+		var item = &changeSetItem{}
+		if err = rows.Scan(&item.nodeID, &item.versionNo, &item.prevGroupID); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (db *ChangeSetDB) InsertChangeSet(name string, userID int, ts int64) error {
+	_, err := db.insert.Exec(name, userID, ts)
+	return err
+}
+
+func (db *ChangeSetDB) PutChangeSetItem(changeSetID, nodeID, versionNo int) error {
+	_, err := db.putItem.Exec(changeSetID, nodeID, versionNo)
+	return err
+}
+
+func (db *ChangeSetDB) RemoveChangeSetItem(changeSetID, nodeID int) error {
+	_, err := db.removeItem.Exec(changeSetID, nodeID)
+	return err
+}
+
+func (db *ChangeSetDB) SetChangeSetReleased(changeSetID int, ts int64, prevGroupIDs map[int]int) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var res sql.Result
+	if ts != 0 {
+		res, err = tx.Stmt(db.setReleased).Exec(ts, changeSetID)
+	} else {
+		res, err = tx.Stmt(db.setUnreleased).Exec(changeSetID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		tx.Rollback()
+		if err == nil {
+			err = core.ErrChangeSetState
+		}
+		return err
+	}
+
+	if ts != 0 {
+		for nodeID, groupID := range prevGroupIDs {
+			if _, err = tx.Stmt(db.setPrev).Exec(groupID, changeSetID, nodeID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type comment struct {
+	id        int
+	versionNo int
+	userID    int
+	username  string
+	ts        int64
+	lineFrom  int
+	lineTo    int
+	excerpt   string
+	text      string
+}
+
+func (c *comment) ID() int {
+	return c.id
+}
+
+func (c *comment) VersionNo() int {
+	return c.versionNo
+}
+
+func (c *comment) UserID() int {
+	return c.userID
+}
+
+func (c *comment) Username() string {
+	return c.username
+}
+
+func (c *comment) Ts() int64 {
+	return c.ts
+}
+
+func (c *comment) LineFrom() int {
+	return c.lineFrom
+}
+
+func (c *comment) LineTo() int {
+	return c.lineTo
+}
+
+func (c *comment) Excerpt() string {
+	return c.excerpt
+}
+
+func (c *comment) Text() string {
+	return c.text
+}
+
+type CommentDB struct {
+	db     *sql.DB
+	copy   *sql.Stmt
+	delete *sql.Stmt
+	get    *sql.Stmt
+	insert *sql.Stmt
+}
+
+func NewCommentDB(db *sql.DB) *CommentDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS version_comment (
+			id INTEGER PRIMARY KEY,
+			elementId int(11) NOT NULL,
+			versionNr int(11) NOT NULL,
+			usr int(11) NOT NULL,
+			username varchar(128) NOT NULL,
+			ts INTEGER NOT NULL,
+			line_from int(11) NOT NULL,
+			line_to int(11) NOT NULL,
+			excerpt text NOT NULL,
+			text text NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS version_comment_element ON version_comment (elementId, versionNr);`)
+
+	var commentDB = &CommentDB{}
+	commentDB.db = db
+	commentDB.copy = mustPrepare(db, "INSERT INTO version_comment (elementId, versionNr, usr, username, ts, line_from, line_to, excerpt, text) SELECT elementId, ?, usr, username, ts, line_from, line_to, excerpt, text FROM version_comment WHERE elementId = ? AND versionNr = ? ORDER BY id")
+	commentDB.delete = mustPrepare(db, "DELETE FROM version_comment WHERE elementId = ?")
+	commentDB.get = mustPrepare(db, "SELECT id, versionNr, usr, username, ts, line_from, line_to, excerpt, text FROM version_comment WHERE elementId = ? AND versionNr = ? ORDER BY ts, id")
+	commentDB.insert = mustPrepare(db, "INSERT INTO version_comment (elementId, versionNr, usr, username, ts, line_from, line_to, excerpt, text) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	return commentDB
+}
+
+func (db *CommentDB) CopyComments(nodeID, fromVersionNo, toVersionNo int) error {
+	_, err := db.copy.Exec(toVersionNo, nodeID, fromVersionNo)
+	return err
+}
+
+func (db *CommentDB) DeleteComments(nodeID int) error {
+	_, err := db.delete.Exec(nodeID)
+	return err
+}
+
+func (db *CommentDB) GetComments(nodeID, versionNo int) ([]core.DBComment, error) {
+
+	rows, err := db.get.Query(nodeID, versionNo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments = []core.DBComment{}
+
+	for rows.Next() {
+		var c = &comment{}
+		if err = rows.Scan(&c.id, &c.versionNo, &c.userID, &c.username, &c.ts, &c.lineFrom, &c.lineTo, &c.excerpt, &c.text); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, nil
+}
+
+func (db *CommentDB) InsertComment(nodeID, versionNo, userID int, username string, ts int64, lineFrom, lineTo int, excerpt, text string) error {
+	_, err := db.insert.Exec(nodeID, versionNo, userID, username, ts, lineFrom, lineTo, excerpt, text)
+	return err
+}
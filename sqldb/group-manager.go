@@ -0,0 +1,50 @@
+package sqldb
+
+import (
+	"database/sql"
+)
+
+type GroupManagerDB struct {
+	*sql.DB
+	add        *sql.Stmt
+	getByGroup *sql.Stmt
+	getByUser  *sql.Stmt
+	remove     *sql.Stmt
+}
+
+func NewGroupManagerDB(db *sql.DB) *GroupManagerDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS group_manager (
+			grp int(11) NOT NULL,
+			usr int(11) NOT NULL,
+			PRIMARY KEY (grp, usr)
+		);
+		CREATE INDEX IF NOT EXISTS group_manager_usr ON group_manager (usr);`)
+
+	var groupManagerDB = &GroupManagerDB{}
+	groupManagerDB.DB = db
+	groupManagerDB.add = mustPrepare(db, "INSERT OR IGNORE INTO group_manager (grp, usr) VALUES (?, ?)")
+	groupManagerDB.getByGroup = mustPrepare(db, "SELECT usr FROM group_manager WHERE grp = ?")
+	groupManagerDB.getByUser = mustPrepare(db, "SELECT grp FROM group_manager WHERE usr = ?")
+	groupManagerDB.remove = mustPrepare(db, "DELETE FROM group_manager WHERE grp = ? AND usr = ?")
+	return groupManagerDB
+}
+
+func (db *GroupManagerDB) AddGroupManager(groupID, userID int) error {
+	_, err := db.add.Exec(groupID, userID)
+	return err
+}
+
+func (db *GroupManagerDB) GetGroupManagers(groupID int) ([]int, error) {
+	return queryIDs(db.getByGroup, groupID)
+}
+
+func (db *GroupManagerDB) GetManagedGroups(userID int) ([]int, error) {
+	return queryIDs(db.getByUser, userID)
+}
+
+func (db *GroupManagerDB) RemoveGroupManager(groupID, userID int) error {
+	_, err := db.remove.Exec(groupID, userID)
+	return err
+}
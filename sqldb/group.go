@@ -3,16 +3,20 @@ package sqldb
 import (
 	"database/sql"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/wansing/perspective/core"
 )
 
 type group struct {
-	db            *GroupDB // required for lazy loading
-	id            int
-	name          string
-	members       map[int]interface{} // user id => struct{}
-	membersLoaded bool                // lazy loading
+	db                  *GroupDB // required for lazy loading
+	id                  int
+	name                string
+	directMembers       map[int]interface{} // user id => struct{}
+	directMembersLoaded bool                // lazy loading
+	members             map[int]interface{} // including members of subgroups
+	membersLoaded       bool                // lazy loading
 }
 
 func (g *group) ID() int {
@@ -32,24 +36,42 @@ func (g *group) HasMember(u core.DBUser) (bool, error) {
 	}
 }
 
+func (g *group) DirectMembers() (map[int]interface{}, error) {
+
+	if !g.directMembersLoaded {
+
+		var members, err = g.db.queryIDs(g.db.members, time.Now().Unix(), g.id)
+		if err != nil {
+			return nil, err
+		}
+
+		g.directMembers = members
+		g.directMembersLoaded = true
+	}
+
+	return g.directMembers, nil
+}
+
+// Members returns the members of the group and of its subgroups, recursively.
 func (g *group) Members() (map[int]interface{}, error) {
 
 	if !g.membersLoaded {
 
-		g.members = make(map[int]interface{})
-
-		rows, err := g.db.members.Query(g.id)
+		groupIDs, err := g.db.closure(g.db.subgroups, g.id)
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var userID int
-			if err = rows.Scan(&userID); err != nil {
+		g.members = make(map[int]interface{})
+
+		for groupID := range groupIDs {
+			userIDs, err := g.db.queryIDs(g.db.members, time.Now().Unix(), groupID)
+			if err != nil {
 				return nil, err
 			}
-			g.members[userID] = struct{}{}
+			for userID := range userIDs {
+				g.members[userID] = struct{}{}
+			}
 		}
 
 		g.membersLoaded = true
@@ -60,16 +82,23 @@ func (g *group) Members() (map[int]interface{}, error) {
 
 type GroupDB struct {
 	*sql.DB
-	delete     *sql.Stmt
-	get        *sql.Stmt
-	getAll     *sql.Stmt
-	getByName  *sql.Stmt
-	getOf      *sql.Stmt
-	insert     *sql.Stmt
-	join       *sql.Stmt
-	leave      *sql.Stmt
-	leaveUsers *sql.Stmt
-	members    *sql.Stmt
+	addSubgroup     *sql.Stmt
+	delete          *sql.Stmt
+	deleteExpired   *sql.Stmt
+	deleteSubgroups *sql.Stmt
+	get             *sql.Stmt
+	getAll          *sql.Stmt
+	getByName       *sql.Stmt
+	getOf           *sql.Stmt
+	getTimed        *sql.Stmt
+	insert          *sql.Stmt
+	join            *sql.Stmt
+	leave           *sql.Stmt
+	leaveUsers      *sql.Stmt
+	members         *sql.Stmt
+	removeSubgroup  *sql.Stmt
+	subgroups       *sql.Stmt
+	supergroups     *sql.Stmt
 }
 
 func NewGroupDB(db *sql.DB) *GroupDB {
@@ -83,21 +112,39 @@ func NewGroupDB(db *sql.DB) *GroupDB {
 		CREATE TABLE IF NOT EXISTS membership (
 			grp int(11) NOT NULL,
 			usr int(11) NOT NULL,
+			valid_from int(11) NOT NULL DEFAULT 0,
+			valid_until int(11) NOT NULL DEFAULT 0,
 			PRIMARY KEY (grp, usr)
+		);
+		CREATE TABLE IF NOT EXISTS subgroup (
+			grp int(11) NOT NULL,
+			sub int(11) NOT NULL,
+			PRIMARY KEY (grp, sub)
 		);`)
 
+	// migration
+	db.Exec("ALTER TABLE membership ADD COLUMN valid_from int(11) NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE membership ADD COLUMN valid_until int(11) NOT NULL DEFAULT 0")
+
 	var groupDB = &GroupDB{}
 	groupDB.DB = db
+	groupDB.addSubgroup = mustPrepare(db, "INSERT INTO subgroup (grp, sub) VALUES (?, ?)")
 	groupDB.delete = mustPrepare(db, "DELETE FROM grp WHERE id = ?")
+	groupDB.deleteExpired = mustPrepare(db, "DELETE FROM membership WHERE valid_until != 0 AND valid_until <= ?")
+	groupDB.deleteSubgroups = mustPrepare(db, "DELETE FROM subgroup WHERE grp = ? OR sub = ?")
 	groupDB.get = mustPrepare(db, "SELECT name FROM grp WHERE id = ? LIMIT 1")
 	groupDB.getAll = mustPrepare(db, "SELECT id, name FROM grp ORDER BY name LIMIT ? OFFSET ?")
 	groupDB.getByName = mustPrepare(db, "SELECT id FROM grp WHERE name = ? LIMIT 1")
-	groupDB.getOf = mustPrepare(db, "SELECT grp.id, grp.name FROM grp, membership WHERE grp.id = membership.grp AND membership.usr = ? ORDER BY grp.name")
+	groupDB.getOf = mustPrepare(db, "SELECT grp.id, grp.name FROM grp, membership WHERE grp.id = membership.grp AND membership.usr = ?2 AND "+validNow+" ORDER BY grp.name")
+	groupDB.getTimed = mustPrepare(db, "SELECT usr, valid_from, valid_until FROM membership WHERE grp = ? AND (valid_from != 0 OR valid_until != 0)")
 	groupDB.insert = mustPrepare(db, "INSERT INTO grp (name) VALUES (?)")
-	groupDB.join = mustPrepare(db, "INSERT INTO membership (grp, usr) VALUES (?, ?)")
+	groupDB.join = mustPrepare(db, "REPLACE INTO membership (grp, usr, valid_from, valid_until) VALUES (?, ?, ?, ?)")
 	groupDB.leave = mustPrepare(db, "DELETE FROM membership WHERE grp = ? AND usr = ?")
 	groupDB.leaveUsers = mustPrepare(db, "DELETE FROM membership WHERE grp = ?")
-	groupDB.members = mustPrepare(db, "SELECT usr FROM membership WHERE grp = ?")
+	groupDB.members = mustPrepare(db, "SELECT usr FROM membership WHERE grp = ?2 AND "+validNow)
+	groupDB.removeSubgroup = mustPrepare(db, "DELETE FROM subgroup WHERE grp = ? AND sub = ?")
+	groupDB.subgroups = mustPrepare(db, "SELECT sub FROM subgroup WHERE grp = ?")
+	groupDB.supergroups = mustPrepare(db, "SELECT grp FROM subgroup WHERE sub = ?")
 	return groupDB
 }
 
@@ -118,6 +165,12 @@ func (db *GroupDB) Delete(g core.DBGroup) error {
 		return err
 	}
 
+	_, err = tx.Stmt(db.deleteSubgroups).Exec(g.ID(), g.ID())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	_, err = tx.Stmt(db.delete).Exec(g.ID())
 	if err != nil {
 		tx.Rollback()
@@ -174,8 +227,151 @@ func (db *GroupDB) GetAllGroups(limit, offset int) ([]core.DBGroup, error) {
 	return db.getMultiple(db.getAll, limit, offset)
 }
 
+// GetGroupsOf returns the groups which the user is a member of, including the supergroups of these groups, recursively.
 func (db *GroupDB) GetGroupsOf(u core.DBUser) ([]core.DBGroup, error) {
-	return db.getMultiple(db.getOf, u.ID())
+
+	direct, err := db.getMultiple(db.getOf, time.Now().Unix(), u.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	var result = direct
+	var seen = make(map[int]interface{})
+	for _, g := range direct {
+		seen[g.ID()] = struct{}{}
+	}
+
+	for _, g := range direct {
+		supergroups, err := db.GetSupergroups(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, sg := range supergroups {
+			if _, ok := seen[sg.ID()]; !ok {
+				seen[sg.ID()] = struct{}{}
+				result = append(result, sg)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (db *GroupDB) GetTimedMemberships(g core.DBGroup) (map[int]core.Validity, error) {
+
+	rows, err := db.getTimed.Query(g.ID())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships = make(map[int]core.Validity)
+	for rows.Next() {
+		var userID int
+		var v core.Validity
+		if err = rows.Scan(&userID, &v.From, &v.Until); err != nil {
+			return nil, err
+		}
+		memberships[userID] = v
+	}
+
+	return memberships, nil
+}
+
+func (db *GroupDB) DeleteExpiredMemberships(before int64) (int64, error) {
+	res, err := db.deleteExpired.Exec(before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *GroupDB) GetSubgroups(g core.DBGroup) ([]core.DBGroup, error) {
+	ids, err := db.queryIDs(db.subgroups, g.ID())
+	if err != nil {
+		return nil, err
+	}
+	return db.getByIDs(ids)
+}
+
+// GetSupergroups returns the groups which contain the given group, recursively.
+func (db *GroupDB) GetSupergroups(g core.DBGroup) ([]core.DBGroup, error) {
+	ids, err := db.closure(db.supergroups, g.ID())
+	if err != nil {
+		return nil, err
+	}
+	delete(ids, g.ID())
+	return db.getByIDs(ids)
+}
+
+func (db *GroupDB) AddSubgroup(g, sub core.DBGroup) error {
+	_, err := db.addSubgroup.Exec(g.ID(), sub.ID())
+	return err
+}
+
+func (db *GroupDB) RemoveSubgroup(g, sub core.DBGroup) error {
+	_, err := db.removeSubgroup.Exec(g.ID(), sub.ID())
+	return err
+}
+
+// closure follows the edges which stmt returns for an id, starting at the given id. The result includes the start id. Cycles are tolerated.
+func (db *GroupDB) closure(stmt *sql.Stmt, start int) (map[int]interface{}, error) {
+
+	var result = map[int]interface{}{start: struct{}{}}
+	var queue = []int{start}
+
+	for len(queue) > 0 {
+		var id = queue[0]
+		queue = queue[1:]
+		next, err := db.queryIDs(stmt, id)
+		if err != nil {
+			return nil, err
+		}
+		for n := range next {
+			if _, ok := result[n]; !ok {
+				result[n] = struct{}{}
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// getByIDs returns the groups with the given ids, ordered by name.
+func (db *GroupDB) getByIDs(ids map[int]interface{}) ([]core.DBGroup, error) {
+	var result = make([]core.DBGroup, 0, len(ids))
+	for id := range ids {
+		g, err := db.GetGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func (db *GroupDB) queryIDs(stmt *sql.Stmt, args ...interface{}) (map[int]interface{}, error) {
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids = make(map[int]interface{})
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = struct{}{}
+	}
+
+	return ids, nil
 }
 
 func (db *GroupDB) InsertGroup(name string) error {
@@ -183,20 +379,21 @@ func (db *GroupDB) InsertGroup(name string) error {
 	return err
 }
 
-func (db *GroupDB) Join(g core.DBGroup, user core.DBUser) error {
+// Join adds the user to the group, or updates the validity of an existing membership.
+func (db *GroupDB) Join(g core.DBGroup, user core.DBUser, validity core.Validity) error {
 
 	if user.ID() == 0 {
 		return errors.New("can't add all users")
 	}
 
-	_, err := db.join.Exec(g.ID(), user.ID())
+	_, err := db.join.Exec(g.ID(), user.ID(), validity.From, validity.Until)
 	if err != nil {
 		return err
 	}
 
-	if grp := g.(*group); grp.members != nil { // if members are loaded
-		grp.members[user.ID()] = struct{}{}
-	}
+	// the membership might not be valid now, so reload
+	g.(*group).directMembersLoaded = false
+	g.(*group).membersLoaded = false
 	return nil
 }
 
@@ -211,8 +408,9 @@ func (db *GroupDB) Leave(g core.DBGroup, user core.DBUser) error {
 		return err
 	}
 
-	if grp := g.(*group); grp.members != nil { // if members are loaded
-		delete(grp.members, user.ID())
+	if grp := g.(*group); grp.directMembersLoaded {
+		delete(grp.directMembers, user.ID())
 	}
+	g.(*group).membersLoaded = false // user might still be a member of a subgroup
 	return nil
 }
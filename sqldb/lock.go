@@ -0,0 +1,87 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type lock struct {
+	nodeID      int
+	userID      int
+	tsAcquired  int64
+	tsHeartbeat int64
+}
+
+func (l *lock) NodeID() int {
+	return l.nodeID
+}
+
+func (l *lock) UserID() int {
+	return l.userID
+}
+
+func (l *lock) TsAcquired() int64 {
+	return l.tsAcquired
+}
+
+func (l *lock) TsHeartbeat() int64 {
+	return l.tsHeartbeat
+}
+
+type LockDB struct {
+	db        *sql.DB
+	get       *sql.Stmt
+	heartbeat *sql.Stmt
+	remove    *sql.Stmt
+	set       *sql.Stmt
+}
+
+func NewLockDB(db *sql.DB) *LockDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS element_lock (
+			elementId int(11) NOT NULL,
+			usr int(11) NOT NULL,
+			ts_acquired INTEGER NOT NULL,
+			ts_heartbeat INTEGER NOT NULL,
+			PRIMARY KEY (elementId)
+		);`)
+
+	var lockDB = &LockDB{}
+	lockDB.db = db
+	lockDB.get = mustPrepare(db, "SELECT usr, ts_acquired, ts_heartbeat FROM element_lock WHERE elementId = ? LIMIT 1")
+	lockDB.heartbeat = mustPrepare(db, "UPDATE element_lock SET ts_heartbeat = ? WHERE elementId = ? AND usr = ?")
+	lockDB.remove = mustPrepare(db, "DELETE FROM element_lock WHERE elementId = ?")
+	lockDB.set = mustPrepare(db, "REPLACE INTO element_lock (elementId, usr, ts_acquired, ts_heartbeat) VALUES (?, ?, ?, ?)") // REPLACE works in SQLite and MySQL
+	return lockDB
+}
+
+func (db *LockDB) GetLock(nodeID int) (core.DBLock, error) {
+	var l = &lock{
+		nodeID: nodeID,
+	}
+	err := db.get.QueryRow(nodeID).Scan(&l.userID, &l.tsAcquired, &l.tsHeartbeat)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (db *LockDB) Heartbeat(nodeID int, userID int, now int64) error {
+	_, err := db.heartbeat.Exec(now, nodeID, userID)
+	return err
+}
+
+func (db *LockDB) RemoveLock(nodeID int) error {
+	_, err := db.remove.Exec(nodeID)
+	return err
+}
+
+func (db *LockDB) SetLock(nodeID int, userID int, now int64) error {
+	_, err := db.set.Exec(nodeID, userID, now, now)
+	return err
+}
@@ -0,0 +1,78 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type LoginFailureDB struct {
+	*sql.DB
+	delete       *sql.Stmt
+	deleteBefore *sql.Stmt
+	get          *sql.Stmt
+	getAll       *sql.Stmt
+	record       *sql.Stmt
+}
+
+func NewLoginFailureDB(db *sql.DB) *LoginFailureDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS login_failure (
+			key varchar(255) NOT NULL,
+			count int(11) NOT NULL,
+			last_ts INTEGER NOT NULL,
+			PRIMARY KEY (key)
+		);`)
+
+	var loginFailureDB = &LoginFailureDB{}
+	loginFailureDB.DB = db
+	loginFailureDB.delete = mustPrepare(db, "DELETE FROM login_failure WHERE key = ?")
+	loginFailureDB.deleteBefore = mustPrepare(db, "DELETE FROM login_failure WHERE last_ts < ?")
+	loginFailureDB.get = mustPrepare(db, "SELECT count, last_ts FROM login_failure WHERE key = ?")
+	loginFailureDB.getAll = mustPrepare(db, "SELECT key, count, last_ts FROM login_failure ORDER BY last_ts DESC")
+	loginFailureDB.record = mustPrepare(db, "INSERT INTO login_failure (key, count, last_ts) VALUES (?1, 1, ?2) ON CONFLICT (key) DO UPDATE SET count = count + 1, last_ts = ?2")
+	return loginFailureDB
+}
+
+func (db *LoginFailureDB) DeleteLoginFailure(key string) error {
+	_, err := db.delete.Exec(key)
+	return err
+}
+
+func (db *LoginFailureDB) DeleteLoginFailuresBefore(ts int64) error {
+	_, err := db.deleteBefore.Exec(ts)
+	return err
+}
+
+func (db *LoginFailureDB) GetLoginFailure(key string) (core.LoginFailure, error) {
+	var lf = core.LoginFailure{Key: key}
+	switch err := db.get.QueryRow(key).Scan(&lf.Count, &lf.LastTs); err {
+	case nil, sql.ErrNoRows:
+		return lf, nil
+	default:
+		return lf, err
+	}
+}
+
+func (db *LoginFailureDB) GetLoginFailures() ([]core.LoginFailure, error) {
+	rows, err := db.getAll.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var failures = []core.LoginFailure{}
+	for rows.Next() {
+		var lf core.LoginFailure
+		if err = rows.Scan(&lf.Key, &lf.Count, &lf.LastTs); err != nil {
+			return nil, err
+		}
+		failures = append(failures, lf)
+	}
+	return failures, nil
+}
+
+func (db *LoginFailureDB) RecordLoginFailure(key string, ts int64) error {
+	_, err := db.record.Exec(key, ts)
+	return err
+}
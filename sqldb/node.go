@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/wansing/perspective/core"
@@ -137,6 +138,9 @@ func NewNodeDB(db *sql.DB) *NodeDB {
 		panic(err)
 	}
 
+	// for GetLatestVersionsInWorkflowGroups
+	db.Exec(`CREATE INDEX IF NOT EXISTS version_workflow_group ON version (workflow_group)`)
+
 	var nodeDB = &NodeDB{}
 	nodeDB.DB = db
 	nodeDB.calculateMWGZV = mustPrepare(db, "SELECT COALESCE(max(versionNr), 0) FROM version WHERE version.id = ? AND version.workflow_group = 0")
@@ -224,9 +228,11 @@ func (db *NodeDB) DeleteNode(e core.DBNode) error {
 	var childrenCount int
 	if err := tx.Stmt(db.countChildren).QueryRow(e.ID()).Scan(&childrenCount); err == nil {
 		if childrenCount > 0 {
+			tx.Rollback()
 			return errors.New("can't delete node with child nodes")
 		}
 	} else {
+		tx.Rollback()
 		return err
 	}
 
@@ -242,6 +248,17 @@ func (db *NodeDB) DeleteNode(e core.DBNode) error {
 		return err
 	}
 
+	// The tables belong to ChangeSetDB and LockDB. They are cleaned up in this transaction, because SQLite can reuse the node id.
+	for _, query := range []string{
+		"DELETE FROM changeset_item WHERE elementId = ?",
+		"DELETE FROM element_lock WHERE elementId = ?",
+	} {
+		if _, err = tx.Exec(query, e.ID()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -330,6 +347,40 @@ func (db *NodeDB) GetReleasedChildren(id int, order core.Order, limit, offset in
 	return children, nil
 }
 
+// GetLatestVersionsInWorkflowGroups can't use a prepared statement because the number of groups varies.
+func (db *NodeDB) GetLatestVersionsInWorkflowGroups(groupIDs []int) ([]core.DBNodeVersion, error) {
+
+	var result = []core.DBNodeVersion{}
+
+	if len(groupIDs) == 0 {
+		return result, nil
+	}
+
+	var placeholders = make([]string, len(groupIDs))
+	var args = make([]interface{}, len(groupIDs))
+	for i, groupID := range groupIDs {
+		placeholders[i] = "?"
+		args[i] = groupID
+	}
+
+	rows, err := db.Query("SELECT e.id, e.parentId, e.slug, e.class, e.ts_created, e.maxVersion, e.maxWGZeroVersion, v.versionNr, v.versionNote, v.content, v.ts_changed, v.workflow_group FROM version v, element e WHERE v.workflow_group IN ("+strings.Join(placeholders, ", ")+") AND e.id = v.id AND v.versionNr = e.maxVersion ORDER BY v.ts_changed", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nv = &nodeVersion{}
+		err := rows.Scan(&nv.id, &nv.parentID, &nv.slug, &nv.classCode, &nv.tsCreated, &nv.maxVersionNo, &nv.maxWGZeroVersionNo, &nv.versionNo, &nv.versionNote, &nv.content, &nv.tsChanged, &nv.workflowGroupID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, nv)
+	}
+
+	return result, nil
+}
+
 func (db *NodeDB) InsertNode(parentID int, slug string, classCode string) error {
 	_, err := db.insertNode.Exec(parentID, slug, classCode, time.Now().Unix(), 0, 0)
 	return err
@@ -339,6 +390,35 @@ func (db *NodeDB) IsNotFound(err error) bool {
 	return errors.Is(err, sql.ErrNoRows)
 }
 
+func (db *NodeDB) SearchNodes(slugTerm, contentTerm string, limit, offset int) ([]core.DBNode, error) {
+
+	rows, err := db.Query(`SELECT DISTINCT e.id, e.parentId, e.slug, e.class, e.ts_created, e.maxVersion, e.maxWGZeroVersion FROM element e LEFT JOIN version v ON v.id = e.id AND (v.versionNr = e.maxVersion OR v.versionNr = e.maxWGZeroVersion) WHERE e.slug LIKE ? ESCAPE '\' OR v.content LIKE ? ESCAPE '\' ORDER BY e.id LIMIT ? OFFSET ?`, likePattern(slugTerm), likePattern(contentTerm), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = []core.DBNode{}
+
+	for rows.Next() {
+		var n = &node{}
+		if err := rows.Scan(&n.id, &n.parentID, &n.slug, &n.classCode, &n.tsCreated, &n.maxVersionNo, &n.maxWGZeroVersionNo); err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+
+	return result, nil
+}
+
+// likePattern returns a LIKE pattern which matches strings containing term. Use it with ESCAPE '\'.
+func likePattern(term string) string {
+	term = strings.ReplaceAll(term, `\`, `\\`)
+	term = strings.ReplaceAll(term, "%", `\%`)
+	term = strings.ReplaceAll(term, "_", `\_`)
+	return "%" + term + "%"
+}
+
 func (db *NodeDB) SetClass(e core.DBNode, classCode string) error {
 	_, err := db.setClass.Exec(classCode, e.ID())
 	if err == nil {
@@ -404,6 +484,51 @@ func (db *NodeDB) SetWorkflowGroup(n core.DBNode, v core.DBVersionStub, groupID
 	return nil
 }
 
+func (db *NodeDB) SetWorkflowGroups(changes []core.WorkflowGroupChange) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var newMWGZVs = make([]int, len(changes))
+
+	for i, change := range changes {
+
+		_, err = tx.Stmt(db.setWorkflowGroup).Exec(change.GroupID, change.Node.ID(), change.Version.VersionNo())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Stmt(db.calculateMWGZV).QueryRow(change.Node.ID()).Scan(&newMWGZVs[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.Stmt(db.setMWGZV).Exec(newMWGZVs[i], change.Node.ID()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// copied from SetWorkflowGroup
+	for i, change := range changes {
+		if nn, ok := change.Node.(*node); ok {
+			nn.maxWGZeroVersionNo = newMWGZVs[i]
+		}
+		if vv, ok := change.Version.(*version); ok {
+			vv.workflowGroupID = change.GroupID
+		}
+	}
+
+	return nil
+}
+
 func (db *NodeDB) Versions(id int) ([]core.DBVersionStub, error) {
 
 	rows, err := db.versions.Query(id)
@@ -0,0 +1,78 @@
+package sqldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wansing/perspective/core"
+)
+
+func TestDeleteNodeReferencedByChangeSet(t *testing.T) {
+
+	var db = openTestDB(t)
+	var changeSetDB = NewChangeSetDB(db)
+	var lockDB = NewLockDB(db)
+	var nodeDB = NewNodeDB(db)
+	var now = time.Now().Unix()
+
+	for _, slug := range []string{"keep", "delete"} {
+		if err := nodeDB.InsertNode(core.RootID, slug, "html"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keep, err := nodeDB.GetNodeBySlug(core.RootID, "keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := nodeDB.GetNodeBySlug(core.RootID, "delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an open change set which contains both nodes, and locks on both nodes
+	if err := changeSetDB.InsertChangeSet("open", 1, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []core.DBNode{keep, deleted} {
+		if err := nodeDB.AddVersion(n, "content", "", 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := changeSetDB.PutChangeSetItem(1, n.ID(), 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockDB.SetLock(n.ID(), 1, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := nodeDB.DeleteNode(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	// SQLite reuses the id of the deleted node, which must not inherit the item or the lock
+	if err := nodeDB.InsertNode(core.RootID, "new", "html"); err != nil {
+		t.Fatal(err)
+	}
+	reused, err := nodeDB.GetNodeBySlug(core.RootID, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused.ID() != deleted.ID() {
+		t.Logf("node id %d has not been reused", deleted.ID())
+	}
+
+	items, err := changeSetDB.GetChangeSetItems(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].NodeID() != keep.ID() {
+		t.Errorf("got %d change set items, want the item of node %d only", len(items), keep.ID())
+	}
+
+	if lock, err := lockDB.GetLock(deleted.ID()); err != nil || lock != nil {
+		t.Errorf("lock of the deleted node: got %v, %v", lock, err)
+	}
+	if lock, err := lockDB.GetLock(keep.ID()); err != nil || lock == nil {
+		t.Errorf("lock of the other node: got %v, %v", lock, err)
+	}
+}
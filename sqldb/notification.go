@@ -0,0 +1,89 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type NotificationDB struct {
+	*sql.DB
+	deleteDigest *sql.Stmt
+	getDigest    *sql.Stmt
+	getMode      *sql.Stmt
+	insertDigest *sql.Stmt
+	setMode      *sql.Stmt
+}
+
+func NewNotificationDB(db *sql.DB) *NotificationDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS notification_setting (
+			usr INTEGER PRIMARY KEY,
+			mode varchar(32) NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS notification_digest (
+			id INTEGER PRIMARY KEY,
+			usr int(11) NOT NULL,
+			ts INTEGER NOT NULL,
+			text text NOT NULL
+		);`)
+
+	var notificationDB = &NotificationDB{}
+	notificationDB.DB = db
+	notificationDB.deleteDigest = mustPrepare(db, "DELETE FROM notification_digest WHERE usr = ? AND ts <= ?")
+	notificationDB.getDigest = mustPrepare(db, "SELECT usr, text FROM notification_digest WHERE ts <= ? ORDER BY ts, id")
+	notificationDB.getMode = mustPrepare(db, "SELECT mode FROM notification_setting WHERE usr = ?")
+	notificationDB.insertDigest = mustPrepare(db, "INSERT INTO notification_digest (usr, ts, text) VALUES (?, ?, ?)")
+	notificationDB.setMode = mustPrepare(db, "REPLACE INTO notification_setting (usr, mode) VALUES (?, ?)")
+	return notificationDB
+}
+
+func (db *NotificationDB) DeleteDigestItems(userID int, until int64) error {
+	_, err := db.deleteDigest.Exec(userID, until)
+	return err
+}
+
+func (db *NotificationDB) GetDigestItems(until int64) (map[int][]string, error) {
+
+	rows, err := db.getDigest.Query(until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items = make(map[int][]string)
+
+	for rows.Next() {
+		var userID int
+		var text string
+		if err = rows.Scan(&userID, &text); err != nil {
+			return nil, err
+		}
+		items[userID] = append(items[userID], text)
+	}
+
+	return items, rows.Err()
+}
+
+func (db *NotificationDB) GetNotificationMode(userID int) (string, error) {
+	var mode string
+	switch err := db.getMode.QueryRow(userID).Scan(&mode); err {
+	case nil:
+		return mode, nil
+	case sql.ErrNoRows:
+		return core.NotifyImmediately, nil
+	default:
+		return "", err
+	}
+}
+
+func (db *NotificationDB) InsertDigestItem(userID int, ts int64, text string) error {
+	_, err := db.insertDigest.Exec(userID, ts, text)
+	return err
+}
+
+func (db *NotificationDB) SetNotificationMode(userID int, mode string) error {
+	_, err := db.setMode.Exec(userID, mode)
+	return err
+}
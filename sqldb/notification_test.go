@@ -0,0 +1,46 @@
+package sqldb
+
+import (
+	"testing"
+)
+
+func TestDeleteDigestItems(t *testing.T) {
+
+	var notificationDB = NewNotificationDB(openTestDB(t))
+
+	for _, item := range []struct {
+		userID int
+		ts     int64
+		text   string
+	}{
+		{1, 100, "first"},
+		{1, 200, "second"},
+		{1, 300, "later"},
+		{2, 150, "other user"},
+	} {
+		if err := notificationDB.InsertDigestItem(item.userID, item.ts, item.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := notificationDB.GetDigestItems(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || len(items[1]) != 2 || items[1][0] != "first" || items[1][1] != "second" || len(items[2]) != 1 {
+		t.Fatalf("got %v", items)
+	}
+
+	// only the items of user 1 have been sent
+	if err := notificationDB.DeleteDigestItems(1, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err = notificationDB.GetDigestItems(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items[1]) != 1 || items[1][0] != "later" || len(items[2]) != 1 || items[2][0] != "other user" {
+		t.Fatalf("got %v after deleting", items)
+	}
+}
@@ -0,0 +1,71 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type PasswordTokenDB struct {
+	*sql.DB
+	delete        *sql.Stmt
+	deleteExpired *sql.Stmt
+	deleteOfUser  *sql.Stmt
+	get           *sql.Stmt
+	insert        *sql.Stmt
+}
+
+func NewPasswordTokenDB(db *sql.DB) *PasswordTokenDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS password_token (
+			hash varchar(64) NOT NULL,
+			usr int(11) NOT NULL,
+			purpose varchar(16) NOT NULL,
+			expires INTEGER NOT NULL,
+			PRIMARY KEY (hash)
+		);`)
+
+	var passwordTokenDB = &PasswordTokenDB{}
+	passwordTokenDB.DB = db
+	passwordTokenDB.delete = mustPrepare(db, "DELETE FROM password_token WHERE hash = ?")
+	passwordTokenDB.deleteExpired = mustPrepare(db, "DELETE FROM password_token WHERE expires < ?")
+	passwordTokenDB.deleteOfUser = mustPrepare(db, "DELETE FROM password_token WHERE usr = ?")
+	passwordTokenDB.get = mustPrepare(db, "SELECT usr, purpose, expires FROM password_token WHERE hash = ?")
+	passwordTokenDB.insert = mustPrepare(db, "INSERT INTO password_token (hash, usr, purpose, expires) VALUES (?, ?, ?, ?)")
+	return passwordTokenDB
+}
+
+func (db *PasswordTokenDB) DeleteExpiredPasswordTokens(before int64) error {
+	_, err := db.deleteExpired.Exec(before)
+	return err
+}
+
+func (db *PasswordTokenDB) DeletePasswordToken(hash string) (bool, error) {
+	res, err := db.delete.Exec(hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (db *PasswordTokenDB) DeletePasswordTokens(userID int) error {
+	_, err := db.deleteOfUser.Exec(userID)
+	return err
+}
+
+func (db *PasswordTokenDB) GetPasswordToken(hash string) (core.PasswordToken, error) {
+	var t = core.PasswordToken{Hash: hash}
+	switch err := db.get.QueryRow(hash).Scan(&t.UserID, &t.Purpose, &t.Expires); err {
+	case nil, sql.ErrNoRows:
+		return t, nil
+	default:
+		return t, err
+	}
+}
+
+func (db *PasswordTokenDB) InsertPasswordToken(t core.PasswordToken) error {
+	_, err := db.insert.Exec(t.Hash, t.UserID, t.Purpose, t.Expires)
+	return err
+}
@@ -0,0 +1,141 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type RegistrationDB struct {
+	*sql.DB
+	confirm       *sql.Stmt
+	delete        *sql.Stmt
+	deleteConfig  *sql.Stmt
+	get           *sql.Stmt
+	getAll        *sql.Stmt
+	getAllConfigs *sql.Stmt
+	getConfig     *sql.Stmt
+	insert        *sql.Stmt
+	setConfig     *sql.Stmt
+}
+
+func NewRegistrationDB(db *sql.DB) *RegistrationDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS registration (
+			usr int(11) PRIMARY KEY,
+			node int(11) NOT NULL,
+			node_path varchar(255) NOT NULL DEFAULT '',
+			pending_group int(11) NOT NULL DEFAULT 0,
+			member_group int(11) NOT NULL,
+			approval INTEGER NOT NULL DEFAULT 0,
+			confirmed INTEGER NOT NULL DEFAULT 0,
+			created INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS registration_config (
+			node int(11) PRIMARY KEY,
+			pending_group int(11) NOT NULL DEFAULT 0,
+			member_group int(11) NOT NULL,
+			approval INTEGER NOT NULL DEFAULT 0
+		);`)
+
+	var registrationDB = &RegistrationDB{}
+	registrationDB.DB = db
+	registrationDB.confirm = mustPrepare(db, "UPDATE registration SET confirmed = 1 WHERE usr = ?")
+	registrationDB.delete = mustPrepare(db, "DELETE FROM registration WHERE usr = ?")
+	registrationDB.deleteConfig = mustPrepare(db, "DELETE FROM registration_config WHERE node = ?")
+	registrationDB.get = mustPrepare(db, "SELECT node, node_path, pending_group, member_group, approval, confirmed, created FROM registration WHERE usr = ?")
+	registrationDB.getAll = mustPrepare(db, "SELECT usr, node, node_path, pending_group, member_group, approval, confirmed, created FROM registration ORDER BY created DESC")
+	registrationDB.getAllConfigs = mustPrepare(db, "SELECT node, pending_group, member_group, approval FROM registration_config ORDER BY node")
+	registrationDB.getConfig = mustPrepare(db, "SELECT pending_group, member_group, approval FROM registration_config WHERE node = ?")
+	registrationDB.insert = mustPrepare(db, "INSERT INTO registration (usr, node, node_path, pending_group, member_group, approval, created) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	registrationDB.setConfig = mustPrepare(db, "REPLACE INTO registration_config (node, pending_group, member_group, approval) VALUES (?, ?, ?, ?)")
+	return registrationDB
+}
+
+func (db *RegistrationDB) ConfirmRegistration(userID int) error {
+	_, err := db.confirm.Exec(userID)
+	return err
+}
+
+func (db *RegistrationDB) DeleteRegistration(userID int) error {
+	_, err := db.delete.Exec(userID)
+	return err
+}
+
+func (db *RegistrationDB) DeleteRegistrationConfig(nodeID int) error {
+	_, err := db.deleteConfig.Exec(nodeID)
+	return err
+}
+
+func (db *RegistrationDB) GetRegistration(userID int) (core.Registration, error) {
+	var r = core.Registration{UserID: userID}
+	switch err := db.get.QueryRow(userID).Scan(&r.NodeID, &r.NodePath, &r.PendingGroup, &r.MemberGroup, &r.Approval, &r.Confirmed, &r.Created); err {
+	case nil:
+		return r, nil
+	case sql.ErrNoRows:
+		return core.Registration{}, nil
+	default:
+		return core.Registration{}, err
+	}
+}
+
+func (db *RegistrationDB) GetRegistrationConfig(nodeID int) (core.RegistrationConfig, error) {
+	var c = core.RegistrationConfig{NodeID: nodeID}
+	switch err := db.getConfig.QueryRow(nodeID).Scan(&c.PendingGroup, &c.MemberGroup, &c.Approval); err {
+	case nil:
+		return c, nil
+	case sql.ErrNoRows:
+		return core.RegistrationConfig{}, nil
+	default:
+		return core.RegistrationConfig{}, err
+	}
+}
+
+func (db *RegistrationDB) GetRegistrationConfigs() ([]core.RegistrationConfig, error) {
+
+	rows, err := db.getAllConfigs.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs = []core.RegistrationConfig{}
+	for rows.Next() {
+		var c core.RegistrationConfig
+		if err := rows.Scan(&c.NodeID, &c.PendingGroup, &c.MemberGroup, &c.Approval); err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+func (db *RegistrationDB) GetRegistrations() ([]core.Registration, error) {
+
+	rows, err := db.getAll.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var registrations = []core.Registration{}
+	for rows.Next() {
+		var r core.Registration
+		if err := rows.Scan(&r.UserID, &r.NodeID, &r.NodePath, &r.PendingGroup, &r.MemberGroup, &r.Approval, &r.Confirmed, &r.Created); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, r)
+	}
+	return registrations, rows.Err()
+}
+
+func (db *RegistrationDB) InsertRegistration(r core.Registration) error {
+	_, err := db.insert.Exec(r.UserID, r.NodeID, r.NodePath, r.PendingGroup, r.MemberGroup, r.Approval, r.Created)
+	return err
+}
+
+func (db *RegistrationDB) SetRegistrationConfig(c core.RegistrationConfig) error {
+	_, err := db.setConfig.Exec(c.NodeID, c.PendingGroup, c.MemberGroup, c.Approval)
+	return err
+}
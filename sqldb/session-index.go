@@ -0,0 +1,118 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type SessionIndexDB struct {
+	*sql.DB
+	delete      *sql.Stmt
+	deleteAll   *sql.Stmt
+	deleteStale *sql.Stmt
+	get         *sql.Stmt
+	getByHash   *sql.Stmt
+	getAll      *sql.Stmt
+	insert      *sql.Stmt
+	touch       *sql.Stmt
+}
+
+func NewSessionIndexDB(db *sql.DB) *SessionIndexDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS session_index (
+			id varchar(64) PRIMARY KEY,
+			usr int(11) NOT NULL,
+			created INTEGER NOT NULL,
+			last_seen INTEGER NOT NULL,
+			user_agent varchar(255) NOT NULL DEFAULT '',
+			ip varchar(64) NOT NULL DEFAULT '',
+			remember_hash varchar(64) NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS session_index_usr ON session_index (usr);
+		CREATE INDEX IF NOT EXISTS session_index_remember_hash ON session_index (remember_hash);`)
+
+	var sessionIndexDB = &SessionIndexDB{}
+	sessionIndexDB.DB = db
+	sessionIndexDB.delete = mustPrepare(db, "DELETE FROM session_index WHERE usr = ? AND id = ?")
+	sessionIndexDB.deleteAll = mustPrepare(db, "DELETE FROM session_index WHERE usr = ? AND id != ?")
+	sessionIndexDB.deleteStale = mustPrepare(db, "DELETE FROM session_index WHERE created < ? OR (remember_hash = '' AND last_seen < ?)")
+	sessionIndexDB.get = mustPrepare(db, "SELECT usr, created, last_seen, user_agent, ip, remember_hash FROM session_index WHERE id = ?")
+	sessionIndexDB.getByHash = mustPrepare(db, "SELECT id, usr, created, last_seen, user_agent, ip FROM session_index WHERE remember_hash = ? AND remember_hash != ''")
+	sessionIndexDB.getAll = mustPrepare(db, "SELECT id, created, last_seen, user_agent, ip, remember_hash FROM session_index WHERE usr = ? ORDER BY last_seen DESC")
+	sessionIndexDB.insert = mustPrepare(db, "INSERT INTO session_index (id, usr, created, last_seen, user_agent, ip, remember_hash) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	sessionIndexDB.touch = mustPrepare(db, "UPDATE session_index SET last_seen = ? WHERE id = ?")
+	return sessionIndexDB
+}
+
+func (db *SessionIndexDB) DeleteSession(userID int, id string) error {
+	_, err := db.delete.Exec(userID, id)
+	return err
+}
+
+func (db *SessionIndexDB) DeleteSessions(userID int, except string) error {
+	_, err := db.deleteAll.Exec(userID, except)
+	return err
+}
+
+func (db *SessionIndexDB) DeleteStaleSessions(createdBefore, idleBefore int64) error {
+	_, err := db.deleteStale.Exec(createdBefore, idleBefore)
+	return err
+}
+
+func (db *SessionIndexDB) GetRememberedSession(rememberHash string) (core.Session, error) {
+	var s = core.Session{RememberHash: rememberHash}
+	switch err := db.getByHash.QueryRow(rememberHash).Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.UserAgent, &s.IP); err {
+	case nil:
+		return s, nil
+	case sql.ErrNoRows:
+		return core.Session{}, nil
+	default:
+		return core.Session{}, err
+	}
+}
+
+func (db *SessionIndexDB) GetSession(id string) (core.Session, error) {
+	if id == "" {
+		return core.Session{}, nil
+	}
+	var s = core.Session{ID: id}
+	switch err := db.get.QueryRow(id).Scan(&s.UserID, &s.Created, &s.LastSeen, &s.UserAgent, &s.IP, &s.RememberHash); err {
+	case nil:
+		return s, nil
+	case sql.ErrNoRows:
+		return core.Session{}, nil
+	default:
+		return core.Session{}, err
+	}
+}
+
+func (db *SessionIndexDB) GetSessions(userID int) ([]core.Session, error) {
+
+	rows, err := db.getAll.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions = []core.Session{}
+	for rows.Next() {
+		var s = core.Session{UserID: userID}
+		if err := rows.Scan(&s.ID, &s.Created, &s.LastSeen, &s.UserAgent, &s.IP, &s.RememberHash); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (db *SessionIndexDB) InsertSession(s core.Session) error {
+	_, err := db.insert.Exec(s.ID, s.UserID, s.Created, s.LastSeen, s.UserAgent, s.IP, s.RememberHash)
+	return err
+}
+
+func (db *SessionIndexDB) TouchSession(id string, ts int64) error {
+	_, err := db.touch.Exec(ts, id)
+	return err
+}
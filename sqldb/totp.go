@@ -0,0 +1,155 @@
+package sqldb
+
+import (
+	"database/sql"
+)
+
+type TOTPDB struct {
+	*sql.DB
+	deleteRecovery *sql.Stmt
+	deleteSecret   *sql.Stmt
+	getRequired    *sql.Stmt
+	getSecret      *sql.Stmt
+	insertRecovery *sql.Stmt
+	require        *sql.Stmt
+	setSecret      *sql.Stmt
+	unrequire      *sql.Stmt
+	useRecovery    *sql.Stmt
+	useStep        *sql.Stmt
+}
+
+func NewTOTPDB(db *sql.DB) *TOTPDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS totp (
+			usr INTEGER PRIMARY KEY,
+			secret varchar(64) NOT NULL,
+			last_step INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS totp_recovery (
+			usr int(11) NOT NULL,
+			hash varchar(64) NOT NULL,
+			PRIMARY KEY (usr, hash)
+		);
+		CREATE TABLE IF NOT EXISTS totp_group (
+			grp INTEGER PRIMARY KEY
+		);`)
+
+	var totpDB = &TOTPDB{}
+	totpDB.DB = db
+	totpDB.deleteRecovery = mustPrepare(db, "DELETE FROM totp_recovery WHERE usr = ?")
+	totpDB.deleteSecret = mustPrepare(db, "DELETE FROM totp WHERE usr = ?")
+	totpDB.getRequired = mustPrepare(db, "SELECT grp FROM totp_group")
+	totpDB.getSecret = mustPrepare(db, "SELECT secret FROM totp WHERE usr = ?")
+	totpDB.insertRecovery = mustPrepare(db, "INSERT OR IGNORE INTO totp_recovery (usr, hash) VALUES (?, ?)")
+	totpDB.require = mustPrepare(db, "INSERT OR IGNORE INTO totp_group (grp) VALUES (?)")
+	totpDB.setSecret = mustPrepare(db, "REPLACE INTO totp (usr, secret, last_step) VALUES (?, ?, 0)")
+	totpDB.unrequire = mustPrepare(db, "DELETE FROM totp_group WHERE grp = ?")
+	totpDB.useRecovery = mustPrepare(db, "DELETE FROM totp_recovery WHERE usr = ? AND hash = ?")
+	totpDB.useStep = mustPrepare(db, "UPDATE totp SET last_step = ? WHERE usr = ? AND last_step < ?")
+	return totpDB
+}
+
+func (db *TOTPDB) DeleteTOTP(userID int) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Stmt(db.deleteRecovery).Exec(userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Stmt(db.deleteSecret).Exec(userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *TOTPDB) GetTOTPRequiredGroups() (map[int]bool, error) {
+	rows, err := db.getRequired.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups = make(map[int]bool)
+	for rows.Next() {
+		var groupID int
+		if err = rows.Scan(&groupID); err != nil {
+			return nil, err
+		}
+		groups[groupID] = true
+	}
+	return groups, nil
+}
+
+func (db *TOTPDB) GetTOTPSecret(userID int) (string, error) {
+	var secret string
+	switch err := db.getSecret.QueryRow(userID).Scan(&secret); err {
+	case nil:
+		return secret, nil
+	case sql.ErrNoRows:
+		return "", nil
+	default:
+		return "", err
+	}
+}
+
+func (db *TOTPDB) SetTOTP(userID int, secret string, recoveryHashes []string) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Stmt(db.setSecret).Exec(userID, secret); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Stmt(db.deleteRecovery).Exec(userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		if _, err = tx.Stmt(db.insertRecovery).Exec(userID, hash); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *TOTPDB) SetTOTPRequired(groupID int, required bool) error {
+	var err error
+	if required {
+		_, err = db.require.Exec(groupID)
+	} else {
+		_, err = db.unrequire.Exec(groupID)
+	}
+	return err
+}
+
+func (db *TOTPDB) UseRecoveryCode(userID int, hash string) (bool, error) {
+	res, err := db.useRecovery.Exec(userID, hash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (db *TOTPDB) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := db.useStep.Exec(step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
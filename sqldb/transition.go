@@ -0,0 +1,107 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/wansing/perspective/core"
+)
+
+type transition struct {
+	versionNo   int
+	fromGroupID int
+	toGroupID   int
+	userID      int
+	username    string
+	ts          int64
+	comment     string
+}
+
+func (t *transition) VersionNo() int {
+	return t.versionNo
+}
+
+func (t *transition) FromGroupID() int {
+	return t.fromGroupID
+}
+
+func (t *transition) ToGroupID() int {
+	return t.toGroupID
+}
+
+func (t *transition) UserID() int {
+	return t.userID
+}
+
+func (t *transition) Username() string {
+	return t.username
+}
+
+func (t *transition) Ts() int64 {
+	return t.ts
+}
+
+func (t *transition) Comment() string {
+	return t.comment
+}
+
+type TransitionDB struct {
+	db     *sql.DB
+	delete *sql.Stmt
+	get    *sql.Stmt
+	insert *sql.Stmt
+}
+
+func NewTransitionDB(db *sql.DB) *TransitionDB {
+
+	db.Exec(`
+		CREATE TABLE IF NOT EXISTS version_transition (
+			id INTEGER PRIMARY KEY,
+			elementId int(11) NOT NULL,
+			versionNr int(11) NOT NULL,
+			from_group int(11) NOT NULL,
+			to_group int(11) NOT NULL,
+			usr int(11) NOT NULL,
+			username varchar(128) NOT NULL,
+			ts INTEGER NOT NULL,
+			comment varchar(1000) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS version_transition_element ON version_transition (elementId);`)
+
+	var transitionDB = &TransitionDB{}
+	transitionDB.db = db
+	transitionDB.delete = mustPrepare(db, "DELETE FROM version_transition WHERE elementId = ?")
+	transitionDB.get = mustPrepare(db, "SELECT versionNr, from_group, to_group, usr, username, ts, comment FROM version_transition WHERE elementId = ? ORDER BY id")
+	transitionDB.insert = mustPrepare(db, "INSERT INTO version_transition (elementId, versionNr, from_group, to_group, usr, username, ts, comment) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	return transitionDB
+}
+
+func (db *TransitionDB) DeleteTransitions(nodeID int) error {
+	_, err := db.delete.Exec(nodeID)
+	return err
+}
+
+func (db *TransitionDB) GetTransitions(nodeID int) ([]core.DBTransition, error) {
+
+	rows, err := db.get.Query(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transitions = []core.DBTransition{}
+
+	for rows.Next() {
+		var t = &transition{}
+		if err = rows.Scan(&t.versionNo, &t.fromGroupID, &t.toGroupID, &t.userID, &t.username, &t.ts, &t.comment); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+
+	return transitions, nil
+}
+
+func (db *TransitionDB) InsertTransition(nodeID, versionNo, fromGroupID, toGroupID, userID int, username string, ts int64, comment string) error {
+	_, err := db.insert.Exec(nodeID, versionNo, fromGroupID, toGroupID, userID, username, ts, comment)
+	return err
+}
@@ -9,3 +9,21 @@ func mustPrepare(db *sql.DB, query string) *sql.Stmt {
 	}
 	return stmt
 }
+
+// queryIDs returns the ints of the first column.
+func queryIDs(stmt *sql.Stmt, args ...interface{}) ([]int, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids = []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -11,6 +11,8 @@ type workflow struct {
 	db           *WorkflowDB // required for lazy loading
 	id           int
 	name         string
+	model        string
+	approvals    int
 	groups       []int // without 0
 	groupsLoaded bool  // lazy loading
 }
@@ -23,6 +25,14 @@ func (w *workflow) Name() string {
 	return w.name
 }
 
+func (w *workflow) Model() string {
+	return w.model
+}
+
+func (w *workflow) RequiredApprovals() int {
+	return w.approvals
+}
+
 func (w *workflow) Groups() ([]int, error) {
 
 	if !w.groupsLoaded {
@@ -80,6 +90,7 @@ type WorkflowDB struct {
 	groups *sql.Stmt
 	insert *sql.Stmt
 	push   *sql.Stmt
+	model  *sql.Stmt
 }
 
 func NewWorkflowDB(db *sql.DB) *WorkflowDB {
@@ -88,6 +99,8 @@ func NewWorkflowDB(db *sql.DB) *WorkflowDB {
 		CREATE TABLE IF NOT EXISTS workflow (
 			workflowId INTEGER PRIMARY KEY,
 			workflowName varchar(32) NOT NULL,
+			model varchar(32) NOT NULL DEFAULT 'subset',
+			approvals int(11) NOT NULL DEFAULT 1,
 			UNIQUE (workflowName)
 		);
 		CREATE TABLE IF NOT EXISTS workflow_position (
@@ -97,13 +110,18 @@ func NewWorkflowDB(db *sql.DB) *WorkflowDB {
 			PRIMARY KEY (workflowId,position)
 		);`)
 
+	// upgrade existing databases, errors are ignored if the columns exist already
+	db.Exec(`ALTER TABLE workflow ADD COLUMN model varchar(32) NOT NULL DEFAULT 'subset'`)
+	db.Exec(`ALTER TABLE workflow ADD COLUMN approvals int(11) NOT NULL DEFAULT 1`)
+
 	var workflowDB = &WorkflowDB{}
 	workflowDB.DB = db
 	workflowDB.clear = mustPrepare(db, "DELETE FROM workflow_position WHERE workflowId = ?")
 	workflowDB.delete = mustPrepare(db, "DELETE FROM workflow WHERE workflowId = ?")
-	workflowDB.get = mustPrepare(db, "SELECT workflowName FROM workflow WHERE workflowId = ? LIMIT 1")
-	workflowDB.getAll = mustPrepare(db, "SELECT workflowId, workflowName FROM workflow ORDER BY workflowName LIMIT ? OFFSET ?")
+	workflowDB.get = mustPrepare(db, "SELECT workflowName, model, approvals FROM workflow WHERE workflowId = ? LIMIT 1")
+	workflowDB.getAll = mustPrepare(db, "SELECT workflowId, workflowName, model, approvals FROM workflow ORDER BY workflowName LIMIT ? OFFSET ?")
 	workflowDB.groups = mustPrepare(db, "SELECT groupId FROM workflow_position WHERE workflowId = ? ORDER BY position")
+	workflowDB.model = mustPrepare(db, "UPDATE workflow SET model = ?, approvals = ? WHERE workflowId = ?")
 	workflowDB.insert = mustPrepare(db, "INSERT INTO workflow (workflowName) VALUES (?)")
 	workflowDB.push = mustPrepare(db, "INSERT INTO workflow_position (workflowId, position, groupId) VALUES (?, ?, ?)")
 	return workflowDB
@@ -118,7 +136,7 @@ func (db *WorkflowDB) GetWorkflow(id int) (core.DBWorkflow, error) {
 		db: db,
 		id: id,
 	}
-	return w, db.get.QueryRow(id).Scan(&w.name)
+	return w, db.get.QueryRow(id).Scan(&w.name, &w.model, &w.approvals)
 }
 
 func (db *WorkflowDB) GetAllWorkflows(limit, offset int) ([]core.DBWorkflow, error) {
@@ -132,17 +150,14 @@ func (db *WorkflowDB) GetAllWorkflows(limit, offset int) ([]core.DBWorkflow, err
 	var all = []core.DBWorkflow{}
 
 	for rows.Next() {
-		var id int
-		var name string
-		err = rows.Scan(&id, &name)
+		var w = &workflow{
+			db: db,
+		}
+		err = rows.Scan(&w.id, &w.name, &w.model, &w.approvals)
 		if err != nil {
 			return nil, err
 		}
-		all = append(all, &workflow{
-			db:   db,
-			id:   id,
-			name: name,
-		})
+		all = append(all, w)
 	}
 
 	return all, nil
@@ -153,6 +168,11 @@ func (db *WorkflowDB) InsertWorkflow(name string) error {
 	return err
 }
 
+func (db *WorkflowDB) SetModel(w core.DBWorkflow, model string, requiredApprovals int) error {
+	_, err := db.model.Exec(model, requiredApprovals, w.ID())
+	return err
+}
+
 func (db *WorkflowDB) UpdateWorkflow(w core.DBWorkflow, groups []int) error {
 
 	for _, group := range groups {